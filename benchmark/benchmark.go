@@ -50,50 +50,13 @@ func collectKeyTypes(resp *dns.Msg) []string {
 						log.Println("DNSKEY could not be decoded.")
 						continue
 					}
-
-					keyLength := "UNKNOWN"
-					switch key.Algorithm {
-					case dns.RSAMD5, dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512:
-						var exponentLength uint64
-						exponentStart := 0
-						// According to RFC 3110, "[the exponent] length in octets is represented
-						// as one octet if it is in the range of 1 to 255 and by a zero octet
-						// followed by a two octet unsigned length if it is longer than 255 bytes"
-						if uint8(keyBytes[0]) == 0 {
-							exponentLength = binary.BigEndian.Uint64(keyBytes[1:3])
-							exponentStart = 3
-						} else {
-							exponentLength = uint64(keyBytes[0])
-							exponentStart = 1
-						}
-
-						keyLengthL := len(keyBytes) - exponentStart - int(exponentLength)
-						keyLength = strconv.FormatUint(uint64(keyLengthL*8), 10)
-					case dns.DH:
-						// can be determined as in https://www.rfc-editor.org/rfc/rfc2539
-						keyLength = "UNKNOWN"
-					case dns.DSA, dns.DSANSEC3SHA1:
-						// can be determined as in https://www.rfc-editor.org/rfc/rfc2536#page-2
-						keyLength = "UNKNOWN"
-					case dns.ECDSAP256SHA256:
-						keyLength = "UNKNOWN"
-					case dns.ECDSAP384SHA384:
-						keyLength = "UNKNOWN"
-					case dns.ECCGOST:
-						// not interesting, the key size MUST be 512 bits according
-						// to https://www.rfc-editor.org/rfc/rfc5933#page-6
-						keyLength = "512"
-					case dns.ED25519:
-						// keys have a fixed length of 256
-						keyLength = "256"
-					case dns.ED448:
-						// keys have a fixed length
-						keyLength = "456"
-					default:
-						keyLength = "UNKNOWN"
-					}
-
-					keyAlgs = append(keyAlgs, dns.AlgorithmToString[key.Algorithm]+"--"+keyLength)
+					keyAlgs = append(keyAlgs, keyType(key.Algorithm, keyBytes))
+				}
+			}
+		case *dns.DNSSECProof:
+			for _, zone := range t.Zones {
+				for _, key := range zone.Entry.Keys {
+					keyAlgs = append(keyAlgs, keyType(key.Algorithm, key.Public_key))
 				}
 			}
 		default:
@@ -104,7 +67,106 @@ func collectKeyTypes(resp *dns.Msg) []string {
 	return keyAlgs
 }
 
-func bench(protocol string, serializedQueries map[BenchQuery][]byte, odohQueryContext map[BenchQuery]*odoh.QueryContext, resolverHostname string, parallelism int, anchor bootstrap.TrustAnchor, proxyURL *url.URL, isSocks5 bool, outFile string) error {
+// keyType describes a key by its algorithm and, where it can be determined, its length in bits
+func keyType(algorithm uint8, keyBytes []byte) string {
+	keyLength := "UNKNOWN"
+	switch algorithm {
+	case dns.RSAMD5, dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512:
+		if len(keyBytes) < 3 {
+			break
+		}
+		var exponentLength uint64
+		exponentStart := 0
+		// According to RFC 3110, "[the exponent] length in octets is represented
+		// as one octet if it is in the range of 1 to 255 and by a zero octet
+		// followed by a two octet unsigned length if it is longer than 255 bytes"
+		if uint8(keyBytes[0]) == 0 {
+			exponentLength = uint64(binary.BigEndian.Uint16(keyBytes[1:3]))
+			exponentStart = 3
+		} else {
+			exponentLength = uint64(keyBytes[0])
+			exponentStart = 1
+		}
+
+		keyLengthL := len(keyBytes) - exponentStart - int(exponentLength)
+		keyLength = strconv.FormatUint(uint64(keyLengthL*8), 10)
+	case dns.DH:
+		// can be determined as in https://www.rfc-editor.org/rfc/rfc2539
+		keyLength = "UNKNOWN"
+	case dns.DSA, dns.DSANSEC3SHA1:
+		// can be determined as in https://www.rfc-editor.org/rfc/rfc2536#page-2
+		keyLength = "UNKNOWN"
+	case dns.ECDSAP256SHA256:
+		keyLength = "UNKNOWN"
+	case dns.ECDSAP384SHA384:
+		keyLength = "UNKNOWN"
+	case dns.ECCGOST:
+		// not interesting, the key size MUST be 512 bits according
+		// to https://www.rfc-editor.org/rfc/rfc5933#page-6
+		keyLength = "512"
+	case dns.ED25519:
+		// keys have a fixed length of 256
+		keyLength = "256"
+	case dns.ED448:
+		// keys have a fixed length
+		keyLength = "456"
+	case dns.PRIVATEDNS:
+		// experimental algorithms are told apart by the name the key starts with
+		alg, key, err := verification.ParseExperimental(keyBytes)
+		if err != nil {
+			break
+		}
+		return alg.Name + "-" + alg.Submission + "--" + strconv.Itoa(len(key)*8)
+	default:
+		keyLength = "UNKNOWN"
+	}
+
+	return dns.AlgorithmToString[algorithm] + "--" + keyLength
+}
+
+// rfc9102Size is the size the proof chain in the response would have as an RFC 9102 authentication chain
+func rfc9102Size(resp *dns.Msg) int {
+	for _, rr := range resp.Extra {
+		if chain, ok := rr.(*dns.Chain); ok {
+			authChain := verification.AuthenticationChain{RRs: verification.ChainToRFC9102(chain)}
+			b, err := authChain.Pack()
+			if err != nil {
+				log.Printf("unable to convert the proof chain to RFC 9102: %v\n", err)
+				return 0
+			}
+			return len(b)
+		}
+	}
+	return 0
+}
+
+// chainSize breaks the proof chain in the response down by zone and section, nil if there is none
+func chainSize(resp *dns.Msg) *verification.ChainSize {
+	for _, rr := range resp.Extra {
+		if chain, ok := rr.(*dns.Chain); ok {
+			size, err := verification.MeasureChain(chain)
+			if err != nil {
+				log.Printf("unable to measure the proof chain: %v\n", err)
+				return nil
+			}
+			return size
+		}
+	}
+	return nil
+}
+
+// proofType names the kind of DNSSEC proof carried in the response
+func proofType(resp *dns.Msg) string {
+	for _, rr := range resp.Extra {
+		switch rr.(type) {
+		case *dns.Chain, *dns.DNSSECProof:
+			return dns.TypeToString[rr.Header().Rrtype]
+		}
+	}
+	return "None"
+}
+
+func bench(protocol string, serializedQueries map[BenchQuery][]byte, odohQueryContext map[BenchQuery]*odoh.QueryContext, resolverHostname string, parallelism int, anchor bootstrap.TrustAnchor, verificationOptions *verification.Options, proxyURL *url.URL, isSocks5 bool, outFile string) error {
 
 	f, err := os.OpenFile(outFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
@@ -133,10 +195,14 @@ func bench(protocol string, serializedQueries map[BenchQuery][]byte, odohQueryCo
 			useODoH := false
 			contentType := common.DOH_CONTENT_TYPE
 
+			trustPoint := ""
 			if odohQueryContext != nil {
 				queryContext = odohQueryContext[query]
 				useODoH = true
 				contentType = common.ODOH_CONTENT_TYPE
+			} else {
+				// ODoH queries are encrypted ahead of time, only plain DoH queries can ask for a shorter chain
+				serializedQuery, trustPoint = requestTrustPoint(verificationOptions, serializedQuery)
 			}
 			resp, report, _ := network.QueryDNS(resolverHostname,
 				serializedQuery,
@@ -152,13 +218,14 @@ func bench(protocol string, serializedQueries map[BenchQuery][]byte, odohQueryCo
 
 			verificationStartTime := time.Now()
 
-			validity, _ := verification.ValidateDNSSECSignature(resp, query.Query, &anchor)
+			result := verification.ValidateDNSSECSignature(resp, query.Query, query.QueryType, &anchor, verificationOptions)
 			verificationEndTime := time.Now()
 			t := Telemetry{
 				Protocol:                protocol,
 				Query:                   query.Query,
 				QueryType:               query.QueryType,
-				VerificationStatus:      validity,
+				VerificationStatus:      result.Status,
+				VerificationReason:      result.Reason,
 				StartTime:               report.StartTime,
 				EndTime:                 report.EndTime,
 				NetworkTime:             report.NetworkTime,
@@ -167,6 +234,10 @@ func bench(protocol string, serializedQueries map[BenchQuery][]byte, odohQueryCo
 				ResponseSizeBytesOnWire: report.ResponseSizeBytesOnWire,
 				DNSResponseSizeBytes:    report.ResponseSizeBytes,
 				KeyTypes:                collectKeyTypes(resp),
+				ProofType:               proofType(resp),
+				RFC9102SizeBytes:        rfc9102Size(resp),
+				ChainSize:               chainSize(resp),
+				TrustPoint:              trustPoint,
 				EncryptionTime:          query.EncryptionTime,
 			}
 			if report.DecryptionTime != nil {
@@ -185,11 +256,12 @@ func bench(protocol string, serializedQueries map[BenchQuery][]byte, odohQueryCo
 	}
 
 	wg.Wait()
+	SaveVerificationState(verificationOptions, &anchor)
 
 	return nil
 }
 
-func benchDO53(connectionProtocolType string, serializedQueries map[BenchQuery]*dns.Msg, connectionString string, parallelism int, anchor bootstrap.TrustAnchor, outFile string) error {
+func benchDO53(connectionProtocolType string, serializedQueries map[BenchQuery]*dns.Msg, connectionString string, parallelism int, anchor bootstrap.TrustAnchor, verificationOptions *verification.Options, outFile string) error {
 	// Prepare clients.
 	clients := make([]*dns.Client, 0)
 	for i := 0; i < parallelism; i++ {
@@ -226,6 +298,11 @@ func benchDO53(connectionProtocolType string, serializedQueries map[BenchQuery]*
 
 		go func(serializedQuery *dns.Msg, query BenchQuery, counter int64) {
 			c := clients[int(counter)%len(clients)]
+			trustPoint := ""
+			if verificationOptions != nil && verificationOptions.KeyCache != nil {
+				serializedQuery = serializedQuery.Copy()
+				trustPoint = verificationOptions.KeyCache.SetChainOption(serializedQuery, time.Now())
+			}
 			nwStart := time.Now()
 			resp, _, _ := c.Exchange(serializedQuery, connectionString)
 			nwEnd := time.Now()
@@ -235,14 +312,15 @@ func benchDO53(connectionProtocolType string, serializedQueries map[BenchQuery]*
 			}
 
 			vsStart := time.Now()
-			validity, _ := verification.ValidateDNSSECSignature(resp, query.Query, &anchor)
+			result := verification.ValidateDNSSECSignature(resp, query.Query, query.QueryType, &anchor, verificationOptions)
 			vsEnd := time.Now()
 
 			t := Telemetry{
 				Protocol:                fmt.Sprintf("do53-%v", connectionProtocolType),
 				Query:                   query.Query,
 				QueryType:               query.QueryType,
-				VerificationStatus:      validity,
+				VerificationStatus:      result.Status,
+				VerificationReason:      result.Reason,
 				StartTime:               nwStart,
 				EndTime:                 nwEnd,
 				NetworkTime:             nwEnd.Sub(nwStart),
@@ -251,6 +329,10 @@ func benchDO53(connectionProtocolType string, serializedQueries map[BenchQuery]*
 				ResponseSizeBytesOnWire: resp.Len(),
 				DNSResponseSizeBytes:    resp.Len(),
 				KeyTypes:                collectKeyTypes(resp),
+				ProofType:               proofType(resp),
+				RFC9102SizeBytes:        rfc9102Size(resp),
+				ChainSize:               chainSize(resp),
+				TrustPoint:              trustPoint,
 				EncryptionTime:          0,
 				DecryptionTime:          0,
 			}
@@ -266,6 +348,7 @@ func benchDO53(connectionProtocolType string, serializedQueries map[BenchQuery]*
 	}
 
 	wg.Wait()
+	SaveVerificationState(verificationOptions, &anchor)
 
 	return nil
 }
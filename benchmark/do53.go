@@ -2,7 +2,6 @@ package benchmark
 
 import (
 	"fmt"
-	"github.com/cloudflare/odoh-client-go/bootstrap"
 	"github.com/cloudflare/odoh-client-go/common"
 	"github.com/miekg/dns"
 	"github.com/urfave/cli/v2"
@@ -43,7 +42,14 @@ func BenchmarkDo53WithDNSSEC(c *cli.Context) error {
 
 	outputPath := fmt.Sprintf("%v/results-%v-%v-DO-proof-%v-%v.csv", outputDir, "Do53", protocolUsed, dnssec, time.Now().UnixNano())
 
-	anchor := bootstrap.CheckAndValidateDNSRootAnchors()
+	anchor, err := TrustAnchor(c)
+	if err != nil {
+		return err
+	}
+	verificationOptions, err := VerificationOptions(c)
+	if err != nil {
+		return err
+	}
 	dnsType := common.DnsQueryStringToType(dnsTypeString)
 	CheckIfDirectoryExistsOrCreate(outputDir)
 	queries := ReadInputQueryList(inputFile)
@@ -61,5 +67,5 @@ func BenchmarkDo53WithDNSSEC(c *cli.Context) error {
 		serializedQueryMap[benchQ] = dnsQ
 	}
 
-	return benchDO53(protocolUsed, serializedQueryMap, connectToResolverAt, requestRate, anchor, outputPath)
+	return benchDO53(protocolUsed, serializedQueryMap, connectToResolverAt, requestRate, anchor, verificationOptions, outputPath)
 }
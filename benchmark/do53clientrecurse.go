@@ -7,6 +7,7 @@ import (
 	"github.com/cloudflare/odoh-client-go/benchmark/resolver"
 	"github.com/cloudflare/odoh-client-go/bootstrap"
 	"github.com/cloudflare/odoh-client-go/common"
+	"github.com/cloudflare/odoh-client-go/verification"
 	"github.com/miekg/dns"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/sync/semaphore"
@@ -77,7 +78,7 @@ func benchDo53ClientActions(connectionProtocolType string, serializedQueries map
 				Protocol:                fmt.Sprintf("do53-%v-client", connectionProtocolType),
 				Query:                   query.Query,
 				QueryType:               query.QueryType,
-				VerificationStatus:      false,
+				VerificationStatus:      verification.Indeterminate,
 				StartTime:               nwStart,
 				EndTime:                 nwEnd,
 				NetworkTime:             nwEnd.Sub(nwStart),
@@ -85,6 +86,7 @@ func benchDo53ClientActions(connectionProtocolType string, serializedQueries map
 				QuerySizeBytesOnWire:    queryBytesOnWire,
 				ResponseSizeBytesOnWire: respBytesOnWire,
 				DNSResponseSizeBytes:    len(respBytes), // Effective result bytes.
+				ProofType:               proofType(resp),
 				EncryptionTime:          0,
 				DecryptionTime:          0,
 			}
@@ -131,7 +133,10 @@ func BenchmarkDo53WithClientRecursion(c *cli.Context) error {
 
 	outputPath := fmt.Sprintf("%v/results-%v-%v-DO-proof-%v-%v.csv", outputDir, "Do53-client", protocolUsed, dnssec, time.Now().UnixNano())
 
-	anchor := bootstrap.CheckAndValidateDNSRootAnchors()
+	anchor, err := TrustAnchor(c)
+	if err != nil {
+		return err
+	}
 	dnsType := common.DnsQueryStringToType(dnsTypeString)
 	CheckIfDirectoryExistsOrCreate(outputDir)
 	queries := ReadInputQueryList(inputFile)
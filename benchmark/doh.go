@@ -2,7 +2,6 @@ package benchmark
 
 import (
 	"fmt"
-	"github.com/cloudflare/odoh-client-go/bootstrap"
 	"github.com/cloudflare/odoh-client-go/common"
 	"github.com/urfave/cli/v2"
 	"time"
@@ -18,7 +17,14 @@ func BenchmarkDoHWithDNSSEC(c *cli.Context) error {
 
 	outputPath := fmt.Sprintf("%v/results-%v-DO-proof-%v-%v.csv", outputDir, "DoH", dnssec, time.Now().UnixNano())
 
-	anchor := bootstrap.CheckAndValidateDNSRootAnchors()
+	anchor, err := TrustAnchor(c)
+	if err != nil {
+		return err
+	}
+	verificationOptions, err := VerificationOptions(c)
+	if err != nil {
+		return err
+	}
 
 	dnsType := common.DnsQueryStringToType(dnsTypeString)
 
@@ -39,5 +45,5 @@ func BenchmarkDoHWithDNSSEC(c *cli.Context) error {
 		serializedQueryMap[benchQ] = serQ
 	}
 
-	return bench("DoH", serializedQueryMap, nil, resolverHostname, requestRate, anchor, nil, false, outputPath)
+	return bench("DoH", serializedQueryMap, nil, resolverHostname, requestRate, anchor, verificationOptions, nil, false, outputPath)
 }
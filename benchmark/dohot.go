@@ -2,7 +2,6 @@ package benchmark
 
 import (
 	"fmt"
-	"github.com/cloudflare/odoh-client-go/bootstrap"
 	"github.com/cloudflare/odoh-client-go/common"
 	"github.com/urfave/cli/v2"
 	"net/url"
@@ -26,7 +25,14 @@ func BenchmarkDoHoTWithDNSSEC(c *cli.Context) error {
 
 	outputPath := fmt.Sprintf("%v/results-%v-DO-proof-%v-%v.csv", outputDir, "DoHoT", dnssec, time.Now().UnixNano())
 
-	anchor := bootstrap.CheckAndValidateDNSRootAnchors()
+	anchor, err := TrustAnchor(c)
+	if err != nil {
+		return err
+	}
+	verificationOptions, err := VerificationOptions(c)
+	if err != nil {
+		return err
+	}
 
 	dnsType := common.DnsQueryStringToType(dnsTypeString)
 	CheckIfDirectoryExistsOrCreate(outputDir)
@@ -46,5 +52,5 @@ func BenchmarkDoHoTWithDNSSEC(c *cli.Context) error {
 		serializedQueryMap[benchQ] = serQ
 	}
 
-	return bench("DoHoT", serializedQueryMap, nil, resolverHostname, requestRate, anchor, socks5proxy, true, outputPath)
+	return bench("DoHoT", serializedQueryMap, nil, resolverHostname, requestRate, anchor, verificationOptions, socks5proxy, true, outputPath)
 }
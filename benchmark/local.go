@@ -0,0 +1,139 @@
+package benchmark
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/odoh-client-go/common"
+	"github.com/cloudflare/odoh-client-go/verification"
+	"github.com/miekg/dns"
+	"github.com/urfave/cli/v2"
+)
+
+// localRecordData is the data of the records locally signed chains prove, by type
+var localRecordData = map[uint16]string{
+	dns.TypeA:    "192.0.2.1",
+	dns.TypeAAAA: "2001:db8::1",
+	dns.TypeTXT:  "\"locally signed\"",
+}
+
+// BenchmarkLocalChains signs a proof chain for every query with each of the algorithms and measures its size and
+// verification time, without a resolver. This puts algorithms no resolver serves, like the experimental post-quantum
+// ones, next to RSA and ECDSA on the same names. Chains are verified one after the other so the times do not interfere.
+func BenchmarkLocalChains(c *cli.Context) error {
+	inputFile := c.String("input")
+	outputDir := c.String("output")
+	dnsTypeString := c.String("type")
+	algorithms := c.StringSlice("algorithms")
+	rsaBits := c.Int("rsa-bits")
+
+	outputPath := fmt.Sprintf("%v/results-%v-%v.csv", outputDir, "local", time.Now().UnixNano())
+
+	verificationOptions, err := VerificationOptions(c)
+	if err != nil {
+		return err
+	}
+	// the zones are made up, they must not end up in the state file or the key cache
+	verificationOptions.SignedZones = nil
+	verificationOptions.KeyCache = nil
+	verificationOptions.ManagedKeys = nil
+	verificationOptions.ProofRequested = true
+	// the experimental algorithms are forbidden by default, made up chains are the one place they are meant for
+	delete(verificationOptions.Policy.ForbiddenAlgorithms, dns.PRIVATEDNS)
+
+	dnsType := common.DnsQueryStringToType(dnsTypeString)
+	rdata, ok := localRecordData[dnsType]
+	if !ok {
+		return fmt.Errorf("locally signed chains can only prove A, AAAA and TXT records, not %v", dnsTypeString)
+	}
+
+	CheckIfDirectoryExistsOrCreate(outputDir)
+	queries := ReadInputQueryList(inputFile)
+	fmt.Printf("Number of queries: %v\n", len(queries))
+	fmt.Printf("Algorithms: %v\n", strings.Join(algorithms, ", "))
+
+	f, err := os.OpenFile(outputPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		panic("unable to open an output file for writing out results")
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(strings.Join(TelemetryHeader(), ",") + "\n"); err != nil {
+		log.Println("failed to write header to disk in output file.")
+	}
+
+	for _, q := range queries {
+		query := PrepareDNSQuery(q, dnsType, true)
+		name := query.Question[0].Name
+		leaf, err := dns.NewRR(fmt.Sprintf("%s 300 IN %s %s", name, dns.TypeToString[dnsType], rdata))
+		if err != nil {
+			log.Printf("unable to build a record for %v: %v\n", name, err)
+			continue
+		}
+		for _, algorithm := range algorithms {
+			t, err := benchLocalChain(query, leaf, algorithm, rsaBits, verificationOptions)
+			if err != nil {
+				log.Printf("unable to sign a chain for %v with %v: %v\n", name, algorithm, err)
+				continue
+			}
+			if _, err := f.WriteString(strings.Join(t.Serialize(), ",") + "\n"); err != nil {
+				log.Println("failed to write to disk")
+			}
+		}
+	}
+
+	return nil
+}
+
+// benchLocalChain answers query with leaf and a chain signed with algorithm, and verifies the response as it would be received.
+func benchLocalChain(query *dns.Msg, leaf dns.RR, algorithm string, rsaBits int, verificationOptions *verification.Options) (*Telemetry, error) {
+	now := time.Now()
+	chain, anchor, err := verification.SignChain([]dns.RR{leaf}, algorithm, rsaBits, now.Add(-time.Hour), now.Add(24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	resp.Answer = []dns.RR{leaf}
+	resp.Extra = []dns.RR{chain}
+	resp.SetEdns0(4096, true)
+	packed, err := resp.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("the response does not fit in a DNS message: %w", err)
+	}
+	received := new(dns.Msg)
+	if err := received.Unpack(packed); err != nil {
+		return nil, err
+	}
+	packedQuery, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	question := query.Question[0]
+	verificationStartTime := time.Now()
+	result := verification.ValidateDNSSECSignature(received, question.Name, question.Qtype, anchor, verificationOptions)
+	verificationEndTime := time.Now()
+
+	return &Telemetry{
+		Protocol:                "local",
+		Query:                   question.Name,
+		QueryType:               question.Qtype,
+		VerificationStatus:      result.Status,
+		VerificationReason:      result.Reason,
+		StartTime:               verificationStartTime,
+		EndTime:                 verificationEndTime,
+		VerificationTime:        verificationEndTime.Sub(verificationStartTime),
+		QuerySizeBytesOnWire:    len(packedQuery),
+		ResponseSizeBytesOnWire: len(packed),
+		DNSResponseSizeBytes:    len(packed),
+		KeyTypes:                collectKeyTypes(received),
+		ProofType:               proofType(received),
+		RFC9102SizeBytes:        rfc9102Size(received),
+		ChainSize:               chainSize(received),
+	}, nil
+}
@@ -2,7 +2,6 @@ package benchmark
 
 import (
 	"fmt"
-	"github.com/cloudflare/odoh-client-go/bootstrap"
 	"github.com/cloudflare/odoh-client-go/common"
 	"github.com/cloudflare/odoh-client-go/network"
 	"github.com/cloudflare/odoh-go"
@@ -21,7 +20,14 @@ func BenchmarkODoHWithDNSSEC(c *cli.Context) error {
 
 	outputPath := fmt.Sprintf("%v/results-%v-DO-proof-%v-%v.csv", outputDir, "ODoH", dnssec, time.Now().UnixNano())
 
-	anchor := bootstrap.CheckAndValidateDNSRootAnchors()
+	anchor, err := TrustAnchor(c)
+	if err != nil {
+		return err
+	}
+	verificationOptions, err := VerificationOptions(c)
+	if err != nil {
+		return err
+	}
 	dnsType := common.DnsQueryStringToType(dnsTypeString)
 	CheckIfDirectoryExistsOrCreate(outputDir)
 	queries := ReadInputQueryList(inputFile)
@@ -57,5 +63,5 @@ func BenchmarkODoHWithDNSSEC(c *cli.Context) error {
 		serializedQueryMap[benchQ] = packedDnsQuery
 	}
 
-	return bench("ODoH", serializedQueryMap, odohQueryContextMap, odohTargetHostname, requestRate, anchor, proxyURL, false, outputPath)
+	return bench("ODoH", serializedQueryMap, odohQueryContextMap, odohTargetHostname, requestRate, anchor, verificationOptions, proxyURL, false, outputPath)
 }
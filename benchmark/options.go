@@ -0,0 +1,109 @@
+package benchmark
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cloudflare/odoh-client-go/bootstrap"
+	"github.com/cloudflare/odoh-client-go/verification"
+	"github.com/miekg/dns"
+	"github.com/urfave/cli/v2"
+)
+
+// VerificationOptions builds the options used to validate responses from the verification flags of a command
+func VerificationOptions(c *cli.Context) (*verification.Options, error) {
+	policy, err := verification.ParsePolicy(
+		c.StringSlice("allow-algorithms"),
+		c.StringSlice("forbid-algorithms"),
+		c.StringSlice("allow-digests"),
+		c.StringSlice("forbid-digests"),
+		c.Int("min-rsa-bits"))
+	if err != nil {
+		return nil, err
+	}
+
+	opts := verification.DefaultOptions()
+	opts.ClockSkew = c.Duration("clock-skew")
+	opts.Policy = policy
+	opts.ProofRequested = c.Bool("dnssec")
+	opts.Strict = c.Bool("strict")
+	opts.Limits = &verification.Limits{
+		MaxZones:                c.Int("max-zones"),
+		MaxKeysPerZone:          c.Int("max-keys"),
+		MaxKeyTagCollisions:     c.Int("max-key-tag-collisions"),
+		MaxSignatureValidations: c.Int("max-signature-validations"),
+		MaxValidationTime:       c.Duration("max-validation-time"),
+		MaxRewrites:             c.Int("max-rewrites"),
+	}
+	if stateFile := c.String("state-file"); stateFile != "" {
+		if opts.SignedZones, err = verification.LoadSignedZones(stateFile); err != nil {
+			return nil, fmt.Errorf("unable to read the state file %v: %w", stateFile, err)
+		}
+	}
+	if managedKeysFile := c.String("managed-keys"); managedKeysFile != "" {
+		if opts.ManagedKeys, err = verification.LoadManagedKeys(managedKeysFile); err != nil {
+			return nil, fmt.Errorf("unable to read the managed keys file %v: %w", managedKeysFile, err)
+		}
+		opts.ManagedKeys.AddHoldDown = c.Duration("add-hold-down")
+	}
+	if c.Bool("key-cache") {
+		opts.KeyCache = verification.NewKeyCache()
+	}
+	return opts, nil
+}
+
+// TrustAnchor loads the root trust anchor from the source selected by the anchor flags of a command
+func TrustAnchor(c *cli.Context) (bootstrap.TrustAnchor, error) {
+	source, err := bootstrap.NewTrustAnchorSource(c.String("anchor-source"), c.String("anchor-dir"), c.String("anchor-file"))
+	if err != nil {
+		return bootstrap.TrustAnchor{}, err
+	}
+	anchor, err := source.TrustAnchor()
+	if err != nil {
+		return bootstrap.TrustAnchor{}, fmt.Errorf("unable to load the trust anchor from %v: %w", c.String("anchor-source"), err)
+	}
+	return anchor, nil
+}
+
+// requestTrustPoint adds a CHAIN option for the deepest zone in the key cache to a serialized query.
+// It returns the query and the zone, or the query unchanged if no zone is cached.
+func requestTrustPoint(opts *verification.Options, serializedQuery []byte) ([]byte, string) {
+	if opts == nil || opts.KeyCache == nil {
+		return serializedQuery, ""
+	}
+	msg := new(dns.Msg)
+	if err := msg.Unpack(serializedQuery); err != nil {
+		return serializedQuery, ""
+	}
+	zone := opts.KeyCache.SetChainOption(msg, time.Now())
+	if zone == "" {
+		return serializedQuery, ""
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		return serializedQuery, ""
+	}
+	return packed, zone
+}
+
+// SaveVerificationState writes back the zones that were seen signed and the root KSKs that were seen while validating,
+// and warns about differences between the root KSKs and the anchor
+func SaveVerificationState(opts *verification.Options, anchor *bootstrap.TrustAnchor) {
+	if opts == nil {
+		return
+	}
+	if opts.SignedZones != nil {
+		if err := opts.SignedZones.Save(); err != nil {
+			log.Printf("failed to save the DNSSEC state: %v\n", err)
+		}
+	}
+	if opts.ManagedKeys != nil {
+		if err := opts.ManagedKeys.Save(); err != nil {
+			log.Printf("failed to save the managed keys: %v\n", err)
+		}
+		for _, warning := range opts.ManagedKeys.Drift(anchor, time.Now()) {
+			log.Printf("trust anchor: %v\n", warning)
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package benchmark
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/cloudflare/odoh-client-go/verification"
 	"golang.org/x/net/idna"
 )
 
@@ -18,7 +20,8 @@ type Telemetry struct {
 	Protocol                string
 	Query                   string
 	QueryType               uint16
-	VerificationStatus      bool
+	VerificationStatus      verification.Status
+	VerificationReason      verification.Reason
 	StartTime               time.Time
 	EndTime                 time.Time
 	NetworkTime             time.Duration
@@ -27,6 +30,12 @@ type Telemetry struct {
 	ResponseSizeBytesOnWire int
 	DNSResponseSizeBytes    int
 	KeyTypes                []string
+	ProofType               string
+	RFC9102SizeBytes        int
+	// TrustPoint is the cached zone the proof was requested to start from, empty for a proof from the root
+	TrustPoint string
+	// ChainSize breaks the proof chain down by zone and section, nil without a chain
+	ChainSize *verification.ChainSize
 
 	// For ODoH
 	EncryptionTime time.Duration
@@ -40,12 +49,25 @@ func TelemetryHeader() []string {
 	header = append(header, "Query")
 	header = append(header, "QueryType")
 	header = append(header, "VerificationStatus")
+	header = append(header, "VerificationReason")
 	header = append(header, "NetworkTime")
 	header = append(header, "VerificationTime")
 	header = append(header, "QuerySizeOnWire")
 	header = append(header, "ResponseSizeOnWire")
 	header = append(header, "ResponseSize")
 	header = append(header, "KeyTypes")
+	header = append(header, "ProofType")
+	header = append(header, "RFC9102Size")
+	header = append(header, "TrustPoint")
+	header = append(header, "ChainOverheadSize")
+	header = append(header, "ChainKeySize")
+	header = append(header, "ChainKeySigSize")
+	header = append(header, "ChainDSSize")
+	header = append(header, "ChainDSSigSize")
+	header = append(header, "ChainLeafSize")
+	header = append(header, "ChainLeafSigSize")
+	header = append(header, "ChainCompressionSavings")
+	header = append(header, "ZoneSizes")
 	header = append(header, "EncryptionTime")
 	header = append(header, "DecryptionTime")
 
@@ -60,7 +82,8 @@ func (t *Telemetry) Serialize() []string {
 	res = append(res, t.Protocol)
 	res = append(res, queryUnicode)
 	res = append(res, strconv.FormatUint(uint64(t.QueryType), 10))
-	res = append(res, strconv.FormatBool(t.VerificationStatus))
+	res = append(res, t.VerificationStatus.String())
+	res = append(res, string(t.VerificationReason))
 	res = append(res, t.NetworkTime.String())
 	res = append(res, t.VerificationTime.String())
 	res = append(res, strconv.FormatInt(int64(t.QuerySizeBytesOnWire), 10))
@@ -77,9 +100,42 @@ func (t *Telemetry) Serialize() []string {
 		keyTypes.WriteString(keyType)
 	}
 	res = append(res, keyTypes.String())
+	res = append(res, t.ProofType)
+	res = append(res, strconv.FormatInt(int64(t.RFC9102SizeBytes), 10))
+	res = append(res, t.TrustPoint)
+	res = append(res, serializeChainSize(t.ChainSize)...)
 
 	res = append(res, t.EncryptionTime.String())
 	res = append(res, t.DecryptionTime.String())
 
 	return res
 }
+
+// serializeChainSize writes the chain size columns: the sizes of the sections summed over all zones, and the zones
+// as name:overhead:keys:keySigs:ds:dsSigs:leaves:leavesSigs separated by slashes.
+func serializeChainSize(size *verification.ChainSize) []string {
+	if size == nil {
+		return []string{"0", "0", "0", "0", "0", "0", "0", "0", ""}
+	}
+	sum := size.Sum()
+	res := []string{
+		strconv.Itoa(sum.Overhead),
+		strconv.Itoa(sum.Keys.Bytes),
+		strconv.Itoa(sum.KeySigs.Bytes),
+		strconv.Itoa(sum.DS.Bytes),
+		strconv.Itoa(sum.DSSigs.Bytes),
+		strconv.Itoa(sum.Leaves.Bytes),
+		strconv.Itoa(sum.LeavesSigs.Bytes),
+		strconv.Itoa(sum.CompressionSavings),
+	}
+
+	var zones strings.Builder
+	for i, zone := range size.Zones {
+		if i != 0 {
+			zones.WriteString("/")
+		}
+		fmt.Fprintf(&zones, "%s:%d:%d:%d:%d:%d:%d:%d", zone.Name, zone.Overhead, zone.Keys.Bytes, zone.KeySigs.Bytes,
+			zone.DS.Bytes, zone.DSSigs.Bytes, zone.Leaves.Bytes, zone.LeavesSigs.Bytes)
+	}
+	return append(res, zones.String())
+}
@@ -3,8 +3,12 @@ package bootstrap
 import (
 	"encoding/xml"
 	"errors"
+	"fmt"
 	"github.com/miekg/dns"
 	"log"
+	"os"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -27,17 +31,27 @@ type TrustAnchor struct {
 }
 
 func (k *KeyDigest) Verify() error {
-	now := time.Now()
-	if now.Before(*k.ValidFrom) || k.ValidUntil != nil && now.After(*k.ValidUntil) {
+	return k.VerifyAt(time.Now())
+}
+
+// VerifyAt checks that the key digest is valid at the given time
+func (k *KeyDigest) VerifyAt(now time.Time) error {
+	if k.ValidFrom != nil && now.Before(*k.ValidFrom) || k.ValidUntil != nil && now.After(*k.ValidUntil) {
 		return errors.New("key digest is invalid due to validity expiry")
 	}
 	return nil
 }
 
 func (t *TrustAnchor) ToDS() []dns.DS {
+	return t.ToDSAt(time.Now())
+}
+
+// ToDSAt returns the DS records of the key digests that are valid at the given time,
+// e.g. the time a recorded response was captured
+func (t *TrustAnchor) ToDSAt(now time.Time) []dns.DS {
 	res := make([]dns.DS, 0)
 	for _, digest := range t.Digests {
-		err := digest.Verify()
+		err := digest.VerifyAt(now)
 		if err != nil {
 			continue
 		}
@@ -56,6 +70,102 @@ func (t *TrustAnchor) ToDS() []dns.DS {
 	return res
 }
 
+// ZoneName is the zone the anchor is for, the root unless the anchor is for an island of security
+func (t *TrustAnchor) ZoneName() string {
+	if t.Zone == "" {
+		return "."
+	}
+	return dns.CanonicalName(t.Zone)
+}
+
+// LoadTrustAnchor reads a trust anchor file: the XML format IANA publishes the root anchors in, the trust-anchors
+// statement of BIND, an Unbound auto-trust-anchor-file or DS and DNSKEY records in zone file format. Unlike
+// CheckAndValidateDNSRootAnchors it neither downloads nor checks the signature of the file.
+func LoadTrustAnchor(filePath string) (TrustAnchor, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return TrustAnchor{}, err
+	}
+	var t TrustAnchor
+	switch text := string(data); {
+	case strings.HasPrefix(strings.TrimSpace(text), "<"):
+		t, err = parseXMLAnchor(data)
+	case isBINDAnchor(text):
+		t, err = ParseBINDAnchor(text)
+	default:
+		t, err = ParseRecordAnchor(text)
+	}
+	if err != nil {
+		return t, fmt.Errorf("unable to parse the trust anchor file %v: %w", filePath, err)
+	}
+	return t, nil
+}
+
+func parseXMLAnchor(xmlBytes []byte) (TrustAnchor, error) {
+	t := TrustAnchor{}
+	if err := xml.Unmarshal(xmlBytes, &t); err != nil {
+		return t, err
+	}
+	if len(t.Digests) == 0 {
+		return t, errors.New("no key digests found")
+	}
+	return t, nil
+}
+
+// unboundState finds the RFC 5011 state Unbound writes after the keys of an auto-trust-anchor-file
+var unboundState = regexp.MustCompile(`;\s*;state=(\d+)`)
+
+// ParseRecordAnchor reads DS and DNSKEY records of a zone in zone file format, which is also what Unbound keeps in an
+// auto-trust-anchor-file. DNSKEY records are turned into their SHA-256 digests and only those of KSKs are taken. Of
+// the keys Unbound tracks, only the ones it holds valid or missing are trusted (RFC 5011 section 4).
+func ParseRecordAnchor(text string) (TrustAnchor, error) {
+	t := TrustAnchor{}
+	parser := dns.NewZoneParser(strings.NewReader(text), ".", "")
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		// 2 is VALID and 3 MISSING, the keys in the other states are pending, revoked or removed
+		if state := unboundState.FindStringSubmatch(parser.Comment()); state != nil && state[1] != "2" && state[1] != "3" {
+			continue
+		}
+		if err := t.addRecord(rr); err != nil {
+			return t, err
+		}
+	}
+	if err := parser.Err(); err != nil {
+		return t, err
+	}
+	if len(t.Digests) == 0 {
+		return t, errors.New("no DS or DNSKEY records of a KSK found")
+	}
+	return t, nil
+}
+
+// addRecord adds the digest of a DS record or of the DNSKEY record of a KSK to the anchor. All the records of an
+// anchor have to be for the same zone.
+func (t *TrustAnchor) addRecord(rr dns.RR) error {
+	name := dns.CanonicalName(rr.Header().Name)
+	if t.Zone == "" {
+		t.Zone = name
+	} else if t.ZoneName() != name {
+		return fmt.Errorf("there are trust anchors for %s and %s, only one zone can have one", t.ZoneName(), name)
+	}
+	switch r := rr.(type) {
+	case *dns.DS:
+		t.Digests = append(t.Digests, KeyDigest{KeyTag: r.KeyTag, Algorithm: r.Algorithm, DigestType: r.DigestType, Digest: r.Digest})
+	case *dns.DNSKEY:
+		if r.Flags&dns.SEP == 0 || r.Flags&dns.REVOKE != 0 {
+			return nil
+		}
+		ds := r.ToDS(dns.SHA256)
+		if ds == nil {
+			return fmt.Errorf("unable to compute the digest of DNSKEY %d", r.KeyTag())
+		}
+		t.Digests = append(t.Digests, KeyDigest{KeyTag: ds.KeyTag, Algorithm: ds.Algorithm, DigestType: ds.DigestType, Digest: ds.Digest})
+	default:
+		return fmt.Errorf("%s records cannot be trust anchors, only DS and DNSKEY", dns.TypeToString[rr.Header().Rrtype])
+	}
+	return nil
+}
+
 func ParseAsTrustAnchor(xmlBytes []byte) TrustAnchor {
 	t := TrustAnchor{}
 	err := xml.Unmarshal(xmlBytes, &t)
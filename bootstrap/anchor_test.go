@@ -0,0 +1,303 @@
+package bootstrap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// the KSK of a lab root and its SHA-256 digests at the root and at example.com., the digest covers the owner name
+const (
+	labKey          = "7Y8UCOLjRHw4aPHRWr3Vmq0SQjom1o2gNlp6flvbg/eO4YPSEuHANorzPwoL4n7FGFvMLIRhLiXeVQ07IylDXg=="
+	labTag          = 57247
+	labDigest       = "F0B684F5CCBEC4C953CF2C471CDC16DE8D3FE8A32F3BA2B61D34A9D052453178"
+	labIslandDigest = "BAF8A5D7E6534D2D1926BF9FD792DD18E471C8FDEC9BC8503D751B52E39C145E"
+	labZSK          = "JXZHeSsgRI3CtgFSZspXAxBwVOp9SCmYXVCnRMOYQ1TMSRqDweZGx71EBxUPZz6bF4czV3C0blfU32AOx4qtcw=="
+)
+
+// checkAnchor checks the zone of an anchor and that it holds the digest of the lab KSK at that zone, and only that
+func checkAnchor(t *testing.T, anchor TrustAnchor, zone string) {
+	t.Helper()
+	if anchor.ZoneName() != zone {
+		t.Errorf("the anchor is for %v instead of %v", anchor.ZoneName(), zone)
+	}
+	if len(anchor.Digests) != 1 {
+		t.Fatalf("the anchor has %d digests instead of 1: %+v", len(anchor.Digests), anchor.Digests)
+	}
+	want := labDigest
+	if zone != "." {
+		want = labIslandDigest
+	}
+	digest := anchor.Digests[0]
+	if digest.KeyTag != labTag || digest.Algorithm != 13 || digest.DigestType != 2 || !strings.EqualFold(digest.Digest, want) {
+		t.Errorf("unexpected digest %+v", digest)
+	}
+}
+
+func TestParseBINDAnchor(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		zone string
+		err  string
+	}{
+		{
+			name: "initial-key",
+			text: `trust-anchors { . initial-key 257 3 13 "` + labKey + `"; };`,
+			zone: ".",
+		},
+		{
+			name: "static-key",
+			text: `trust-anchors { . static-key 257 3 13 "` + labKey + `"; };`,
+			zone: ".",
+		},
+		{
+			name: "initial-ds",
+			text: `trust-anchors { . initial-ds 57247 13 2 "` + labDigest + `"; };`,
+			zone: ".",
+		},
+		{
+			name: "static-ds",
+			text: `trust-anchors { . static-ds 57247 13 2 "` + strings.ToLower(labDigest) + `"; };`,
+			zone: ".",
+		},
+		{
+			name: "managed-keys",
+			text: `managed-keys { . initial-key 257 3 13 "` + labKey + `"; };`,
+			zone: ".",
+		},
+		{
+			name: "trusted-keys without a kind and a quoted name",
+			text: `trusted-keys { "example.com." 257 3 13 "` + labKey + `"; };`,
+			zone: "example.com.",
+		},
+		{
+			name: "key split over several lines",
+			text: "trust-anchors {\n\t. initial-key 257 3 13 \"" + labKey[:40] + "\n\t\t" + labKey[40:] + "\";\n};",
+			zone: ".",
+		},
+		{
+			name: "comments",
+			text: "// bind.keys\n# trust-anchors { com. static-ds 1 13 2 \"00\"; };\ntrust-anchors {\n" +
+				"\t/* . static-ds 1 13 2 \"00\"; */\n\t. initial-key 257 3 13 \"" + labKey + "\"; // the lab root\n};",
+			zone: ".",
+		},
+		{
+			name: "other statements are skipped",
+			text: `options { directory "/var/named"; dnssec-validation "{ yes; }"; }; zone "." { type hint; file "root.hints"; };` +
+				"\ntrust-anchors { . initial-key 257 3 13 \"" + labKey + `"; };`,
+			zone: ".",
+		},
+		{
+			name: "zone signing keys are skipped",
+			text: `trust-anchors { . initial-key 256 3 13 "` + labZSK + `"; . initial-key 257 3 13 "` + labKey + `"; };`,
+			zone: ".",
+		},
+		{
+			name: "only a zone signing key",
+			text: `trust-anchors { . initial-key 256 3 13 "` + labZSK + `"; };`,
+			err:  "no DS or DNSKEY of a KSK",
+		},
+		{
+			name: "no trust anchor statement",
+			text: `options { directory "/var/named"; };`,
+			err:  "no DS or DNSKEY of a KSK",
+		},
+		{
+			name: "unknown kind",
+			text: `trust-anchors { . initial-cds 57247 13 2 "` + labDigest + `"; };`,
+			err:  "unknown kind of trust anchor initial-cds",
+		},
+		{
+			name: "missing semicolon",
+			text: `trust-anchors { . initial-ds 57247 13 2 "` + labDigest + `" };`,
+			err:  "does not end with a semicolon",
+		},
+		{
+			name: "missing field",
+			text: `trust-anchors { . initial-ds 57247 13 "` + labDigest + `"; };`,
+			err:  "has 3 fields instead of 4",
+		},
+		{
+			name: "unclosed quote",
+			text: `trust-anchors { . initial-ds 57247 13 2 "` + labDigest + `; };`,
+			err:  "quoted string is not closed",
+		},
+		{
+			name: "unclosed comment",
+			text: `trust-anchors { /* . initial-ds 57247 13 2 "` + labDigest + `"; };`,
+			err:  "comment is not closed",
+		},
+		{
+			name: "anchors for two zones",
+			text: `trust-anchors { . initial-ds 57247 13 2 "` + labDigest + `"; com. initial-ds 57247 13 2 "` + labDigest + `"; };`,
+			err:  "only one zone can have one",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			anchor, err := ParseBINDAnchor(test.text)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected an error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkAnchor(t, anchor, test.zone)
+		})
+	}
+}
+
+func TestParseRecordAnchor(t *testing.T) {
+	// an Unbound auto-trust-anchor-file with the lab KSK in the given RFC 5011 state
+	unbound := func(state string) string {
+		text := "; autotrust trust anchor file\n;;id: . 1\n;;last_queried: 1714561200 ;;Wed May  1 11:00:00 2024\n" +
+			". 86400 IN DNSKEY 257 3 13 " + labKey + " ;{id = 57247 (ksk), size = 256b}"
+		if state != "" {
+			text += " ;;" + state + " ;;count=0 ;;lastchange=1714561200"
+		}
+		return text + "\n"
+	}
+	tests := []struct {
+		name string
+		text string
+		zone string
+		err  string
+	}{
+		{
+			name: "DS",
+			text: ". 172800 IN DS 57247 13 2 " + labDigest,
+			zone: ".",
+		},
+		{
+			name: "DNSKEY",
+			text: ". 172800 IN DNSKEY 257 3 13 " + labKey,
+			zone: ".",
+		},
+		{
+			name: "DNSKEY of an island of security",
+			text: "example.com. 3600 IN DNSKEY 257 3 13 " + labKey,
+			zone: "example.com.",
+		},
+		{
+			name: "zone signing keys are skipped",
+			text: ". 172800 IN DNSKEY 256 3 13 " + labZSK + "\n. 172800 IN DNSKEY 257 3 13 " + labKey,
+			zone: ".",
+		},
+		{
+			name: "revoked keys are skipped",
+			text: ". 172800 IN DNSKEY 385 3 13 " + labZSK + "\n. 172800 IN DNSKEY 257 3 13 " + labKey,
+			zone: ".",
+		},
+		{
+			name: "only a revoked key",
+			text: ". 172800 IN DNSKEY 385 3 13 " + labKey,
+			err:  "no DS or DNSKEY records of a KSK",
+		},
+		{
+			name: "Unbound VALID",
+			text: unbound("state=2 [  VALID  ]"),
+			zone: ".",
+		},
+		{
+			name: "Unbound MISSING",
+			text: unbound("state=3 [ MISSING ]"),
+			zone: ".",
+		},
+		{
+			name: "Unbound without a state",
+			text: unbound(""),
+			zone: ".",
+		},
+		{
+			name: "Unbound ADDPEND",
+			text: unbound("state=1 [ ADDPEND ]"),
+			err:  "no DS or DNSKEY records of a KSK",
+		},
+		{
+			name: "Unbound REVOKED",
+			text: unbound("state=4 [ REVOKED ]"),
+			err:  "no DS or DNSKEY records of a KSK",
+		},
+		{
+			name: "Unbound REMOVED",
+			text: unbound("state=5 [ REMOVED ]"),
+			err:  "no DS or DNSKEY records of a KSK",
+		},
+		{
+			name: "Unbound REVOKED next to a VALID key",
+			text: unbound("state=4 [ REVOKED ]") + ". 86400 IN DS 57247 13 2 " + labDigest + " ;;state=2 [  VALID  ]\n",
+			zone: ".",
+		},
+		{
+			name: "other record types",
+			text: ". 172800 IN DS 57247 13 2 " + labDigest + "\n. 518400 IN NS a.root-servers.net.",
+			err:  "NS records cannot be trust anchors",
+		},
+		{
+			name: "anchors for two zones",
+			text: ". 172800 IN DS 57247 13 2 " + labDigest + "\ncom. 86400 IN DS 57247 13 2 " + labDigest,
+			err:  "only one zone can have one",
+		},
+		{
+			name: "invalid record",
+			text: ". 172800 IN DS 57247 13 SHA-256 " + labDigest,
+			err:  "bad DS",
+		},
+		{
+			name: "empty",
+			text: "; nothing but a comment\n",
+			err:  "no DS or DNSKEY records of a KSK",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			anchor, err := ParseRecordAnchor(test.text)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected an error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkAnchor(t, anchor, test.zone)
+		})
+	}
+}
+
+func TestLoadTrustAnchor(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"xml", `<?xml version="1.0" encoding="UTF-8"?>
+<TrustAnchor id="lab" source="lab"><Zone>.</Zone><KeyDigest id="lab" validFrom="2024-01-01T00:00:00+00:00">` +
+			`<KeyTag>57247</KeyTag><Algorithm>13</Algorithm><DigestType>2</DigestType><Digest>` + labDigest + `</Digest></KeyDigest></TrustAnchor>`},
+		{"bind", "trust-anchors {\n\t. initial-key 257 3 13 \"" + labKey + "\";\n};\n"},
+		{"records", ". 172800 IN DNSKEY 257 3 13 " + labKey + "\n"},
+	}
+	dir := t.TempDir()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, test.name)
+			if err := os.WriteFile(path, []byte(test.text), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			anchor, err := LoadTrustAnchor(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkAnchor(t, anchor, ".")
+		})
+	}
+
+	if _, err := LoadTrustAnchor(filepath.Join(dir, "missing")); err == nil {
+		t.Error("a missing file gives a trust anchor")
+	}
+}
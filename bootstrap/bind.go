@@ -0,0 +1,127 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// bindStatements are the statements of a BIND configuration that hold trust anchors: trust-anchors, and the
+// managed-keys and trusted-keys statements it replaced in BIND 9.15.
+var bindStatements = map[string]bool{"trust-anchors": true, "managed-keys": true, "trusted-keys": true}
+
+var bindStatement = regexp.MustCompile(`(?m)^\s*(trust-anchors|managed-keys|trusted-keys)\s*\{`)
+
+// isBINDAnchor tells a BIND configuration apart from a zone file
+func isBINDAnchor(text string) bool {
+	return bindStatement.MatchString(text)
+}
+
+// ParseBINDAnchor reads the trust anchors in the trust-anchors, managed-keys and trusted-keys statements of a BIND
+// configuration, such as bind.keys, and skips everything else. initial-key and initial-ds anchors are taken as they
+// are, the client does not track them the way BIND does (RFC 5011).
+func ParseBINDAnchor(text string) (TrustAnchor, error) {
+	t := TrustAnchor{}
+	tokens, err := bindTokens(text)
+	if err != nil {
+		return t, err
+	}
+	for i := 0; i < len(tokens); i++ {
+		if !bindStatements[tokens[i]] || i+1 >= len(tokens) || tokens[i+1] != "{" {
+			continue
+		}
+		for i += 2; i < len(tokens) && tokens[i] != "}"; i++ {
+			end := i
+			for end < len(tokens) && tokens[end] != ";" && tokens[end] != "}" {
+				end++
+			}
+			if end == len(tokens) || tokens[end] != ";" {
+				return t, fmt.Errorf("the trust anchor %q does not end with a semicolon", strings.Join(tokens[i:end], " "))
+			}
+			if end > i {
+				rr, err := bindRecord(tokens[i:end])
+				if err != nil {
+					return t, err
+				}
+				if err := t.addRecord(rr); err != nil {
+					return t, err
+				}
+			}
+			i = end
+		}
+	}
+	if len(t.Digests) == 0 {
+		return t, errors.New("no DS or DNSKEY of a KSK found in the trust anchor statements")
+	}
+	return t, nil
+}
+
+// bindRecord turns a trust anchor of BIND, "<name> [<kind>] <flags or key tag> <protocol or algorithm> <algorithm
+// or digest type> <key or digest>", into a DNSKEY or DS record. The kind is missing in trusted-keys.
+func bindRecord(fields []string) (dns.RR, error) {
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid trust anchor %q", strings.Join(fields, " "))
+	}
+	name, kind, rest := fields[0], "static-key", fields[1:]
+	if _, err := strconv.Atoi(rest[0]); err != nil {
+		kind, rest = rest[0], rest[1:]
+	}
+	var rrtype string
+	switch kind {
+	case "initial-key", "static-key":
+		rrtype = "DNSKEY"
+	case "initial-ds", "static-ds":
+		rrtype = "DS"
+	default:
+		return nil, fmt.Errorf("unknown kind of trust anchor %s for %s", kind, name)
+	}
+	if len(rest) != 4 {
+		return nil, fmt.Errorf("the %s trust anchor for %s has %d fields instead of 4", kind, name, len(rest))
+	}
+	// keys and digests are quoted and may be split over several lines
+	data := strings.Join(strings.Fields(rest[3]), "")
+	return dns.NewRR(fmt.Sprintf("%s IN %s %s %s %s %s", dns.Fqdn(name), rrtype, rest[0], rest[1], rest[2], data))
+}
+
+// bindTokens splits a BIND configuration into words, quoted strings without their quotes and the characters
+// '{', '}' and ';'. Comments in the C, C++ and shell styles are left out.
+func bindTokens(text string) ([]string, error) {
+	tokens := make([]string, 0)
+	for i := 0; i < len(text); {
+		switch c := text[i]; {
+		case c == '#' || strings.HasPrefix(text[i:], "//"):
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return nil, errors.New("a comment is not closed")
+			}
+			i += end + 4
+		case c == '"':
+			end := strings.IndexByte(text[i+1:], '"')
+			if end < 0 {
+				return nil, errors.New("a quoted string is not closed")
+			}
+			tokens = append(tokens, text[i+1:i+1+end])
+			i += end + 2
+		case c == '{' || c == '}' || c == ';':
+			tokens = append(tokens, string(c))
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		default:
+			start := i
+			for i < len(text) && !strings.ContainsRune(" \t\r\n{};\"#", rune(text[i])) {
+				i++
+			}
+			tokens = append(tokens, text[start:i])
+		}
+	}
+	return tokens, nil
+}
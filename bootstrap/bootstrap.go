@@ -2,6 +2,7 @@ package bootstrap
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/hex"
@@ -11,6 +12,7 @@ import (
 	"github.com/cloudflare/odoh-client-go/common"
 	"go.mozilla.org/pkcs7"
 	"io"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
@@ -19,77 +21,81 @@ import (
 	"time"
 )
 
-func DownloadFile(urlLocation string, outputFilePath string) {
+func DownloadFile(urlLocation string, outputFilePath string) error {
 	client := http.Client{Timeout: 30 * time.Second}
 
-	f, err := os.Create(outputFilePath)
-	if err != nil {
-		log.Fatalf("unable to create file %v\nError: %v\n", outputFilePath, err)
-	}
-	defer f.Close()
-
 	fmt.Printf("Downloading: %v\n", urlLocation)
 	resp, err := client.Get(urlLocation)
 	if err != nil {
-		log.Fatalf("unable to download the resource from IANA [%v]. %v\n", urlLocation, err)
+		return fmt.Errorf("unable to download the resource from IANA [%v]: %w", urlLocation, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Fatalf("receive invalid response code from server during bootstrap. Try again. [HTTP %v]\n", resp.StatusCode)
+		return fmt.Errorf("receive invalid response code from server during bootstrap. Try again. [HTTP %v]", resp.StatusCode)
 	}
 
-	_, err = io.Copy(f, resp.Body)
+	f, err := os.Create(outputFilePath)
 	if err != nil {
-		log.Fatalf("unable to write output into the corresponding file: %v.Error %v\n", outputFilePath, err)
+		return fmt.Errorf("unable to create file %v: %w", outputFilePath, err)
 	}
-}
+	defer f.Close()
 
-func ReadCheckSum(filePath string) map[string]string {
-	f, err := os.Open(filePath)
+	_, err = io.Copy(f, resp.Body)
 	if err != nil {
-		log.Fatalf("unable to read checksum file at %v.Error: %v\n", filePath, err)
+		return fmt.Errorf("unable to write output into the corresponding file %v: %w", outputFilePath, err)
 	}
-	defer f.Close()
+	return nil
+}
 
-	scanner := bufio.NewScanner(f)
+// ParseCheckSums reads a checksum file as IANA publishes it, one "<sha256 hex>  <file name>" line per file,
+// and returns the checksums by file name.
+func ParseCheckSums(data []byte) (map[string]string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
 	scanner.Split(bufio.ScanLines)
 
 	res := make(map[string]string)
 
 	for scanner.Scan() {
 		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
 		elements := strings.Split(line, common.ChecksumDelimiter)
+		if len(elements) < 2 {
+			return nil, fmt.Errorf("invalid checksum line %q", line)
+		}
 		res[strings.TrimSpace(elements[1])] = strings.TrimSpace(elements[0])
 	}
 
-	return res
+	return res, scanner.Err()
 }
 
-func CheckDownloadIntegrity(filePath string, providedCheckSumHex string) (string, error) {
-	buffer, err := os.ReadFile(filePath)
-	if err != nil {
-		log.Fatalf("unable to open file %v to read. Error: %v\n", filePath, err)
-	}
-
+func CheckDownloadIntegrity(buffer []byte, providedCheckSumHex string) (string, error) {
 	checksum := sha256.Sum256(buffer)
 	computedCheckSumHex := hex.EncodeToString(checksum[:])
 
-	if computedCheckSumHex == providedCheckSumHex {
+	if strings.EqualFold(computedCheckSumHex, providedCheckSumHex) {
 		return computedCheckSumHex, nil
 	}
 	return computedCheckSumHex, errors.New("mismatched checksum")
 }
 
+// CheckAndValidateDNSRootAnchors returns the root anchors in common.DefaultRootAnchorsDir, downloading them from IANA
+// first if they are missing. It exits if they cannot be verified.
 func CheckAndValidateDNSRootAnchors() TrustAnchor {
-	directoryPath := common.RootAnchorsLocation
+	anchor, err := (&IANASource{Dir: common.DefaultRootAnchorsDir()}).TrustAnchor()
+	if err != nil {
+		log.Fatalf("%v\n", err)
+	}
+	return anchor
+}
 
+// downloadRootAnchors fetches the root anchor files that are not in directoryPath yet.
+func downloadRootAnchors(directoryPath string) error {
 	// Create a directory for root anchors if it doesn't exist already.
-	if _, err := os.Stat(directoryPath); errors.Is(err, os.ErrNotExist) {
-		err = os.MkdirAll(directoryPath, os.ModePerm)
-		if err != nil {
-			log.Fatalf("unable to create the directory to bootstrap root anchors: %v.\nError: %v\n", directoryPath, err)
-		}
+	if err := os.MkdirAll(directoryPath, os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create the directory to bootstrap root anchors %v: %w", directoryPath, err)
 	}
 
 	// Check for the filenames existence or fetch them as necessary.
@@ -98,55 +104,89 @@ func CheckAndValidateDNSRootAnchors() TrustAnchor {
 	for fileName, fetchLocation := range rootAnchorsAndLocations {
 		filePath := path.Join(directoryPath, fileName)
 		if _, err := os.Stat(filePath); errors.Is(err, os.ErrNotExist) {
-			DownloadFile(fetchLocation, filePath)
+			if err := DownloadFile(fetchLocation, filePath); err != nil {
+				// do not leave a partial file behind that would be taken for the real one next time
+				os.Remove(filePath)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateRootAnchors checks the root anchor files in fsys against their checksums and the signature
+// ICANN made over the anchors, and returns the anchors.
+func validateRootAnchors(fsys fs.FS) (TrustAnchor, error) {
+	readFile := func(name string) ([]byte, error) {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %v: %w", name, err)
 		}
+		return data, nil
 	}
 
-	// Proceed with verification, previous state mutated to local location information.
 	_integrityTimerStart := time.Now()
-	fileChecksums := ReadCheckSum(path.Join(directoryPath, common.ChecksumFile))
+	checksumBytes, err := readFile(common.ChecksumFile)
+	if err != nil {
+		return TrustAnchor{}, err
+	}
+	fileChecksums, err := ParseCheckSums(checksumBytes)
+	if err != nil {
+		return TrustAnchor{}, fmt.Errorf("unable to read checksum file %v: %w", common.ChecksumFile, err)
+	}
 
 	for fileName, checkSumHexString := range fileChecksums {
-		filePath := path.Join(directoryPath, fileName)
-		computedChecksum, err := CheckDownloadIntegrity(filePath, checkSumHexString)
+		buffer, err := readFile(fileName)
 		if err != nil {
-			log.Fatalf("unable to verify integrity of %v [%v != %v]\n", filePath, checkSumHexString, computedChecksum)
+			return TrustAnchor{}, err
+		}
+		computedChecksum, err := CheckDownloadIntegrity(buffer, checkSumHexString)
+		if err != nil {
+			return TrustAnchor{}, fmt.Errorf("unable to verify integrity of %v [%v != %v]", fileName, checkSumHexString, computedChecksum)
 		}
 	}
 	_integrityTimerEnd := time.Now()
 	log.Printf("\tTime to verify checksum integrity: %v\n", _integrityTimerEnd.Sub(_integrityTimerStart))
 
-	// Downloaded files have the correct integrity, now proceed to verifying the signatures themselves in trust anchors.
+	// Files have the correct integrity, now proceed to verifying the signatures themselves in trust anchors.
 	_signatureVerificationStart := time.Now()
-	certPEMBytes, err := os.ReadFile(path.Join(directoryPath, common.ICANNBundleFile))
+	certPEMBytes, err := readFile(common.ICANNBundleFile)
 	if err != nil {
-		log.Fatalf("unable to read %v file", common.ICANNBundleFile)
+		return TrustAnchor{}, err
 	}
 	certDERBytesBlock, _ := pem.Decode(certPEMBytes)
+	if certDERBytesBlock == nil {
+		return TrustAnchor{}, fmt.Errorf("%v is not a PEM file", common.ICANNBundleFile)
+	}
 	cert, err := x509.ParseCertificate(certDERBytesBlock.Bytes)
+	if err != nil {
+		return TrustAnchor{}, fmt.Errorf("unable to parse the certificate in %v: %w", common.ICANNBundleFile, err)
+	}
 	pool := x509.NewCertPool()
 	pool.AddCert(cert)
 
-	sigBytes, err := os.ReadFile(path.Join(directoryPath, common.RootAnchorSignatureFile))
+	sigBytes, err := readFile(common.RootAnchorSignatureFile)
 	if err != nil {
-		log.Fatalf("unable to read %v file", common.RootAnchorSignatureFile)
+		return TrustAnchor{}, err
 	}
 	p7, err := pkcs7.Parse(sigBytes)
+	if err != nil {
+		return TrustAnchor{}, fmt.Errorf("unable to parse the signature in %v: %w", common.RootAnchorSignatureFile, err)
+	}
 
 	// Retrieve the trust anchor and complete bootstrapping procedure
-	anchorsBytes, err := os.ReadFile(path.Join(directoryPath, common.RootAnchorsFile))
+	anchorsBytes, err := readFile(common.RootAnchorsFile)
 	if err != nil {
-		log.Fatalf("unable to read %v file", common.RootAnchorsFile)
+		return TrustAnchor{}, err
 	}
 
 	p7.Content = anchorsBytes
 	err = p7.VerifyWithChain(pool)
 	if err != nil {
-		log.Fatalf("signature verification of the message failed. Invalid root anchor signatures.")
+		return TrustAnchor{}, errors.New("signature verification of the message failed. Invalid root anchor signatures")
 	}
 	_signatureVerificationEnd := time.Now()
 	log.Printf("\tTime to verify root anchor signatures: %v\n", _signatureVerificationEnd.Sub(_signatureVerificationStart))
 
-	anchor := ParseAsTrustAnchor(anchorsBytes)
-	return anchor
+	return parseXMLAnchor(anchorsBytes)
 }
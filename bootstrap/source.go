@@ -0,0 +1,96 @@
+package bootstrap
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/cloudflare/odoh-client-go/common"
+)
+
+// Names of the trust anchor sources
+const (
+	SourceIANA      = "iana"
+	SourceDirectory = "dir"
+	SourceEmbedded  = "embedded"
+	SourceFile      = "file"
+)
+
+// TrustAnchorSource provides the root trust anchor.
+type TrustAnchorSource interface {
+	TrustAnchor() (TrustAnchor, error)
+}
+
+// IANASource downloads the root anchor files from IANA into Dir if they are not there yet, and verifies them.
+type IANASource struct {
+	Dir string
+}
+
+func (s *IANASource) TrustAnchor() (TrustAnchor, error) {
+	if err := downloadRootAnchors(s.Dir); err != nil {
+		return TrustAnchor{}, err
+	}
+	return validateRootAnchors(os.DirFS(s.Dir))
+}
+
+// DirectorySource verifies the root anchor files IANA publishes in Dir, without network access.
+type DirectorySource struct {
+	Dir string
+}
+
+func (s *DirectorySource) TrustAnchor() (TrustAnchor, error) {
+	if _, err := os.Stat(s.Dir); err != nil {
+		return TrustAnchor{}, fmt.Errorf("no root anchor directory: %w", err)
+	}
+	return validateRootAnchors(os.DirFS(s.Dir))
+}
+
+//go:generate make -C .. refresh-anchors
+//go:embed embedded
+var embeddedAnchors embed.FS
+
+// EmbeddedSource verifies the root anchor files that were embedded in the binary at build time.
+type EmbeddedSource struct{}
+
+func (s *EmbeddedSource) TrustAnchor() (TrustAnchor, error) {
+	fsys, err := fs.Sub(embeddedAnchors, "embedded")
+	if err != nil {
+		return TrustAnchor{}, err
+	}
+	if _, err := fs.Stat(fsys, common.RootAnchorsFile); errors.Is(err, fs.ErrNotExist) {
+		return TrustAnchor{}, errors.New("this client was built without embedded root anchors, run make refresh-anchors before building it or use another anchor source")
+	}
+	return validateRootAnchors(fsys)
+}
+
+// FileSource reads the trust anchor from a file in any of the formats LoadTrustAnchor knows, for the root or for an
+// island of security. Nothing vouches for the file but the user.
+type FileSource struct {
+	Path string
+}
+
+func (s *FileSource) TrustAnchor() (TrustAnchor, error) {
+	return LoadTrustAnchor(s.Path)
+}
+
+// NewTrustAnchorSource returns the source with the given name. dir is the directory of the IANA and directory sources,
+// file the file of the file source.
+func NewTrustAnchorSource(name string, dir string, file string) (TrustAnchorSource, error) {
+	switch name {
+	case SourceIANA:
+		return &IANASource{Dir: dir}, nil
+	case SourceDirectory:
+		return &DirectorySource{Dir: dir}, nil
+	case SourceEmbedded:
+		return &EmbeddedSource{}, nil
+	case SourceFile:
+		if file == "" {
+			return nil, errors.New("the file trust anchor source needs a file")
+		}
+		return &FileSource{Path: file}, nil
+	default:
+		return nil, fmt.Errorf("unknown trust anchor source %v, use %v, %v, %v or %v", name, SourceIANA, SourceDirectory, SourceEmbedded, SourceFile)
+	}
+}
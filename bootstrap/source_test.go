@@ -0,0 +1,78 @@
+package bootstrap
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/odoh-client-go/common"
+)
+
+func TestNewTrustAnchorSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		dir    string
+		file   string
+		want   TrustAnchorSource
+		err    string
+	}{
+		{name: "iana", source: SourceIANA, dir: "anchors", want: &IANASource{Dir: "anchors"}},
+		{name: "directory", source: SourceDirectory, dir: "anchors", want: &DirectorySource{Dir: "anchors"}},
+		{name: "embedded", source: SourceEmbedded, dir: "anchors", want: &EmbeddedSource{}},
+		{name: "file", source: SourceFile, dir: "anchors", file: "root.key", want: &FileSource{Path: "root.key"}},
+		{name: "file without a file", source: SourceFile, dir: "anchors", err: "needs a file"},
+		{name: "unknown", source: "dnssec", dir: "anchors", err: "unknown trust anchor source dnssec"},
+		{name: "empty", source: "", dir: "anchors", err: "unknown trust anchor source"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source, err := NewTrustAnchorSource(test.source, test.dir, test.file)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected an error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(source, test.want) {
+				t.Errorf("got the source %#v instead of %#v", source, test.want)
+			}
+		})
+	}
+}
+
+func TestDirectorySourceMissing(t *testing.T) {
+	source := &DirectorySource{Dir: filepath.Join(t.TempDir(), "missing")}
+	if _, err := source.TrustAnchor(); err == nil || !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected a missing directory error, got %v", err)
+	}
+}
+
+func TestEmbeddedSourceWithoutAnchors(t *testing.T) {
+	if _, err := fs.Stat(embeddedAnchors, "embedded/"+common.RootAnchorsFile); err == nil {
+		t.Skip("the root anchors are embedded")
+	}
+	_, err := (&EmbeddedSource{}).TrustAnchor()
+	if err == nil || !strings.Contains(err.Error(), "make refresh-anchors") {
+		t.Fatalf("expected the built without embedded root anchors error, got %v", err)
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "root.key")
+	if err := os.WriteFile(path, []byte(". 172800 IN DS 57247 13 2 "+labDigest+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	anchor, err := (&FileSource{Path: path}).TrustAnchor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAnchor(t, anchor, ".")
+}
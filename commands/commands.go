@@ -1,7 +1,12 @@
 package commands
 
 import (
+	"time"
+
 	"github.com/cloudflare/odoh-client-go/benchmark"
+	"github.com/cloudflare/odoh-client-go/bootstrap"
+	"github.com/cloudflare/odoh-client-go/common"
+	"github.com/cloudflare/odoh-client-go/verification"
 	"github.com/urfave/cli/v2"
 )
 
@@ -10,7 +15,7 @@ var Commands = []*cli.Command{
 		Name:   "query",
 		Usage:  "An application/dns-message request",
 		Action: SerializedDNSSECQuery,
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:    "domain",
 				Aliases: []string{"d"},
@@ -36,6 +41,118 @@ var Commands = []*cli.Command{
 				Name:  "proxy",
 				Usage: "Hostname of the proxy server to use to send the odoh query to",
 			},
+			&cli.BoolFlag{
+				Name:  "explain",
+				Usage: "Print every step of the DNSSEC verification",
+			},
+			&cli.StringFlag{
+				Name:  "explain-format",
+				Value: "text",
+				Usage: "Format of the verification trace (text|json)",
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Value: "text",
+				Usage: "Output format (text|json), json prints the response, its proof chains and the result as one document",
+			},
+		}, verificationFlags()...),
+	},
+	{
+		Name:   "verify",
+		Usage:  "Verify a captured DNS response offline",
+		Action: VerifyCapturedResponse,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:    "input",
+				Aliases: []string{"i"},
+				Value:   "-",
+				Usage:   "File with the response, - for stdin",
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Value: formatAuto,
+				Usage: "Format of the response (auto|wire|hex|base64|text), text being dig output",
+			},
+			&cli.StringFlag{
+				Name:    "domain",
+				Aliases: []string{"d"},
+				Usage:   "The query name. Without --domain and --dnstype the question of the response is used and the exit code is 4 unless the response is bogus, as it only shows that the response is consistent",
+			},
+			&cli.StringFlag{
+				Name:    "dnstype",
+				Aliases: []string{"p"},
+				Usage:   "The query type. Without --domain and --dnstype the question of the response is used and the exit code is 4 unless the response is bogus, as it only shows that the response is consistent",
+			},
+			&cli.StringFlag{
+				Name:  "anchor",
+				Usage: "Trust anchor file in the XML format of IANA, a BIND trust-anchors statement, an Unbound auto-trust-anchor-file or DS and DNSKEY records in zone file format. The anchor may be for a zone other than the root, an island of security (default: the anchor source, which is not downloaded)",
+			},
+			&cli.TimestampFlag{
+				Name:   "at",
+				Layout: time.RFC3339,
+				Usage:  "Verify the response as of this time, e.g. when it was captured (RFC 3339, default: now)",
+			},
+			&cli.BoolFlag{
+				Name:  "explain",
+				Usage: "Print every step of the DNSSEC verification",
+			},
+			&cli.StringFlag{
+				Name:  "explain-format",
+				Value: "text",
+				Usage: "Format of the verification trace (text|json)",
+			},
+		}, verificationFlags()...),
+	},
+	{
+		Name:   "convert",
+		Usage:  "Convert a DNS message or proof chain between the wire format and text",
+		Action: ConvertMessage,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "input",
+				Aliases: []string{"i"},
+				Value:   "-",
+				Usage:   "File with the message, - for stdin",
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Value:   "-",
+				Usage:   "File to write the converted message to, - for stdout",
+			},
+			&cli.StringFlag{
+				Name:  "from",
+				Value: formatAuto,
+				Usage: "Format of the input (auto|wire|hex|base64|text), text being dig output or a proof chain",
+			},
+			&cli.StringFlag{
+				Name:  "to",
+				Value: formatText,
+				Usage: "Format of the output (text|wire|hex|base64)",
+			},
+		},
+	},
+	{
+		Name:   "inspect",
+		Usage:  "Show where the bytes of the proof chains in a captured response go",
+		Action: InspectResponse,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "input",
+				Aliases: []string{"i"},
+				Value:   "-",
+				Usage:   "File with the response, - for stdin",
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Value: formatAuto,
+				Usage: "Format of the response (auto|wire|hex|base64|text), text being dig output or a proof chain",
+			},
+			&cli.StringFlag{
+				Name:  "output-format",
+				Value: "tree",
+				Usage: "Format of the breakdown (tree|json)",
+			},
 		},
 	},
 	{
@@ -46,7 +163,7 @@ var Commands = []*cli.Command{
 				Name:   "doh",
 				Usage:  "Run benchmarks with DoH queries to the resolver",
 				Action: benchmark.BenchmarkDoHWithDNSSEC,
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:     "resolver",
 						Required: false,
@@ -80,13 +197,13 @@ var Commands = []*cli.Command{
 					&cli.BoolFlag{
 						Name: "dnssec",
 					},
-				},
+				}, append(verificationFlags(), keyCacheFlag())...),
 			},
 			{
 				Name:   "do53",
 				Usage:  "Run benchmark with Do53 queries to the resolver",
 				Action: benchmark.BenchmarkDo53WithDNSSEC,
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:     "input",
 						Aliases:  []string{"i"},
@@ -135,13 +252,13 @@ var Commands = []*cli.Command{
 					&cli.BoolFlag{
 						Name: "trace",
 					},
-				},
+				}, append(verificationFlags(), keyCacheFlag())...),
 			},
 			{
 				Name:   "odoh",
 				Usage:  "Run benchmarks with ODoH queries to the resolver",
 				Action: benchmark.BenchmarkODoHWithDNSSEC,
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:     "input",
 						Aliases:  []string{"i"},
@@ -180,13 +297,13 @@ var Commands = []*cli.Command{
 					&cli.BoolFlag{
 						Name: "dnssec",
 					},
-				},
+				}, verificationFlags()...),
 			},
 			{
 				Name:   "dohot",
 				Usage:  "Run benchmarks with DoH queries over a Tor network",
 				Action: benchmark.BenchmarkDoHoTWithDNSSEC,
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:     "input",
 						Aliases:  []string{"i"},
@@ -225,8 +342,146 @@ var Commands = []*cli.Command{
 					&cli.BoolFlag{
 						Name: "dnssec",
 					},
-				},
+				}, append(verificationFlags(), keyCacheFlag())...),
+			},
+			{
+				Name:   "local",
+				Usage:  "Run benchmarks with proof chains signed locally, to compare signing algorithms",
+				Action: benchmark.BenchmarkLocalChains,
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:     "input",
+						Aliases:  []string{"i"},
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "output",
+						Aliases:  []string{"o"},
+						Value:    "results",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "type",
+						Aliases:  []string{"t"},
+						Value:    "A",
+						Required: false,
+						Usage:    "DNS String Query Type (A|AAAA|TXT)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "algorithms",
+						Value: cli.NewStringSlice("RSASHA256", "ECDSAP256SHA256", "ED25519", "ED448", "Dilithium2", "Dilithium3", "Dilithium5"),
+						Usage: "DNSSEC algorithms, by name or number, or experimental algorithms, the round 3 Dilithium submission and not ML-DSA (Dilithium2|Dilithium3|Dilithium5|Ed25519-Dilithium2|Ed448-Dilithium3) to sign the chains with. Only this benchmark accepts the experimental algorithms",
+					},
+					&cli.IntFlag{
+						Name:  "rsa-bits",
+						Value: verification.DefaultRSAKeyBits,
+						Usage: "The size of the RSA keys the chains are signed with",
+					},
+				}, verificationFlags()...),
 			},
 		},
 	},
 }
+
+// verificationFlags returns the flags that configure how DNSSEC proofs are validated,
+// shared by the query and verify commands and all benchmarks. Every command gets its own copies.
+func verificationFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "clock-skew",
+			Value: verification.DefaultClockSkew,
+			Usage: "How far outside of their validity period RRSIGs are still accepted",
+		},
+		&cli.StringSliceFlag{
+			Name:  "allow-algorithms",
+			Usage: "Only accept these DNSSEC algorithms, by name or number (default: all but the forbidden ones)",
+		},
+		&cli.StringSliceFlag{
+			Name:  "forbid-algorithms",
+			Usage: "DNSSEC algorithms that are never accepted, in addition to RSAMD5, DSA and DSA-NSEC3-SHA1",
+		},
+		&cli.StringSliceFlag{
+			Name:  "allow-digests",
+			Usage: "Only accept these DS digest types, by name or number (default: all but the forbidden ones)",
+		},
+		&cli.StringSliceFlag{
+			Name:  "forbid-digests",
+			Usage: "DS digest types that are never accepted, in addition to GOST R 34.11-94",
+		},
+		&cli.IntFlag{
+			Name:  "min-rsa-bits",
+			Value: verification.DefaultMinRSAKeyBits,
+			Usage: "The smallest RSA key size in bits that is accepted",
+		},
+		&cli.BoolFlag{
+			Name:  "strict",
+			Usage: "Fail the verification if the DO bit was set but the response carries no proof",
+		},
+		&cli.StringFlag{
+			Name:  "anchor-source",
+			Value: bootstrap.SourceIANA,
+			Usage: "Where the root trust anchor comes from: iana downloads it into the anchor directory if it is missing, dir only reads that directory, embedded uses the copy built into the client and file reads the anchor file (iana|dir|embedded|file)",
+		},
+		&cli.StringFlag{
+			Name:  "anchor-dir",
+			Value: common.DefaultRootAnchorsDir(),
+			Usage: "Directory with the root anchor files published by IANA, for the iana and dir anchor sources",
+		},
+		&cli.StringFlag{
+			Name:  "anchor-file",
+			Usage: "Trust anchor file of the file anchor source, in the XML format of IANA, a BIND trust-anchors statement, an Unbound auto-trust-anchor-file or DS and DNSKEY records in zone file format. The anchor may be for a zone other than the root, an island of security",
+		},
+		&cli.StringFlag{
+			Name:  "state-file",
+			Usage: "File remembering the zones seen signed, e.g. signed-zones.json, to detect downgrades (default: no state is kept)",
+		},
+		&cli.StringFlag{
+			Name:  "managed-keys",
+			Usage: "File tracking the root KSKs as RFC 5011 managed keys, e.g. managed-keys.json, to follow root KSK rolls (default: the anchor alone is trusted)",
+		},
+		&cli.DurationFlag{
+			Name:  "add-hold-down",
+			Value: verification.DefaultAddHoldDown,
+			Usage: "How long a new root KSK has to be seen before it is trusted",
+		},
+		&cli.IntFlag{
+			Name:  "max-zones",
+			Value: verification.DefaultMaxZones,
+			Usage: "The most zones a proof may have (0 for no limit)",
+		},
+		&cli.IntFlag{
+			Name:  "max-keys",
+			Value: verification.DefaultMaxKeysPerZone,
+			Usage: "The most DNSKEYs a zone of a proof may have (0 for no limit)",
+		},
+		&cli.IntFlag{
+			Name:  "max-key-tag-collisions",
+			Value: verification.DefaultMaxKeyTagCollisions,
+			Usage: "The most keys with the same key tag that are tried against a signature (0 for no limit)",
+		},
+		&cli.IntFlag{
+			Name:  "max-signature-validations",
+			Value: verification.DefaultMaxSignatureValidations,
+			Usage: "The most signature verifications a proof may cost (0 for no limit)",
+		},
+		&cli.DurationFlag{
+			Name:  "max-validation-time",
+			Value: verification.DefaultMaxValidationTime,
+			Usage: "How long the signature verifications of a proof may take (0 for no limit)",
+		},
+		&cli.IntFlag{
+			Name:  "max-rewrites",
+			Value: verification.DefaultMaxRewrites,
+			Usage: "The longest chain of CNAME and DNAME records followed to the answer (0 for no limit)",
+		},
+	}
+}
+
+// keyCacheFlag returns the flag that turns on the key cache. Only benchmarks that build each query right before
+// sending it get it, a single query or a query encrypted ahead of time has no cached zone to start from.
+func keyCacheFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "key-cache",
+		Usage: "Cache validated DNSKEY sets and ask for proofs that start from the deepest cached zone",
+	}
+}
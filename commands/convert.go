@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+// ConvertMessage converts a DNS message, or a proof chain on its own, between the wire format and text. In text, proof
+// chains are written in a form that reads back to the same records, so they can be edited by hand.
+func ConvertMessage(c *cli.Context) error {
+	inputFile := c.String("input")
+	outputFile := c.String("output")
+	from := c.String("from")
+	to := c.String("to")
+
+	data, err := readInput(inputFile)
+	if err != nil {
+		return fmt.Errorf("unable to read the message: %w", err)
+	}
+	msg, err := readMessage(data, from)
+	if err != nil {
+		return fmt.Errorf("unable to decode the message: %w", err)
+	}
+
+	var out []byte
+	switch to {
+	case formatText:
+		out = []byte(formatMessage(msg))
+	case formatWire, formatHex, formatBase64:
+		packed, err := msg.Pack()
+		if err != nil {
+			return fmt.Errorf("unable to encode the message: %w", err)
+		}
+		switch to {
+		case formatHex:
+			out = []byte(hex.EncodeToString(packed) + "\n")
+		case formatBase64:
+			out = []byte(base64.StdEncoding.EncodeToString(packed) + "\n")
+		default:
+			out = packed
+		}
+	default:
+		return fmt.Errorf("unknown message format %v, use text, wire, hex or base64", to)
+	}
+
+	if outputFile == "-" {
+		_, err = os.Stdout.Write(out)
+	} else {
+		err = os.WriteFile(outputFile, out, 0644)
+	}
+	return err
+}
+
+// readInput reads a file, or stdin for -.
+func readInput(inputFile string) ([]byte, error) {
+	if inputFile == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(inputFile)
+}
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cloudflare/odoh-client-go/verification"
+	"github.com/miekg/dns"
+	"github.com/urfave/cli/v2"
+)
+
+// inspection is the size of a response and of the proof chains it carries
+type inspection struct {
+	Size   int                       `json:"size"`
+	Chains []*verification.ChainSize `json:"chains"`
+}
+
+// InspectResponse shows where the bytes of the proof chains in a captured response go.
+func InspectResponse(c *cli.Context) error {
+	inputFile := c.String("input")
+	format := c.String("format")
+	outputFormat := c.String("output-format")
+	if outputFormat != "tree" && outputFormat != "json" {
+		return fmt.Errorf("unknown output format %v, use tree or json", outputFormat)
+	}
+
+	data, err := readInput(inputFile)
+	if err != nil {
+		return fmt.Errorf("unable to read the response: %w", err)
+	}
+	response, err := readMessage(data, format)
+	if err != nil {
+		return fmt.Errorf("unable to decode the response: %w", err)
+	}
+	packed, err := response.Pack()
+	if err != nil {
+		return fmt.Errorf("unable to encode the response: %w", err)
+	}
+
+	result := inspection{Size: len(packed), Chains: make([]*verification.ChainSize, 0)}
+	for _, section := range [][]dns.RR{response.Answer, response.Ns, response.Extra} {
+		for _, rr := range section {
+			chain, ok := rr.(*dns.Chain)
+			if !ok {
+				continue
+			}
+			size, err := verification.MeasureChain(chain)
+			if err != nil {
+				return fmt.Errorf("unable to measure the proof chain: %w", err)
+			}
+			result.Chains = append(result.Chains, size)
+		}
+	}
+
+	if outputFormat == "json" {
+		out, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", out)
+		return nil
+	}
+	fmt.Print(formatInspection(&result))
+	return nil
+}
+
+// formatInspection draws the sizes as a tree, with the share of each part in the chain.
+func formatInspection(result *inspection) string {
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "Response: %d bytes\n", result.Size)
+	if len(result.Chains) == 0 {
+		b.WriteString("No proof chain\n")
+	}
+	for _, chain := range result.Chains {
+		share := func(n int) string {
+			if chain.Total == 0 {
+				return ""
+			}
+			return fmt.Sprintf(" (%.1f%%)", float64(n)*100/float64(chain.Total))
+		}
+		fmt.Fprintf(&b, "Chain: %d bytes, %d with compressed names, saving %d bytes%s\n", chain.Total,
+			chain.Total-chain.CompressionSavings, chain.CompressionSavings, share(chain.CompressionSavings))
+		fmt.Fprintf(&b, "├── header: %d bytes%s\n", chain.Overhead, share(chain.Overhead))
+		for i, zone := range chain.Zones {
+			branch, indent := "├── ", "│   "
+			if i == len(chain.Zones)-1 {
+				branch, indent = "└── ", "    "
+			}
+			fmt.Fprintf(&b, "%szone %s: %d bytes%s, %d saved by compressing names\n", branch, zone.Name, zone.Total,
+				share(zone.Total), zone.CompressionSavings)
+
+			lines := []string{fmt.Sprintf("zone header: %d bytes%s", zone.Overhead, share(zone.Overhead))}
+			sections := []struct {
+				name string
+				size verification.RecordsSize
+			}{
+				{"DNSKEY", zone.Keys},
+				{"DNSKEY RRSIG", zone.KeySigs},
+				{"DS", zone.DS},
+				{"DS RRSIG", zone.DSSigs},
+				{"leaves", zone.Leaves},
+				{"leaves RRSIG", zone.LeavesSigs},
+			}
+			for _, section := range sections {
+				if section.size.Count == 0 {
+					continue
+				}
+				lines = append(lines, fmt.Sprintf("%s: %d bytes%s in %d %s", section.name, section.size.Bytes,
+					share(section.size.Bytes), section.size.Count, records(section.size.Count)))
+			}
+			for j, line := range lines {
+				if j == len(lines)-1 {
+					b.WriteString(indent + "└── " + line + "\n")
+				} else {
+					b.WriteString(indent + "├── " + line + "\n")
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+func records(n int) string {
+	if n == 1 {
+		return "record"
+	}
+	return "records"
+}
@@ -0,0 +1,281 @@
+package commands
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/odoh-client-go/verification"
+	"github.com/miekg/dns"
+)
+
+// The JSON form of a response is meant for jq and dashboards: fields have fixed names, flags are booleans, and proof
+// chains are decoded down to the key tags of their keys and the validity windows of their signatures.
+
+type jsonMessage struct {
+	ID         uint16         `json:"id"`
+	Opcode     string         `json:"opcode"`
+	Rcode      string         `json:"rcode"`
+	Flags      jsonFlags      `json:"flags"`
+	EDNS       *jsonEDNS      `json:"edns,omitempty"`
+	Question   []jsonQuestion `json:"question"`
+	Answer     []jsonRecord   `json:"answer"`
+	Authority  []jsonRecord   `json:"authority"`
+	Additional []jsonRecord   `json:"additional"`
+}
+
+type jsonFlags struct {
+	QR bool `json:"qr"`
+	AA bool `json:"aa"`
+	TC bool `json:"tc"`
+	RD bool `json:"rd"`
+	RA bool `json:"ra"`
+	Z  bool `json:"z"`
+	AD bool `json:"ad"`
+	CD bool `json:"cd"`
+}
+
+type jsonEDNS struct {
+	Version uint8  `json:"version"`
+	UDPSize uint16 `json:"udpSize"`
+	DO      bool   `json:"do"`
+}
+
+type jsonQuestion struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Class string `json:"class"`
+}
+
+// jsonRecord is a record with its data in presentation format, or decoded for keys, signatures, DS records and chains
+type jsonRecord struct {
+	Name      string         `json:"name"`
+	Type      string         `json:"type"`
+	Class     string         `json:"class"`
+	TTL       uint32         `json:"ttl"`
+	Data      string         `json:"data,omitempty"`
+	Key       *jsonKey       `json:"key,omitempty"`
+	Signature *jsonSignature `json:"signature,omitempty"`
+	DS        *jsonDS        `json:"ds,omitempty"`
+	Chain     *jsonChain     `json:"chain,omitempty"`
+}
+
+type jsonKey struct {
+	Flags     uint16 `json:"flags"`
+	Protocol  uint8  `json:"protocol"`
+	Algorithm string `json:"algorithm"`
+	KeyTag    uint16 `json:"keyTag"`
+	PublicKey string `json:"publicKey"`
+}
+
+type jsonSignature struct {
+	TypeCovered string    `json:"typeCovered"`
+	Algorithm   string    `json:"algorithm"`
+	Labels      uint8     `json:"labels"`
+	OriginalTTL uint32    `json:"originalTtl"`
+	Inception   time.Time `json:"inception"`
+	Expiration  time.Time `json:"expiration"`
+	KeyTag      uint16    `json:"keyTag"`
+	SignerName  string    `json:"signerName"`
+	Signature   string    `json:"signature"`
+}
+
+type jsonDS struct {
+	KeyTag     uint16 `json:"keyTag"`
+	Algorithm  string `json:"algorithm"`
+	DigestType string `json:"digestType"`
+	Digest     string `json:"digest"`
+}
+
+type jsonChain struct {
+	Version       uint8      `json:"version"`
+	InitialKeyTag uint16     `json:"initialKeyTag"`
+	Zones         []jsonZone `json:"zones"`
+}
+
+type jsonZone struct {
+	Name         string       `json:"name"`
+	PreviousName string       `json:"previousName"`
+	ZSKIndex     uint8        `json:"zskIndex"`
+	Keys         []jsonRecord `json:"keys"`
+	KeySigs      []jsonRecord `json:"keySigs"`
+	DS           []jsonRecord `json:"ds"`
+	DSSigs       []jsonRecord `json:"dsSigs"`
+	Leaves       []jsonRecord `json:"leaves"`
+	LeavesSigs   []jsonRecord `json:"leavesSigs"`
+}
+
+type jsonResult struct {
+	Status          string              `json:"status"`
+	Reason          verification.Reason `json:"reason"`
+	Zone            string              `json:"zone,omitempty"`
+	Error           string              `json:"error,omitempty"`
+	Denial          *jsonDenial         `json:"denial,omitempty"`
+	Validated       [][]jsonRecord      `json:"validated"`
+	Unauthenticated []jsonRecord        `json:"unauthenticated"`
+	Proofs          []*jsonResult       `json:"proofs,omitempty"`
+	Trace           *verification.Trace `json:"trace,omitempty"`
+}
+
+type jsonDenial struct {
+	Kind              string `json:"kind"`
+	Zone              string `json:"zone"`
+	ClosestEncloser   string `json:"closestEncloser,omitempty"`
+	Delegation        string `json:"delegation,omitempty"`
+	MinimallyCovering bool   `json:"minimallyCovering"`
+}
+
+func messageJSON(msg *dns.Msg) *jsonMessage {
+	m := &jsonMessage{
+		ID:     msg.Id,
+		Opcode: dns.OpcodeToString[msg.Opcode],
+		Rcode:  dns.RcodeToString[msg.Rcode],
+		Flags: jsonFlags{
+			QR: msg.Response, AA: msg.Authoritative, TC: msg.Truncated, RD: msg.RecursionDesired,
+			RA: msg.RecursionAvailable, Z: msg.Zero, AD: msg.AuthenticatedData, CD: msg.CheckingDisabled,
+		},
+		Question:   make([]jsonQuestion, 0, len(msg.Question)),
+		Answer:     recordsJSON(msg.Answer),
+		Authority:  recordsJSON(msg.Ns),
+		Additional: recordsJSON(msg.Extra),
+	}
+	if opt := msg.IsEdns0(); opt != nil {
+		m.EDNS = &jsonEDNS{Version: opt.Version(), UDPSize: opt.UDPSize(), DO: opt.Do()}
+	}
+	for _, q := range msg.Question {
+		m.Question = append(m.Question, jsonQuestion{Name: q.Name, Type: typeString(q.Qtype), Class: dns.Class(q.Qclass).String()})
+	}
+	return m
+}
+
+func typeString(t uint16) string {
+	return dns.Type(t).String()
+}
+
+// algorithmString names the algorithm of a key or signature, experimental ones by the name their data starts with
+func algorithmString(algorithm uint8, data string) string {
+	if algorithm == dns.PRIVATEDNS {
+		if b, err := base64.StdEncoding.DecodeString(data); err == nil {
+			if alg, _, err := verification.ParseExperimental(b); err == nil {
+				return alg.Name
+			}
+		}
+	}
+	if name, ok := dns.AlgorithmToString[algorithm]; ok {
+		return name
+	}
+	return strconv.Itoa(int(algorithm))
+}
+
+// recordsJSON leaves out the OPT record, its contents are in the EDNS field of the message
+func recordsJSON(rrs []dns.RR) []jsonRecord {
+	records := make([]jsonRecord, 0, len(rrs))
+	for _, rr := range rrs {
+		if rr == nil || rr.Header().Rrtype == dns.TypeOPT {
+			continue
+		}
+		records = append(records, recordJSON(rr))
+	}
+	return records
+}
+
+func recordJSON(rr dns.RR) jsonRecord {
+	h := rr.Header()
+	r := jsonRecord{Name: h.Name, Type: typeString(h.Rrtype), Class: dns.Class(h.Class).String(), TTL: h.Ttl}
+	switch t := rr.(type) {
+	case *dns.DNSKEY:
+		r.Key = &jsonKey{
+			Flags: t.Flags, Protocol: t.Protocol, Algorithm: algorithmString(t.Algorithm, t.PublicKey),
+			KeyTag: t.KeyTag(), PublicKey: t.PublicKey,
+		}
+	case *dns.RRSIG:
+		r.Signature = &jsonSignature{
+			TypeCovered: typeString(t.TypeCovered), Algorithm: algorithmString(t.Algorithm, t.Signature),
+			Labels: t.Labels, OriginalTTL: t.OrigTtl,
+			Inception: signatureTime(t.Inception), Expiration: signatureTime(t.Expiration),
+			KeyTag: t.KeyTag, SignerName: t.SignerName, Signature: t.Signature,
+		}
+	case *dns.DS:
+		r.DS = &jsonDS{
+			KeyTag: t.KeyTag, Algorithm: algorithmString(t.Algorithm, ""),
+			DigestType: dns.HashToString[t.DigestType], Digest: t.Digest,
+		}
+	case *dns.Chain:
+		r.Chain = chainJSON(t)
+	default:
+		r.Data = strings.TrimPrefix(rr.String(), h.String())
+	}
+	return r
+}
+
+// signatureTime is the time of an RRSIG inception or expiration. These are serial numbers (RFC 4034 section 3.1.5),
+// they are read the way miekg/dns prints them.
+func signatureTime(t uint32) time.Time {
+	ts, err := time.Parse("20060102150405", dns.TimeToString(t))
+	if err != nil {
+		return time.Unix(int64(t), 0).UTC()
+	}
+	return ts
+}
+
+func chainJSON(chain *dns.Chain) *jsonChain {
+	c := &jsonChain{Version: chain.Version, InitialKeyTag: chain.InitialKeyTag, Zones: make([]jsonZone, 0, len(chain.Zones))}
+	for i := range chain.Zones {
+		zone := &chain.Zones[i]
+		z := jsonZone{
+			Name:         zone.Name.String(),
+			PreviousName: zone.PreviousName.String(),
+			ZSKIndex:     zone.ZSKIndex,
+			Keys:         make([]jsonRecord, 0, len(zone.Keys)),
+			KeySigs:      signaturesJSON(zone.KeySigs),
+			DS:           make([]jsonRecord, 0, len(zone.DSSet)),
+			DSSigs:       signaturesJSON(zone.DSSigs),
+			Leaves:       recordsJSON(zone.Leaves),
+			LeavesSigs:   signaturesJSON(zone.LeavesSigs),
+		}
+		for j := range zone.Keys {
+			z.Keys = append(z.Keys, recordJSON(&zone.Keys[j]))
+		}
+		for j := range zone.DSSet {
+			z.DS = append(z.DS, recordJSON(&zone.DSSet[j]))
+		}
+		c.Zones = append(c.Zones, z)
+	}
+	return c
+}
+
+func signaturesJSON(sigs []dns.RRSIG) []jsonRecord {
+	records := make([]jsonRecord, 0, len(sigs))
+	for i := range sigs {
+		records = append(records, recordJSON(&sigs[i]))
+	}
+	return records
+}
+
+func resultJSON(result *verification.Result) *jsonResult {
+	r := &jsonResult{
+		Status:          result.Status.String(),
+		Reason:          result.Reason,
+		Zone:            result.Zone,
+		Validated:       make([][]jsonRecord, 0, len(result.ValidatedRRsets)),
+		Unauthenticated: recordsJSON(result.Unauthenticated),
+		Trace:           result.Trace,
+	}
+	if result.Err != nil {
+		r.Error = result.Err.Error()
+	}
+	if d := result.Denial; d != nil {
+		r.Denial = &jsonDenial{
+			Kind: d.Kind.String(), Zone: d.Zone, ClosestEncloser: d.ClosestEncloser,
+			Delegation: d.Delegation, MinimallyCovering: d.MinimallyCovering,
+		}
+	}
+	for _, rrset := range result.ValidatedRRsets {
+		r.Validated = append(r.Validated, recordsJSON(rrset))
+	}
+	for _, proof := range result.Proofs {
+		r.Proofs = append(r.Proofs, resultJSON(proof))
+	}
+	return r
+}
@@ -0,0 +1,442 @@
+package commands
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cloudflare/odoh-client-go/verification"
+	"github.com/miekg/dns"
+)
+
+// Formats a captured DNS message can be read in
+const (
+	formatAuto   = "auto"
+	formatWire   = "wire"
+	formatHex    = "hex"
+	formatBase64 = "base64"
+	formatText   = "text"
+)
+
+// readMessage decodes a DNS message in the given format. In the auto format, binary data is taken as wire format and
+// text is tried as hex, base64 (with either alphabet, as in DoH GET requests) and then as dig prints messages.
+func readMessage(data []byte, format string) (*dns.Msg, error) {
+	switch format {
+	case formatWire:
+		return unpackMessage(data)
+	case formatHex:
+		return decodeHex(data)
+	case formatBase64:
+		return decodeBase64(data)
+	case formatText:
+		return parseDig(string(data))
+	case formatAuto:
+	default:
+		return nil, fmt.Errorf("unknown message format %v, use auto, wire, hex, base64 or text", format)
+	}
+
+	if !isText(data) {
+		return unpackMessage(data)
+	}
+	if msg, err := decodeHex(data); err == nil {
+		return msg, nil
+	}
+	if msg, err := decodeBase64(data); err == nil {
+		return msg, nil
+	}
+	msg, err := parseDig(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("the input is neither a DNS message in wire format, hex or base64, nor dig output: %w", err)
+	}
+	return msg, nil
+}
+
+func isText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func unpackMessage(data []byte) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	if err := msg.Unpack(data); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func withoutSpaces(data []byte) string {
+	return strings.Join(strings.Fields(string(data)), "")
+}
+
+func decodeHex(data []byte) (*dns.Msg, error) {
+	wire, err := hex.DecodeString(withoutSpaces(data))
+	if err != nil {
+		return nil, err
+	}
+	return unpackMessage(wire)
+}
+
+func decodeBase64(data []byte) (*dns.Msg, error) {
+	text := withoutSpaces(data)
+	var err error
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		var wire []byte
+		if wire, err = encoding.DecodeString(text); err == nil {
+			return unpackMessage(wire)
+		}
+	}
+	return nil, err
+}
+
+// firstField returns the first whitespace separated field of line, or "" if it has none.
+func firstField(line string) string {
+	if fields := strings.Fields(line); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// parseDig reads a message as dig prints it: the header, flags and EDNS options from the comments
+// and the records of each section.
+func parseDig(text string) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	var section *[]dns.RR
+	inQuestion := false
+	seen := false
+	// the lines of a proof chain in text form, from $CHAIN to $END
+	var chainLines []string
+	for _, line := range logicalLines(text) {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case chainLines != nil:
+			chainLines = append(chainLines, line)
+			if strings.EqualFold(firstField(trimmed), "$END") {
+				chain, err := verification.ParseChain(strings.Join(chainLines, "\n"))
+				if err != nil {
+					return nil, err
+				}
+				if section == nil {
+					// a chain on its own is taken as a message that only carries it
+					section, seen = &msg.Extra, true
+				}
+				*section = append(*section, chain)
+				chainLines = nil
+			}
+		case strings.EqualFold(firstField(trimmed), "$CHAIN"):
+			chainLines = []string{line}
+		case trimmed == "":
+			continue
+		case strings.HasPrefix(trimmed, ";"):
+			comment := strings.TrimSpace(strings.TrimLeft(trimmed, ";"))
+			if strings.HasSuffix(comment, "SECTION:") {
+				inQuestion, section = false, nil
+				switch comment {
+				case "QUESTION SECTION:":
+					inQuestion = true
+				case "ANSWER SECTION:":
+					section = &msg.Answer
+				case "AUTHORITY SECTION:":
+					section = &msg.Ns
+				case "ADDITIONAL SECTION:":
+					section = &msg.Extra
+				}
+				seen = true
+				continue
+			}
+			if inQuestion && comment != "" {
+				q, err := parseDigQuestion(comment)
+				if err != nil {
+					return nil, err
+				}
+				msg.Question = append(msg.Question, q)
+				continue
+			}
+			if err := parseDigHeader(msg, comment); err != nil {
+				return nil, err
+			}
+		case section != nil:
+			rr, err := parseDigRR(trimmed)
+			if err != nil {
+				return nil, err
+			}
+			*section = append(*section, rr)
+		}
+	}
+	if chainLines != nil {
+		return nil, errors.New("a proof chain is missing its $END")
+	}
+	if !seen {
+		return nil, errors.New("no sections found")
+	}
+	// the OPT record comes after the additional records, as in the messages dig and miekg/dns send
+	if opt := msg.IsEdns0(); opt != nil {
+		extra := make([]dns.RR, 0, len(msg.Extra))
+		for _, rr := range msg.Extra {
+			if rr != opt {
+				extra = append(extra, rr)
+			}
+		}
+		msg.Extra = append(extra, opt)
+	}
+	return msg, nil
+}
+
+// formatMessage prints a message as miekg/dns does, except for proof chains, which are printed in the text form
+// parseDig reads back.
+func formatMessage(msg *dns.Msg) string {
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "%v QUERY: %d, ANSWER: %d, AUTHORITY: %d, ADDITIONAL: %d\n", &msg.MsgHdr, len(msg.Question), len(msg.Answer), len(msg.Ns), len(msg.Extra))
+	opt := msg.IsEdns0()
+	if opt != nil {
+		b.WriteString(opt.String() + "\n")
+	}
+	if len(msg.Question) > 0 {
+		b.WriteString("\n;; QUESTION SECTION:\n")
+		for _, q := range msg.Question {
+			b.WriteString(q.String() + "\n")
+		}
+	}
+	section := func(title string, rrs []dns.RR) {
+		printed := false
+		for _, rr := range rrs {
+			if rr == nil || rr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+			if !printed {
+				b.WriteString("\n;; " + title + " SECTION:\n")
+				printed = true
+			}
+			if chain, ok := rr.(*dns.Chain); ok {
+				b.WriteString(verification.FormatChain(chain))
+			} else {
+				b.WriteString(rr.String() + "\n")
+			}
+		}
+	}
+	section("ANSWER", msg.Answer)
+	section("AUTHORITY", msg.Ns)
+	section("ADDITIONAL", msg.Extra)
+	return b.String()
+}
+
+// logicalLines splits zone file text into lines, joining records that span lines in parentheses. Comment
+// lines are kept, comments after records are dropped.
+func logicalLines(text string) []string {
+	lines := make([]string, 0)
+	current := strings.Builder{}
+	depth := 0
+	for _, line := range strings.Split(text, "\n") {
+		if depth == 0 && strings.HasPrefix(strings.TrimSpace(line), ";") {
+			lines = append(lines, line)
+			continue
+		}
+		quoted, escaped := false, false
+	chars:
+		for _, r := range line {
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\':
+				escaped = true
+			case r == '"':
+				quoted = !quoted
+			case quoted:
+			case r == ';':
+				break chars
+			case r == '(':
+				depth++
+				r = ' '
+			case r == ')':
+				depth--
+				r = ' '
+			}
+			current.WriteRune(r)
+		}
+		if depth > 0 {
+			current.WriteString(" ")
+			continue
+		}
+		lines = append(lines, current.String())
+		current.Reset()
+		depth = 0
+	}
+	if current.Len() > 0 {
+		lines = append(lines, current.String())
+	}
+	return lines
+}
+
+// parseDigHeader reads the opcode, status, id, flags and EDNS information dig prints as comments.
+func parseDigHeader(msg *dns.Msg, comment string) error {
+	switch {
+	case strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(comment, "->>HEADER<<-")), "opcode:"):
+		// dig starts the line with ->>HEADER<<-, miekg/dns does not
+		for _, field := range strings.Split(strings.TrimPrefix(comment, "->>HEADER<<-"), ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(field), ":")
+			value = strings.TrimSpace(value)
+			switch key {
+			case "opcode":
+				opcode, ok := dns.StringToOpcode[value]
+				if !ok {
+					return fmt.Errorf("unknown opcode %v", value)
+				}
+				msg.Opcode = opcode
+			case "status":
+				rcode, ok := dns.StringToRcode[value]
+				if !ok {
+					return fmt.Errorf("unknown status %v", value)
+				}
+				msg.Rcode = rcode
+			case "id":
+				id, err := strconv.ParseUint(value, 10, 16)
+				if err != nil {
+					return fmt.Errorf("invalid message id %v", value)
+				}
+				msg.Id = uint16(id)
+			}
+		}
+	case strings.HasPrefix(comment, "flags:"):
+		flags, _, _ := strings.Cut(strings.TrimPrefix(comment, "flags:"), ";")
+		for _, flag := range strings.Fields(flags) {
+			switch flag {
+			case "qr":
+				msg.Response = true
+			case "aa":
+				msg.Authoritative = true
+			case "tc":
+				msg.Truncated = true
+			case "rd":
+				msg.RecursionDesired = true
+			case "ra":
+				msg.RecursionAvailable = true
+			case "ad":
+				msg.AuthenticatedData = true
+			case "cd":
+				msg.CheckingDisabled = true
+			}
+		}
+	case strings.HasPrefix(comment, "EDNS:"):
+		// EDNS: version: 0, flags: do; udp: 1232
+		udpSize, do := uint16(dns.DefaultMsgSize), false
+		for _, part := range strings.Split(strings.TrimPrefix(comment, "EDNS:"), ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(part), ":")
+			switch strings.TrimSpace(key) {
+			case "udp":
+				size, err := strconv.ParseUint(strings.TrimSpace(value), 10, 16)
+				if err != nil {
+					return fmt.Errorf("invalid EDNS UDP size %v", value)
+				}
+				udpSize = uint16(size)
+			default:
+				for _, field := range strings.Split(part, ",") {
+					if key, value, _ := strings.Cut(strings.TrimSpace(field), ":"); key == "flags" {
+						do = do || strings.Contains(" "+value+" ", " do ")
+					}
+				}
+			}
+		}
+		msg.SetEdns0(udpSize, do)
+	}
+	return nil
+}
+
+// parseDigQuestion reads a question line of dig, "name class type" after the comment character.
+func parseDigQuestion(line string) (dns.Question, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return dns.Question{}, fmt.Errorf("invalid question %q", line)
+	}
+	class, ok := parseClass(fields[1])
+	if !ok {
+		return dns.Question{}, fmt.Errorf("unknown class in question %q", line)
+	}
+	qtype, ok := parseType(fields[2])
+	if !ok {
+		return dns.Question{}, fmt.Errorf("unknown type in question %q", line)
+	}
+	return dns.Question{Name: dns.Fqdn(fields[0]), Qtype: qtype, Qclass: class}, nil
+}
+
+// parseDigRR reads a record. Records in the generic format of RFC 3597 are decoded here, because the proof
+// records dig does not know are longer than the zone file parser of miekg/dns accepts.
+func parseDigRR(line string) (dns.RR, error) {
+	fields := strings.Fields(line)
+	generic := -1
+	for i, field := range fields {
+		if field == `\#` {
+			generic = i
+			break
+		}
+	}
+	if generic < 2 || generic+1 >= len(fields) {
+		rr, err := dns.NewRR(line)
+		if err != nil {
+			return nil, err
+		}
+		if rr == nil {
+			return nil, fmt.Errorf("no record in %q", line)
+		}
+		return rr, nil
+	}
+
+	hdr := dns.RR_Header{Name: dns.Fqdn(fields[0]), Class: dns.ClassINET}
+	rrtype, ok := parseType(fields[generic-1])
+	if !ok {
+		return nil, fmt.Errorf("unknown type in %q", line)
+	}
+	hdr.Rrtype = rrtype
+	for _, field := range fields[1 : generic-1] {
+		if class, ok := parseClass(field); ok {
+			hdr.Class = class
+		} else if ttl, err := strconv.ParseUint(field, 10, 32); err == nil {
+			hdr.Ttl = uint32(ttl)
+		} else {
+			return nil, fmt.Errorf("unexpected %q in %q", field, line)
+		}
+	}
+	length, err := strconv.Atoi(fields[generic+1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid RDATA length in %q", line)
+	}
+	rdata, err := hex.DecodeString(strings.Join(fields[generic+2:], ""))
+	if err != nil || len(rdata) != length {
+		return nil, fmt.Errorf("invalid RDATA in %q", line)
+	}
+	hdr.Rdlength = uint16(length)
+	rr, _, err := dns.UnpackRRWithHeader(hdr, rdata, 0)
+	return rr, err
+}
+
+// parseClass reads a class mnemonic or the generic CLASSn form.
+func parseClass(s string) (uint16, bool) {
+	if class, ok := dns.StringToClass[strings.ToUpper(s)]; ok {
+		return class, true
+	}
+	if n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(s), "CLASS"), 10, 16); err == nil && strings.HasPrefix(strings.ToUpper(s), "CLASS") {
+		return uint16(n), true
+	}
+	return 0, false
+}
+
+// parseType reads a type mnemonic or the generic TYPEn form.
+func parseType(s string) (uint16, bool) {
+	if rrtype, ok := dns.StringToType[strings.ToUpper(s)]; ok {
+		return rrtype, true
+	}
+	if n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(s), "TYPE"), 10, 16); err == nil && strings.HasPrefix(strings.ToUpper(s), "TYPE") {
+		return uint16(n), true
+	}
+	return 0, false
+}
@@ -1,8 +1,9 @@
 package commands
 
 import (
+	"encoding/json"
 	"fmt"
-	"github.com/cloudflare/odoh-client-go/bootstrap"
+	"github.com/cloudflare/odoh-client-go/benchmark"
 	"github.com/cloudflare/odoh-client-go/common"
 	"github.com/cloudflare/odoh-client-go/network"
 	"github.com/cloudflare/odoh-client-go/verification"
@@ -14,6 +15,18 @@ import (
 	"time"
 )
 
+// queryOutput is what the query command prints with --format json
+type queryOutput struct {
+	Response           *jsonMessage `json:"response"`
+	Result             *jsonResult  `json:"result"`
+	NetworkTimeMs      float64      `json:"networkTimeMs"`
+	VerificationTimeMs float64      `json:"verificationTimeMs"`
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
 func SerializedDNSSECQuery(c *cli.Context) error {
 	domainNameString := dns.Fqdn(c.String("domain"))
 	dnsTypeString := c.String("dnstype")
@@ -21,10 +34,26 @@ func SerializedDNSSECQuery(c *cli.Context) error {
 	dnssec := c.Bool("dnssec")
 	useODoH := c.Bool("odoh")
 	proxyHostname := c.String("proxy")
+	verificationOptions, err := benchmark.VerificationOptions(c)
+	if err != nil {
+		return err
+	}
+	verificationOptions.Explain = c.Bool("explain")
+	explainFormat := c.String("explain-format")
+	if explainFormat != "text" && explainFormat != "json" {
+		return fmt.Errorf("unknown explain format %v, use text or json", explainFormat)
+	}
+	outputFormat := c.String("format")
+	if outputFormat != "text" && outputFormat != "json" {
+		return fmt.Errorf("unknown format %v, use text or json", outputFormat)
+	}
 
 	dnsType := common.DnsQueryStringToType(dnsTypeString)
 
-	anchor := bootstrap.CheckAndValidateDNSRootAnchors()
+	anchor, err := benchmark.TrustAnchor(c)
+	if err != nil {
+		return err
+	}
 
 	domainName, _ := idna.ToASCII(domainNameString)
 
@@ -45,7 +74,9 @@ func SerializedDNSSECQuery(c *cli.Context) error {
 	var proxyURL *url.URL
 
 	if useODoH {
-		fmt.Printf("Retriveing ODoH Target configuration ...\n")
+		if outputFormat == "text" {
+			fmt.Printf("Retriveing ODoH Target configuration ...\n")
+		}
 		odohTargetConfig := network.RetrieveODoHConfig(dnsTargetServer)
 
 		if proxyHostname != "" {
@@ -79,21 +110,43 @@ func SerializedDNSSECQuery(c *cli.Context) error {
 
 	end := time.Now()
 
-	fmt.Printf("%v\n", response)
+	if outputFormat == "json" {
+		vStart := time.Now()
+		result := verification.ValidateDNSSECSignature(response, domainName, dnsType, &anchor, verificationOptions)
+		vEnd := time.Now()
+		benchmark.SaveVerificationState(verificationOptions, &anchor)
+		out, err := json.MarshalIndent(queryOutput{
+			Response:           messageJSON(response),
+			Result:             resultJSON(result),
+			NetworkTimeMs:      milliseconds(end.Sub(start)),
+			VerificationTimeMs: milliseconds(vEnd.Sub(vStart)),
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", out)
+		return nil
+	}
+
+	fmt.Print(formatMessage(response))
 
 	vStart := time.Now()
-	ok, err := verification.ValidateDNSSECSignature(response, domainName, &anchor)
-	if ok {
+	result := verification.ValidateDNSSECSignature(response, domainName, dnsType, &anchor, verificationOptions)
+	switch result.Status {
+	case verification.Secure:
 		fmt.Printf("%v Verified DNSSEC Chain successfully. %v\n", "\033[32m", "\033[0m")
-	} else {
-		if err != nil {
-			fmt.Printf("%v Failed DNSSEC Verification. %v\n", "\033[31m", "\033[0m")
-			fmt.Printf("Error: %v\n", err)
-		} else {
-			fmt.Printf("%v Domain is not DNSSEC Enabled. %v\n", "\033[33m", "\033[0m")
-		}
+	case verification.Insecure:
+		fmt.Printf("%v Domain is provably not DNSSEC Enabled. %v\n", "\033[33m", "\033[0m")
+	case verification.Bogus:
+		fmt.Printf("%v Failed DNSSEC Verification. %v\n", "\033[31m", "\033[0m")
+	default:
+		fmt.Printf("%v Domain is not DNSSEC Enabled. %v\n", "\033[33m", "\033[0m")
+	}
+	if err := printResult(result, explainFormat); err != nil {
+		return err
 	}
 	vEnd := time.Now()
+	benchmark.SaveVerificationState(verificationOptions, &anchor)
 	fmt.Printf("Network Time: %v\n", end.Sub(start).String())
 	fmt.Printf("Verification Time: %v\n", vEnd.Sub(vStart).String())
 
@@ -0,0 +1,158 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cloudflare/odoh-client-go/benchmark"
+	"github.com/cloudflare/odoh-client-go/bootstrap"
+	"github.com/cloudflare/odoh-client-go/common"
+	"github.com/cloudflare/odoh-client-go/verification"
+	"github.com/miekg/dns"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/net/idna"
+)
+
+// Exit codes of the verify command. Errors reading the input exit with 1, like every other command.
+const (
+	exitSecure        = 0
+	exitBogus         = 2
+	exitInsecure      = 3
+	exitIndeterminate = 4
+)
+
+// exitCode maps the status of a result to the exit code of the verify command
+func exitCode(status verification.Status) int {
+	switch status {
+	case verification.Secure:
+		return exitSecure
+	case verification.Bogus:
+		return exitBogus
+	case verification.Insecure:
+		return exitInsecure
+	default:
+		return exitIndeterminate
+	}
+}
+
+// VerifyCapturedResponse validates a response that was captured earlier, without network access.
+func VerifyCapturedResponse(c *cli.Context) error {
+	inputFile := c.String("input")
+	format := c.String("format")
+	anchorFile := c.String("anchor")
+	explainFormat := c.String("explain-format")
+	if explainFormat != "text" && explainFormat != "json" {
+		return fmt.Errorf("unknown explain format %v, use text or json", explainFormat)
+	}
+
+	data, err := readInput(inputFile)
+	if err != nil {
+		return fmt.Errorf("unable to read the response: %w", err)
+	}
+	response, err := readMessage(data, format)
+	if err != nil {
+		return fmt.Errorf("unable to decode the response: %w", err)
+	}
+
+	// The question defaults to the one of the response. The response is then only checked against itself,
+	// nothing shows that it answers what was asked.
+	questionGiven := c.IsSet("domain") && c.IsSet("dnstype")
+	domainName, dnsType := "", uint16(0)
+	if len(response.Question) > 0 {
+		domainName, dnsType = response.Question[0].Name, response.Question[0].Qtype
+	}
+	if c.IsSet("domain") {
+		if domainName, err = idna.ToASCII(dns.Fqdn(c.String("domain"))); err != nil {
+			return err
+		}
+	}
+	if c.IsSet("dnstype") {
+		dnsType = common.DnsQueryStringToType(c.String("dnstype"))
+	}
+	if domainName == "" || dnsType == 0 {
+		return fmt.Errorf("the response has no question, set --domain and --dnstype")
+	}
+
+	anchor, err := verifyTrustAnchor(c, anchorFile)
+	if err != nil {
+		return err
+	}
+
+	verificationOptions, err := benchmark.VerificationOptions(c)
+	if err != nil {
+		return err
+	}
+	verificationOptions.Explain = c.Bool("explain")
+	// a response with the DO bit answers a query that asked for a proof
+	if opt := response.IsEdns0(); opt != nil && opt.Do() {
+		verificationOptions.ProofRequested = true
+	}
+	if at := c.Timestamp("at"); at != nil {
+		asOf := *at
+		verificationOptions.Now = func() time.Time { return asOf }
+	}
+
+	result := verification.ValidateDNSSECSignature(response, domainName, dnsType, &anchor, verificationOptions)
+	fmt.Printf("%v/%v: %v\n", domainName, dns.TypeToString[dnsType], result.Status)
+	if err := printResult(result, explainFormat); err != nil {
+		return err
+	}
+	code := exitCode(result.Status)
+	if !questionGiven && code != exitBogus {
+		log.Printf("warning: no --domain and --dnstype given, the response was verified against its own question %v/%v\n", domainName, dns.TypeToString[dnsType])
+		code = exitIndeterminate
+	}
+	if code != exitSecure {
+		return cli.Exit("", code)
+	}
+	return nil
+}
+
+// verifyTrustAnchor loads the anchor file if one is given, or else the anchor from the anchor source. Verifying is
+// offline, the root anchors are read from the anchor directory instead of being downloaded into it.
+func verifyTrustAnchor(c *cli.Context, anchorFile string) (bootstrap.TrustAnchor, error) {
+	if anchorFile != "" {
+		return bootstrap.LoadTrustAnchor(anchorFile)
+	}
+	sourceName := c.String("anchor-source")
+	if sourceName == bootstrap.SourceIANA {
+		sourceName = bootstrap.SourceDirectory
+	}
+	source, err := bootstrap.NewTrustAnchorSource(sourceName, c.String("anchor-dir"), c.String("anchor-file"))
+	if err != nil {
+		return bootstrap.TrustAnchor{}, err
+	}
+	return source.TrustAnchor()
+}
+
+// printResult prints the details of a verification result and, if it was recorded, the trace.
+func printResult(result *verification.Result, explainFormat string) error {
+	fmt.Printf("Status: %v\n", result)
+	beyondFormat := errors.Is(result.Err, verification.ErrProofFormat)
+	for i, proof := range result.Proofs {
+		fmt.Printf("Proof %d: %v\n", i+1, proof)
+		beyondFormat = beyondFormat || errors.Is(proof.Err, verification.ErrProofFormat)
+	}
+	if beyondFormat {
+		fmt.Println("Note: a DNSSECProof (type 110) leaves each zone with a single RRset. It cannot carry an NXDOMAIN proof " +
+			"that needs NSEC or NSEC3 records of several names, nor show that a wildcard was expanded correctly, so such " +
+			"responses are bogus even if the zone is signed correctly. Proof chains do not have this limit.")
+	}
+	for _, rr := range result.Unauthenticated {
+		fmt.Printf("Unauthenticated: %v\n", rr)
+	}
+	if result.Trace != nil {
+		if explainFormat == "json" {
+			trace, err := result.Trace.JSON()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s\n", trace)
+		} else {
+			fmt.Printf("Verification steps:\n%v", result.Trace)
+		}
+	}
+	return nil
+}
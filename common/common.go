@@ -1,6 +1,10 @@
 package common
 
-import "time"
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
 
 const (
 	DOH_CONTENT_TYPE   = "application/dns-message"
@@ -27,6 +31,17 @@ const (
 	ChecksumDelimiter       = "  "
 )
 
+// DefaultRootAnchorsDir is where the root anchor files are kept unless another directory is given: in the cache
+// directory of the user, so that the same files are found from any working directory. Without a cache directory
+// it falls back to RootAnchorsLocation in the working directory.
+func DefaultRootAnchorsDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return RootAnchorsLocation
+	}
+	return filepath.Join(dir, "odoh-client", RootAnchorsLocation)
+}
+
 func ReturnRootAnchorFileAndLocationInformation() map[string]string {
 	res := make(map[string]string)
 	res[RootAnchorsFile] = IANARootAnchors
@@ -0,0 +1,180 @@
+package verification
+
+import (
+	"fmt"
+
+	"github.com/cloudflare/odoh-client-go/bootstrap"
+	"github.com/miekg/dns"
+)
+
+// A response may carry several proofs, e.g. one up to a CNAME that leaves the tree of the question
+// and one from the root to the answer for the CNAME target. Proofs are taken in message order: each
+// one continues from the name the previous one was redirected to, until one of them ends with the
+// answer. Any further proofs are for names of their own, they are validated as well and must not
+// contradict the others, but only the proofs for the question authenticate the records of the message.
+
+// proofRecords returns the proofs carried in the answer and additional sections, in message order.
+func proofRecords(msg *dns.Msg) []dns.RR {
+	proofs := make([]dns.RR, 0, 1)
+	for _, section := range [][]dns.RR{msg.Answer, msg.Extra} {
+		for _, rr := range section {
+			switch rr.(type) {
+			case *dns.Chain, *dns.DNSSECProof:
+				proofs = append(proofs, rr)
+			}
+		}
+	}
+	return proofs
+}
+
+func verifyProof(proof dns.RR, target string, qtype uint16, anchor *bootstrap.TrustAnchor, opts *Options) *Result {
+	switch p := proof.(type) {
+	case *dns.Chain:
+		return verifyDNSSECProofChain(p, target, qtype, anchor, opts)
+	case *dns.DNSSECProof:
+		return verifyDNSSECProof(p, target, qtype, anchor, opts)
+	}
+	return bogus("", ReasonMalformedChain, fmt.Errorf("%s is not a DNSSEC proof", dns.TypeToString[proof.Header().Rrtype]))
+}
+
+// proofSubject is the name and type a proof that is not for the question ends at: the owner and type of
+// the leaves of its last zone, or the zone itself with qtype if those are a denial of existence.
+func proofSubject(proof dns.RR, qtype uint16) (string, uint16) {
+	switch p := proof.(type) {
+	case *dns.Chain:
+		if len(p.Zones) == 0 {
+			return ".", qtype
+		}
+		last := &p.Zones[len(p.Zones)-1]
+		for _, leaf := range last.Leaves {
+			if h := leaf.Header(); h.Rrtype != dns.TypeNSEC && h.Rrtype != dns.TypeNSEC3 {
+				return dns.Fqdn(h.Name), h.Rrtype
+			}
+		}
+		return last.Name.String(), qtype
+	case *dns.DNSSECProof:
+		if len(p.Zones) == 0 {
+			return ".", qtype
+		}
+		exit := &p.Zones[len(p.Zones)-1].Exit
+		if t := uint16(exit.Rrtype); t != dns.TypeNSEC && t != dns.TypeNSEC3 {
+			return dns.Fqdn(exit.Next_name.String()), t
+		}
+		return dns.Fqdn(exit.Next_name.String()), qtype
+	}
+	return ".", qtype
+}
+
+// provenName is a name and type together with what a proof says about it
+type provenName struct {
+	name   string
+	qtype  uint16
+	result *Result
+}
+
+// verifyProofs validates every proof of a response for query/qtype and combines their results.
+func verifyProofs(proofs []dns.RR, query string, qtype uint16, anchor *bootstrap.TrustAnchor, opts *Options) *Result {
+	if len(proofs) == 1 {
+		return verifyProof(proofs[0], query, qtype, anchor, opts)
+	}
+
+	results := make([]*Result, 0, len(proofs))
+	proven := make([]provenName, 0, len(proofs))
+	validated := make([][]dns.RR, 0)
+	authenticated := make([][]dns.RR, 0)
+
+	// the proofs for the question, each one continuing where the previous one was redirected
+	var answer *Result
+	target := query
+	i := 0
+	for ; i < len(proofs); i++ {
+		opts.tracer().add(StepProof, true, "proof %d of %d, for %s/%s", i+1, len(proofs), target, dns.TypeToString[qtype])
+		result := verifyProof(proofs[i], target, qtype, anchor, opts)
+		validated = append(validated, result.ValidatedRRsets...)
+		authenticated = append(authenticated, result.authenticated...)
+		if result.next == "" || i == len(proofs)-1 {
+			results = append(results, result)
+			proven = append(proven, provenName{target, qtype, result})
+			answer = result
+			break
+		}
+		// everything in this proof validated, the rest of the way is up to the next one
+		partial := *result
+		partial.Status, partial.Reason, partial.Err = Secure, ReasonValidated, nil
+		results = append(results, &partial)
+		proven = append(proven, provenName{target, qtype, &partial})
+		target = result.next
+	}
+	combined := *answer
+	combined.ValidatedRRsets = validated
+	combined.Proofs = results
+	combined.authenticated = authenticated
+	if combined.Status == Bogus {
+		return &combined
+	}
+
+	// the remaining proofs are for other names
+	for _, proof := range proofs[i+1:] {
+		name, rrtype := proofSubject(proof, qtype)
+		opts.tracer().add(StepProof, true, "proof %d of %d, for %s/%s", len(results)+1, len(proofs), name, dns.TypeToString[rrtype])
+		result := verifyProof(proof, name, rrtype, anchor, opts)
+		results = append(results, result)
+		combined.Proofs = results
+		if result.Status == Bogus {
+			failed := *result
+			failed.Proofs = results
+			return &failed
+		}
+		proven = append(proven, provenName{name, rrtype, result})
+	}
+
+	if err := checkConflicts(proven); err != nil {
+		failed := bogus("", ReasonConflictingProofs, err)
+		failed.Proofs = results
+		return failed
+	}
+	return &combined
+}
+
+// checkConflicts rejects proofs that contradict each other: different contents for the same RRset,
+// a record proven to exist and not to exist, or a name proven to be both signed and unsigned.
+func checkConflicts(proven []provenName) error {
+	rrsets := make(map[string][]dns.RR)
+	for _, p := range proven {
+		for _, rrset := range p.result.authenticated {
+			h := rrset[0].Header()
+			key := fmt.Sprintf("%s/%d", dns.CanonicalName(h.Name), h.Rrtype)
+			if other, ok := rrsets[key]; ok && !sameRRset(rrset, other) {
+				return fmt.Errorf("the proofs authenticate different %s/%s RRsets", h.Name, dns.TypeToString[h.Rrtype])
+			}
+			rrsets[key] = rrset
+		}
+	}
+
+	for _, p := range proven {
+		denial := p.result.Denial
+		if denial == nil {
+			continue
+		}
+		for _, other := range proven {
+			for _, rrset := range other.result.authenticated {
+				h := rrset[0].Header()
+				if h.Rrtype == dns.TypeNSEC || h.Rrtype == dns.TypeNSEC3 || !namesMatch(h.Name, p.name) {
+					continue
+				}
+				if denial.Kind == NXDomain || h.Rrtype == p.qtype {
+					return fmt.Errorf("one proof denies %s/%s, another one authenticates %s/%s", p.name, dns.TypeToString[p.qtype], h.Name, dns.TypeToString[h.Rrtype])
+				}
+			}
+		}
+		if denial.Delegation == "" {
+			continue
+		}
+		for _, other := range proven {
+			if other.result.Status == Secure && other.result.Denial == nil && dns.IsSubDomain(denial.Delegation, other.result.Zone) {
+				return fmt.Errorf("one proof shows that %s is unsigned, another one validates zone %s below it", denial.Delegation, other.result.Zone)
+			}
+		}
+	}
+	return nil
+}
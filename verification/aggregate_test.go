@@ -0,0 +1,53 @@
+package verification
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestVerifyProofsExtraProofs(t *testing.T) {
+	now := time.Now()
+	www, _ := dns.NewRR("www.example.com. 300 IN A 192.0.2.1")
+	other, _ := dns.NewRR("www.example.net. 300 IN A 203.0.113.6")
+	chain, anchor, err := SignChain([]dns.RR{www}, "ECDSAP256SHA256", 0, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra, extraAnchor, err := SignChain([]dns.RR{other}, "ECDSAP256SHA256", 0, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// both chains start from a root KSK of the anchor
+	anchor.Digests = append(anchor.Digests, extraAnchor.Digests...)
+
+	tests := []struct {
+		name   string
+		answer []dns.RR
+		status Status
+	}{
+		{"answer", []dns.RR{www}, Secure},
+		// the extra proof is validated, but it says nothing about the answer to the question
+		{"answer from the extra proof", []dns.RR{www, other}, Bogus},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := new(dns.Msg)
+			msg.SetQuestion("www.example.com.", dns.TypeA)
+			msg.Response = true
+			msg.Answer = test.answer
+			msg.Extra = []dns.RR{chain, extra}
+			result := ValidateDNSSECSignature(msg, "www.example.com.", dns.TypeA, anchor, nil)
+			if result.Status != test.status {
+				t.Fatalf("got %v, want %v", result, test.status)
+			}
+			if result.Status == Bogus && result.Reason != ReasonAnswerMismatch {
+				t.Fatalf("got %v, want %v", result, ReasonAnswerMismatch)
+			}
+			if result.Status == Secure && (len(result.Proofs) != 2 || result.Proofs[1].Status != Secure) {
+				t.Fatalf("got proofs %v, want both validated", result.Proofs)
+			}
+		})
+	}
+}
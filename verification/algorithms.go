@@ -0,0 +1,175 @@
+package verification
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"sort"
+	"strings"
+
+	"github.com/cloudflare/circl/sign/ed448"
+	"github.com/miekg/dns"
+)
+
+// miekg/dns verifies the algorithms the Go standard library implements. The others are verified
+// here, on the signed data rebuilt as RFC 4034 section 3.1.8.1 describes.
+
+// verifySignature checks that sig over rrs was made with key.
+func verifySignature(sig *dns.RRSIG, key *dns.DNSKEY, rrs []dns.RR) error {
+	switch sig.Algorithm {
+	case dns.ED448:
+		return verifyEd448(sig, key, rrs)
+	case dns.PRIVATEDNS:
+		return verifyExperimental(sig, key, rrs)
+	default:
+		return sig.Verify(key, rrs)
+	}
+}
+
+// checkSigner makes the checks RRSIG.Verify makes before looking at the signature itself.
+func checkSigner(sig *dns.RRSIG, key *dns.DNSKEY, rrs []dns.RR) error {
+	if !dns.IsRRset(rrs) {
+		return dns.ErrRRset
+	}
+	if sig.KeyTag != key.KeyTag() || sig.Hdr.Class != key.Hdr.Class || sig.Algorithm != key.Algorithm ||
+		!strings.EqualFold(sig.SignerName, key.Hdr.Name) || key.Protocol != 3 || key.Flags&dns.ZONE == 0 {
+		return dns.ErrKey
+	}
+	if h := rrs[0].Header(); h.Class != sig.Hdr.Class || h.Rrtype != sig.TypeCovered {
+		return dns.ErrRRset
+	}
+	return nil
+}
+
+// signedData rebuilds the data sig was made over: its own RDATA without the signature, followed
+// by the records of the RRset in canonical form and order (RFC 4034 section 6).
+func signedData(sig *dns.RRSIG, rrs []dns.RR) ([]byte, error) {
+	buf := make([]byte, 18, 18+len(sig.SignerName)+1)
+	binary.BigEndian.PutUint16(buf[0:], sig.TypeCovered)
+	buf[2] = sig.Algorithm
+	buf[3] = sig.Labels
+	binary.BigEndian.PutUint32(buf[4:], sig.OrigTtl)
+	binary.BigEndian.PutUint32(buf[8:], sig.Expiration)
+	binary.BigEndian.PutUint32(buf[12:], sig.Inception)
+	binary.BigEndian.PutUint16(buf[16:], sig.KeyTag)
+	signer := make([]byte, 255)
+	off, err := dns.PackDomainName(dns.CanonicalName(sig.SignerName), signer, 0, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	buf = append(buf, signer[:off]...)
+
+	type wireRR struct {
+		wire  []byte
+		rdata int
+	}
+	wires := make([]wireRR, 0, len(rrs))
+	for _, rr := range rrs {
+		c := canonicalRR(rr, sig)
+		wire := make([]byte, dns.Len(c)+1)
+		off, err := dns.PackRR(c, wire, 0, nil, false)
+		if err != nil {
+			return nil, err
+		}
+		// the RDATA starts after the owner name, type, class, TTL and RDLENGTH
+		owner := make([]byte, 255)
+		nameLen, err := dns.PackDomainName(c.Header().Name, owner, 0, nil, false)
+		if err != nil {
+			return nil, err
+		}
+		wires = append(wires, wireRR{wire[:off], nameLen + 10})
+	}
+	sort.Slice(wires, func(i, j int) bool {
+		return bytes.Compare(wires[i].wire[wires[i].rdata:], wires[j].wire[wires[j].rdata:]) < 0
+	})
+	for i, w := range wires {
+		if i > 0 && bytes.Equal(w.wire, wires[i-1].wire) {
+			continue
+		}
+		buf = append(buf, w.wire...)
+	}
+	return buf, nil
+}
+
+// canonicalRR returns rr in the canonical form of RFC 4034 section 6.2 as signed by sig.
+func canonicalRR(rr dns.RR, sig *dns.RRSIG) dns.RR {
+	c := dns.Copy(rr)
+	h := c.Header()
+	h.Ttl = sig.OrigTtl
+	if labels := dns.SplitDomainName(h.Name); len(labels) > int(sig.Labels) {
+		h.Name = "*." + strings.Join(labels[len(labels)-int(sig.Labels):], ".") + "."
+	}
+	h.Name = dns.CanonicalName(h.Name)
+	// names in the RDATA of these types are lowercased too (RFC 6840 section 5.1 drops HINFO from the list)
+	switch x := c.(type) {
+	case *dns.NS:
+		x.Ns = dns.CanonicalName(x.Ns)
+	case *dns.MD:
+		x.Md = dns.CanonicalName(x.Md)
+	case *dns.MF:
+		x.Mf = dns.CanonicalName(x.Mf)
+	case *dns.CNAME:
+		x.Target = dns.CanonicalName(x.Target)
+	case *dns.SOA:
+		x.Ns = dns.CanonicalName(x.Ns)
+		x.Mbox = dns.CanonicalName(x.Mbox)
+	case *dns.MB:
+		x.Mb = dns.CanonicalName(x.Mb)
+	case *dns.MG:
+		x.Mg = dns.CanonicalName(x.Mg)
+	case *dns.MR:
+		x.Mr = dns.CanonicalName(x.Mr)
+	case *dns.PTR:
+		x.Ptr = dns.CanonicalName(x.Ptr)
+	case *dns.MINFO:
+		x.Rmail = dns.CanonicalName(x.Rmail)
+		x.Email = dns.CanonicalName(x.Email)
+	case *dns.MX:
+		x.Mx = dns.CanonicalName(x.Mx)
+	case *dns.RP:
+		x.Mbox = dns.CanonicalName(x.Mbox)
+		x.Txt = dns.CanonicalName(x.Txt)
+	case *dns.AFSDB:
+		x.Hostname = dns.CanonicalName(x.Hostname)
+	case *dns.RT:
+		x.Host = dns.CanonicalName(x.Host)
+	case *dns.SIG:
+		x.SignerName = dns.CanonicalName(x.SignerName)
+	case *dns.PX:
+		x.Map822 = dns.CanonicalName(x.Map822)
+		x.Mapx400 = dns.CanonicalName(x.Mapx400)
+	case *dns.NAPTR:
+		x.Replacement = dns.CanonicalName(x.Replacement)
+	case *dns.KX:
+		x.Exchanger = dns.CanonicalName(x.Exchanger)
+	case *dns.SRV:
+		x.Target = dns.CanonicalName(x.Target)
+	case *dns.DNAME:
+		x.Target = dns.CanonicalName(x.Target)
+	}
+	return c
+}
+
+// verifyEd448 checks an Ed448 signature (RFC 8080), which miekg/dns does not implement.
+func verifyEd448(sig *dns.RRSIG, key *dns.DNSKEY, rrs []dns.RR) error {
+	if err := checkSigner(sig, key, rrs); err != nil {
+		return err
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(key.PublicKey)
+	if err != nil || len(publicKey) != ed448.PublicKeySize {
+		return dns.ErrKey
+	}
+	signature, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil || len(signature) != ed448.SignatureSize {
+		return dns.ErrSig
+	}
+	data, err := signedData(sig, rrs)
+	if err != nil {
+		return err
+	}
+	// pure Ed448 with an empty context, as RFC 8080 section 4 requires
+	if !ed448.Verify(ed448.PublicKey(publicKey), data, signature, "") {
+		return dns.ErrSig
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package verification
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// the Ed448 examples of RFC 8080 section 6
+var ed448Examples = []struct {
+	name  string
+	key   string
+	rrsig string
+}{
+	{
+		"example 1",
+		"example.com. 3600 IN DNSKEY 257 3 16 3kgROaDjrh0H2iuixWBrc8g2EpBBLCdGzHmn+G2MpTPhpj/OiBVHHSfPodx1FYYUcJKm1MDpJtIA",
+		"example.com. 3600 IN RRSIG MX 16 2 3600 1440021600 1438207200 9713 example.com. " +
+			"3cPAHkmlnxcDHMyg7vFC34l0blBhuG1qpwLmjInI8w1CMB29FkEAIJUA0amxWndkmnBZ6SKiwZSAxGILn/NBtOXft0+Gj7FSvOKxE/07+4RQ" +
+			"vE581N3Aj/JtIyaiYVdnYtyMWbSNyGEY2213WKsJlwEA",
+	},
+	{
+		"example 2",
+		"example.com. 3600 IN DNSKEY 257 3 16 kkreGWoccSDmUBGAe7+zsbG6ZAFQp+syPmYUurBRQc3tDjeMCJcVMRDmgcNLp5HlHAMy12VoISsA",
+		"example.com. 3600 IN RRSIG MX 16 2 3600 1440021600 1438207200 38353 example.com. " +
+			"E1/oLjSGIbmLny/4fcgM1z4oL6aqo+izT3urCyHyvEp4Sp8Syg1eI+lJ57CSnZqjJP41O/9l4m0AsQ4f7qI1gVnML8vWWiyW2KXhT9kuAICU" +
+			"Sxv5OWbf81Rq7Yu60npabODB0QFPb/rkW3kUZmQ0YQUA",
+	},
+}
+
+func TestVerifyEd448RFC8080(t *testing.T) {
+	mx, _ := dns.NewRR("example.com. 3600 IN MX 10 mail.example.com.")
+	tampered, _ := dns.NewRR("example.com. 3600 IN MX 20 mail.example.com.")
+
+	for _, example := range ed448Examples {
+		t.Run(example.name, func(t *testing.T) {
+			key, err := dns.NewRR(example.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rrsig, err := dns.NewRR(example.rrsig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dnskey, sig := key.(*dns.DNSKEY), rrsig.(*dns.RRSIG)
+			if err := verifySignature(sig, dnskey, []dns.RR{mx}); err != nil {
+				t.Fatalf("the RFC 8080 signature does not verify: %v", err)
+			}
+			if err := verifySignature(sig, dnskey, []dns.RR{tampered}); err == nil {
+				t.Fatal("the signature verifies over a tampered RRset")
+			}
+		})
+	}
+
+	// the signature of one example does not verify with the key of the other
+	key, _ := dns.NewRR(ed448Examples[1].key)
+	rrsig, _ := dns.NewRR(ed448Examples[0].rrsig)
+	sig := *rrsig.(*dns.RRSIG)
+	sig.KeyTag = key.(*dns.DNSKEY).KeyTag()
+	if err := verifySignature(&sig, key.(*dns.DNSKEY), []dns.RR{mx}); err == nil {
+		t.Fatal("the signature of example 1 verifies with the key of example 2")
+	}
+}
@@ -0,0 +1,293 @@
+package verification
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// checkQuestion makes sure the response is for the question that was asked.
+func checkQuestion(msg *dns.Msg, qname string, qtype uint16) error {
+	if len(msg.Question) != 1 {
+		return fmt.Errorf("the response has %d questions instead of 1", len(msg.Question))
+	}
+	q := msg.Question[0]
+	if !strings.EqualFold(dns.Fqdn(q.Name), dns.Fqdn(qname)) {
+		return fmt.Errorf("the response is for %s, not for %s", q.Name, qname)
+	}
+	if q.Qtype != qtype {
+		return fmt.Errorf("the response is for type %s, not for type %s", dns.TypeToString[q.Qtype], dns.TypeToString[qtype])
+	}
+	if q.Qclass != dns.ClassINET {
+		return fmt.Errorf("the response is for class %s, only IN is supported", dns.ClassToString[q.Qclass])
+	}
+	return nil
+}
+
+// dnameSubstitute replaces the owner of a DNAME at the end of name with its target (RFC 6672 section 2.2).
+func dnameSubstitute(dname *dns.DNAME, name string) (string, bool) {
+	owner := dns.Fqdn(dname.Header().Name)
+	if !dns.IsSubDomain(owner, name) || strings.EqualFold(owner, dns.Fqdn(name)) {
+		return "", false
+	}
+	prefix := dns.SplitDomainName(name)
+	prefix = prefix[:len(prefix)-dns.CountLabel(owner)]
+	if target := dns.Fqdn(dname.Target); target != "." {
+		prefix = append(prefix, strings.TrimSuffix(target, "."))
+	}
+	return dns.Fqdn(strings.Join(prefix, ".")), true
+}
+
+// redirect finds the CNAME or DNAME among rrs that redirects name, and the name it leads to.
+func redirect(rrs []dns.RR, name string) (dns.RR, string) {
+	var dname dns.RR
+	var synthesized string
+	for _, rr := range rrs {
+		switch r := rr.(type) {
+		case *dns.CNAME:
+			if namesMatch(r.Hdr.Name, name) {
+				return r, dns.Fqdn(r.Target)
+			}
+		case *dns.DNAME:
+			if next, ok := dnameSubstitute(r, name); ok && dname == nil {
+				dname, synthesized = r, next
+			}
+		}
+	}
+	return dname, synthesized
+}
+
+// rewriteChain follows the CNAME and DNAME records from the question to the answer, and stops
+// at loops, at DNAMEs that point below themselves and at chains that are too long.
+type rewriteChain struct {
+	names map[string]bool
+	max   int
+}
+
+// newRewriteChain starts at qname and follows at most max records, 0 means no limit.
+func newRewriteChain(qname string, max int) *rewriteChain {
+	return &rewriteChain{names: map[string]bool{dns.CanonicalName(qname): true}, max: max}
+}
+
+// follow checks that the record rr may be followed to next.
+func (c *rewriteChain) follow(rr dns.RR, next string) error {
+	h := rr.Header()
+	if dname, ok := rr.(*dns.DNAME); ok && dns.IsSubDomain(h.Name, dname.Target) {
+		return &reasonError{ReasonRewriteLoop, fmt.Errorf("the DNAME at %s points to %s below itself", h.Name, dname.Target)}
+	}
+	name := dns.CanonicalName(next)
+	if c.names[name] {
+		return &reasonError{ReasonRewriteLoop, fmt.Errorf("the %s at %s leads back to %s", dns.TypeToString[h.Rrtype], h.Name, next)}
+	}
+	if c.max > 0 && len(c.names) > c.max {
+		return &reasonError{ReasonResourceLimit, fmt.Errorf("the answer follows more than %d CNAME and DNAME records", c.max)}
+	}
+	c.names[name] = true
+	return nil
+}
+
+// rewritten is true once a record was followed away from the question name.
+func (c *rewriteChain) rewritten() bool {
+	return len(c.names) > 1
+}
+
+// answersQuestion checks that the authenticated RRsets contain the answer to qname/qtype,
+// following at most maxRewrites CNAME and DNAME records from the question to the final answer.
+func answersQuestion(rrsets [][]dns.RR, qname string, qtype uint16, maxRewrites int) error {
+	records := make([]dns.RR, 0, len(rrsets))
+	for _, rrset := range rrsets {
+		h := rrset[0].Header()
+		if namesMatch(h.Name, qname) && (h.Rrtype == qtype || qtype == dns.TypeANY) {
+			return nil
+		}
+		records = append(records, rrset[0])
+	}
+	chain := newRewriteChain(qname, maxRewrites)
+	for name := qname; ; {
+		rr, next := redirect(records, name)
+		if rr == nil {
+			return fmt.Errorf("the validated records do not answer %s/%s", name, dns.TypeToString[qtype])
+		}
+		if err := chain.follow(rr, next); err != nil {
+			return err
+		}
+		name = next
+		for _, rrset := range rrsets {
+			h := rrset[0].Header()
+			if namesMatch(h.Name, name) && (h.Rrtype == qtype || qtype == dns.TypeANY) {
+				return nil
+			}
+		}
+	}
+}
+
+// deniesQuestion checks that a denial of existence is about qname, or about the name the validated
+// CNAME and DNAME records lead to from qname.
+func deniesQuestion(rrsets [][]dns.RR, denial *DenialOfExistence, qname string, maxRewrites int) error {
+	records := make([]dns.RR, 0, len(rrsets))
+	for _, rrset := range rrsets {
+		records = append(records, rrset[0])
+	}
+	chain := newRewriteChain(qname, maxRewrites)
+	name := qname
+	for {
+		rr, next := redirect(records, name)
+		if rr == nil {
+			break
+		}
+		if err := chain.follow(rr, next); err != nil {
+			return err
+		}
+		name = next
+	}
+	if !dns.IsSubDomain(denial.Zone, name) {
+		return fmt.Errorf("the denial of existence in zone %s is not about %s", denial.Zone, name)
+	}
+	for _, ancestor := range []string{denial.ClosestEncloser, denial.Delegation} {
+		if ancestor != "" && !dns.IsSubDomain(ancestor, name) {
+			return fmt.Errorf("the denial of existence for %s is about names below %s", name, ancestor)
+		}
+	}
+	return nil
+}
+
+// checkRcode makes sure the RCODE of the response says what the proof does: NXDOMAIN for a name that does not
+// exist, NOERROR for an answer or for a name that exists without the queried type (RFC 4035 section 3.1.3).
+func checkRcode(msg *dns.Msg, denial *DenialOfExistence) error {
+	want, proven := dns.RcodeSuccess, "an answer"
+	if denial != nil {
+		proven = denial.Kind.String()
+		if denial.Kind == NXDomain {
+			want = dns.RcodeNameError
+		}
+	}
+	if msg.Rcode != want {
+		return fmt.Errorf("the response has RCODE %s, but the proof is for %s", dns.RcodeToString[msg.Rcode], proven)
+	}
+	return nil
+}
+
+// splitSynthesized separates the unsigned CNAMEs a server synthesized from a DNAME (RFC 6672 section 3.4)
+// from the leaves that have to be signed. The DNAMEs are only known to be authentic after their signatures
+// have been verified, checkSynthesized has to be called then.
+func splitSynthesized(leaves []dns.RR, sigs []dns.RRSIG) ([]dns.RR, []*dns.CNAME) {
+	hasDNAME := false
+	for _, leaf := range leaves {
+		if leaf.Header().Rrtype == dns.TypeDNAME {
+			hasDNAME = true
+		}
+	}
+	if !hasDNAME {
+		return leaves, nil
+	}
+	signed := make([]dns.RR, 0, len(leaves))
+	synthesized := make([]*dns.CNAME, 0)
+	for _, leaf := range leaves {
+		cname, ok := leaf.(*dns.CNAME)
+		if ok && !covered(sigs, cname.Hdr.Name, dns.TypeCNAME) {
+			synthesized = append(synthesized, cname)
+			continue
+		}
+		signed = append(signed, leaf)
+	}
+	return signed, synthesized
+}
+
+func covered(sigs []dns.RRSIG, owner string, rrtype uint16) bool {
+	for _, sig := range sigs {
+		if sig.TypeCovered == rrtype && (sig.Hdr.Name == "" || namesMatch(sig.Hdr.Name, owner)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSynthesized makes sure every synthesized CNAME follows from one of the authenticated DNAMEs.
+func checkSynthesized(synthesized []*dns.CNAME, leaves []dns.RR) error {
+	for _, cname := range synthesized {
+		if !isAuthenticated([]dns.RR{cname}, groupRRsets(leaves)) {
+			return fmt.Errorf("the unsigned CNAME %s -> %s does not follow from a DNAME", cname.Hdr.Name, cname.Target)
+		}
+	}
+	return nil
+}
+
+// sameRRset compares two RRsets ignoring the TTLs and the order of the records.
+func sameRRset(a []dns.RR, b []dns.RR) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, x := range a {
+		found := false
+		for _, y := range b {
+			if dns.IsDuplicate(x, y) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// isAuthenticated checks that rrset is one of the authenticated RRsets, or a CNAME
+// synthesized from an authenticated DNAME (RFC 6672 section 5.3.1).
+func isAuthenticated(rrset []dns.RR, authenticated [][]dns.RR) bool {
+	for _, a := range authenticated {
+		if sameRRset(rrset, a) {
+			return true
+		}
+	}
+	cname, ok := rrset[0].(*dns.CNAME)
+	if !ok || len(rrset) != 1 {
+		return false
+	}
+	for _, a := range authenticated {
+		dname, ok := a[0].(*dns.DNAME)
+		if !ok {
+			continue
+		}
+		if target, ok := dnameSubstitute(dname, cname.Hdr.Name); ok && strings.EqualFold(target, dns.Fqdn(cname.Target)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isProofRecord is true for the records that carry the proof itself and are not authenticated by it
+func isProofRecord(rr dns.RR) bool {
+	switch rr.Header().Rrtype {
+	case dns.TypeOPT, dns.TypeRRSIG, dns.TypeDNSSECProof, dns.TypeZone, dns.TypeChain:
+		return true
+	}
+	return false
+}
+
+// checkSections cross-checks the records of the message against the authenticated RRsets.
+// Every answer RRset must be authenticated, unauthenticated records in the authority and
+// additional sections are returned so they can be flagged.
+func checkSections(msg *dns.Msg, authenticated [][]dns.RR) ([]dns.RR, error) {
+	unauthenticated := make([]dns.RR, 0)
+	for i, section := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		records := make([]dns.RR, 0, len(section))
+		for _, rr := range section {
+			if !isProofRecord(rr) {
+				records = append(records, rr)
+			}
+		}
+		for _, rrset := range groupRRsets(records) {
+			if isAuthenticated(rrset, authenticated) {
+				continue
+			}
+			if i == 0 {
+				h := rrset[0].Header()
+				return nil, fmt.Errorf("the answer RRset %s/%s is not authenticated by the proof", h.Name, dns.TypeToString[h.Rrtype])
+			}
+			unauthenticated = append(unauthenticated, rrset...)
+		}
+	}
+	return unauthenticated, nil
+}
@@ -0,0 +1,250 @@
+package verification
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// records parses records in zone file format, one per string
+func records(t *testing.T, lines ...string) []dns.RR {
+	t.Helper()
+	rrs := make([]dns.RR, 0, len(lines))
+	for _, line := range lines {
+		rr, err := dns.NewRR(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs
+}
+
+func TestRedirect(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []string
+		qname   string
+		next    string
+	}{
+		{"CNAME", []string{"www.example.com. 300 IN CNAME web.example.net."}, "www.example.com.", "web.example.net."},
+		{"CNAME in another case", []string{"WWW.Example.com. 300 IN CNAME web.example.net."}, "www.EXAMPLE.com.", "web.example.net."},
+		{"CNAME of another name", []string{"www.example.com. 300 IN CNAME web.example.net."}, "mail.example.com.", ""},
+		{"DNAME", []string{"example.com. 300 IN DNAME example.net."}, "a.b.example.com.", "a.b.example.net."},
+		{"DNAME to the root", []string{"example.com. 300 IN DNAME ."}, "www.example.com.", "www."},
+		// a DNAME does not redirect its own owner (RFC 6672 section 2.3)
+		{"DNAME owner", []string{"example.com. 300 IN DNAME example.net."}, "example.com.", ""},
+		{"CNAME before DNAME", []string{"example.com. 300 IN DNAME example.net.", "www.example.com. 300 IN CNAME web.example.org."}, "www.example.com.", "web.example.org."},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr, next := redirect(records(t, test.records...), test.qname)
+			if next != test.next || (rr == nil) != (test.next == "") {
+				t.Fatalf("got %v -> %q, want %q", rr, next, test.next)
+			}
+		})
+	}
+}
+
+func TestRewriteChain(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []string
+		max     int
+		answer  string
+		reason  Reason
+	}{
+		{"CNAME", []string{"www.example.com. 300 IN CNAME web.example.net."}, 16, "web.example.net.", ""},
+		{"CNAME and DNAME", []string{"www.example.com. 300 IN CNAME www.cdn.example.net.", "cdn.example.net. 300 IN DNAME cdn.example.org."}, 16, "www.cdn.example.org.", ""},
+		{"CNAME to itself", []string{"www.example.com. 300 IN CNAME www.example.com."}, 16, "", ReasonRewriteLoop},
+		{"CNAME loop", []string{"www.example.com. 300 IN CNAME web.example.net.", "web.example.net. 300 IN CNAME WWW.example.com."}, 16, "", ReasonRewriteLoop},
+		{"longer CNAME loop", []string{
+			"www.example.com. 300 IN CNAME b.example.com.", "b.example.com. 300 IN CNAME c.example.com.", "c.example.com. 300 IN CNAME www.example.com.",
+		}, 16, "", ReasonRewriteLoop},
+		{"DNAME below itself", []string{"example.com. 300 IN DNAME sub.example.com."}, 16, "", ReasonRewriteLoop},
+		{"at the length limit", []string{"www.example.com. 300 IN CNAME a.example.com.", "a.example.com. 300 IN CNAME b.example.com."}, 2, "b.example.com.", ""},
+		{"over the length limit", []string{
+			"www.example.com. 300 IN CNAME a.example.com.", "a.example.com. 300 IN CNAME b.example.com.", "b.example.com. 300 IN CNAME c.example.com.",
+		}, 2, "", ReasonResourceLimit},
+		{"no length limit", []string{
+			"www.example.com. 300 IN CNAME a.example.com.", "a.example.com. 300 IN CNAME b.example.com.", "b.example.com. 300 IN CNAME c.example.com.",
+		}, 0, "c.example.com.", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rrs := records(t, test.records...)
+			chain := newRewriteChain("www.example.com.", test.max)
+			name := "www.example.com."
+			var err error
+			for rr, next := redirect(rrs, name); rr != nil; rr, next = redirect(rrs, name) {
+				if err = chain.follow(rr, next); err != nil {
+					break
+				}
+				name = next
+			}
+			if test.reason == "" {
+				if err != nil || name != test.answer || !chain.rewritten() {
+					t.Fatalf("got %q, %v, want %q", name, err, test.answer)
+				}
+				return
+			}
+			var re *reasonError
+			if !errors.As(err, &re) || re.reason != test.reason {
+				t.Fatalf("got %v, want %v", err, test.reason)
+			}
+		})
+	}
+}
+
+func TestCheckSynthesized(t *testing.T) {
+	dname := records(t, "example.com. 300 IN DNAME example.net.")
+	tests := []struct {
+		name  string
+		cname string
+		valid bool
+	}{
+		{"matching target", "www.example.com. 300 IN CNAME www.example.net.", true},
+		{"matching target in another case", "WWW.example.com. 300 IN CNAME www.EXAMPLE.net.", true},
+		{"other target", "www.example.com. 300 IN CNAME www.example.org.", false},
+		{"other label", "www.example.com. 300 IN CNAME mail.example.net.", false},
+		{"owner outside the DNAME", "www.example.org. 300 IN CNAME www.example.net.", false},
+		{"owner of the DNAME", "example.com. 300 IN CNAME example.net.", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cname := records(t, test.cname)[0].(*dns.CNAME)
+			if err := checkSynthesized([]*dns.CNAME{cname}, dname); (err == nil) != test.valid {
+				t.Fatalf("got %v, valid should be %v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestChainRewrites(t *testing.T) {
+	tests := []struct {
+		name   string
+		leaves []string
+		// synthesized is an unsigned CNAME added next to the DNAME
+		synthesized string
+		// cached starts the chain from the keys of example.com. in the key cache
+		cached bool
+		status Status
+		reason Reason
+	}{
+		{
+			name:   "CNAME into another zone",
+			leaves: []string{"www.example.com. 300 IN CNAME www.example.net.", "www.example.net. 300 IN A 192.0.2.1"},
+			status: Secure,
+		},
+		{
+			name:   "CNAME loop",
+			leaves: []string{"www.example.com. 300 IN CNAME web.example.com.", "web.example.com. 300 IN CNAME www.example.com."},
+			status: Bogus,
+			reason: ReasonRewriteLoop,
+		},
+		{
+			name:        "DNAME with its synthesized CNAME",
+			leaves:      []string{"example.com. 300 IN DNAME example.net.", "www.example.net. 300 IN A 192.0.2.1"},
+			synthesized: "www.example.com. 300 IN CNAME www.example.net.",
+			status:      Secure,
+		},
+		{
+			name:        "synthesized CNAME to another target",
+			leaves:      []string{"example.com. 300 IN DNAME example.net.", "www.example.net. 300 IN A 192.0.2.1"},
+			synthesized: "www.example.com. 300 IN CNAME www.example.org.",
+			status:      Bogus,
+			reason:      ReasonBadSignature,
+		},
+		{
+			name:   "CNAME that leaves the zone the chain starts from",
+			leaves: []string{"www.example.com. 300 IN CNAME www.example.net.", "www.example.net. 300 IN A 192.0.2.1"},
+			cached: true,
+			status: Bogus,
+			reason: ReasonMalformedChain,
+		},
+		{
+			name:   "CNAME to a name outside the chain",
+			leaves: []string{"www.example.com. 300 IN CNAME www.example.net."},
+			status: Bogus,
+			reason: ReasonIncompleteChain,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now := time.Now()
+			chain, anchor, err := SignChain(records(t, test.leaves...), "ECDSAP256SHA256", 0, now.Add(-time.Hour), now.Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.synthesized != "" {
+				zone := &chain.Zones[2]
+				zone.Leaves = append(zone.Leaves, records(t, test.synthesized)...)
+				zone.NumLeaves++
+			}
+			opts := DefaultOptions()
+			if test.cached {
+				opts.KeyCache = NewKeyCache()
+				if result := verifyDNSSECProofChain(chain, "www.example.com.", dns.TypeA, anchor, opts); result.Status != Secure {
+					t.Fatalf("got %v for the full chain, want %v", result, Secure)
+				}
+				chain.InitialKeyTag = chain.Zones[2].Keys[0].KeyTag()
+				chain.Zones = chain.Zones[2:]
+			}
+			result := verifyDNSSECProofChain(chain, "www.example.com.", dns.TypeA, anchor, opts)
+			if result.Status != test.status || test.reason != "" && result.Reason != test.reason {
+				t.Fatalf("got %v, want %v (%v)", result, test.status, test.reason)
+			}
+		})
+	}
+}
+
+func TestRcodeMatchesProof(t *testing.T) {
+	now := time.Now()
+	a := records(t, "www.example.com. 300 IN A 192.0.2.1")
+	answer, anchor, err := SignChain(a, "ECDSAP256SHA256", 0, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the NSEC at the apex proves that example.com. has no A record and that no name below it exists
+	apex, apexAnchor, err := SignChain(records(t, "example.com. 3600 IN NSEC example.com. NS SOA RRSIG NSEC DNSKEY"), "ECDSAP256SHA256", 0, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	anchor.Digests = append(anchor.Digests, apexAnchor.Digests...)
+
+	tests := []struct {
+		name   string
+		qname  string
+		proof  *dns.Chain
+		answer []dns.RR
+		rcode  int
+		status Status
+	}{
+		{"answer with NOERROR", "www.example.com.", answer, a, dns.RcodeSuccess, Secure},
+		{"answer with NXDOMAIN", "www.example.com.", answer, a, dns.RcodeNameError, Bogus},
+		{"NXDOMAIN proof with NXDOMAIN", "www.example.com.", apex, nil, dns.RcodeNameError, Secure},
+		{"NXDOMAIN proof with NOERROR", "www.example.com.", apex, nil, dns.RcodeSuccess, Bogus},
+		{"NXDOMAIN proof with SERVFAIL", "www.example.com.", apex, nil, dns.RcodeServerFailure, Bogus},
+		{"NODATA proof with NOERROR", "example.com.", apex, nil, dns.RcodeSuccess, Secure},
+		{"NODATA proof with NXDOMAIN", "example.com.", apex, nil, dns.RcodeNameError, Bogus},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := new(dns.Msg)
+			msg.SetQuestion(test.qname, dns.TypeA)
+			msg.Response = true
+			msg.Rcode = test.rcode
+			msg.Answer = test.answer
+			msg.Extra = []dns.RR{test.proof}
+			result := ValidateDNSSECSignature(msg, test.qname, dns.TypeA, anchor, nil)
+			if result.Status != test.status {
+				t.Fatalf("got %v, want %v", result, test.status)
+			}
+			if result.Status == Bogus && result.Reason != ReasonRcodeMismatch {
+				t.Fatalf("got %v, want %v", result, ReasonRcodeMismatch)
+			}
+		})
+	}
+}
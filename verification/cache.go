@@ -0,0 +1,137 @@
+package verification
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// EDNS0ChainCode is the option code of the CHAIN query requests option (RFC 7901 section 4).
+const EDNS0ChainCode = 13
+
+// cachedKeys is a validated DNSKEY RRset, usable until it expires.
+type cachedKeys struct {
+	zone    string
+	keys    []*dns.DNSKEY
+	expires time.Time
+}
+
+// KeyCache keeps the DNSKEY sets of zones that were already validated, keyed by zone and key tag,
+// so that later proofs can start from one of them instead of from the root. An entry expires with
+// the TTL of the DNSKEY RRset or with the RRSIGs over it, whichever comes first.
+// It is safe for concurrent use.
+type KeyCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedKeys
+}
+
+// NewKeyCache returns an empty cache.
+func NewKeyCache() *KeyCache {
+	return &KeyCache{entries: make(map[string]cachedKeys)}
+}
+
+func cacheKey(zone string, keyTag uint16) string {
+	return fmt.Sprintf("%s/%d", dns.CanonicalName(zone), keyTag)
+}
+
+// add stores the DNSKEY set of zone after it was validated with sigs.
+func (c *KeyCache) add(zone string, keys []*dns.DNSKEY, sigs []dns.RRSIG, now time.Time) {
+	if c == nil || len(keys) == 0 {
+		return
+	}
+	expires := now.Add(time.Duration(keys[0].Hdr.Ttl) * time.Second)
+	for _, key := range keys {
+		if e := now.Add(time.Duration(key.Hdr.Ttl) * time.Second); e.Before(expires) {
+			expires = e
+		}
+	}
+	for _, sig := range sigs {
+		if e := time.Unix(serialTime(sig.Expiration, now), 0); e.Before(expires) {
+			expires = e
+		}
+	}
+	if !expires.After(now) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		c.entries[cacheKey(zone, key.KeyTag())] = cachedKeys{zone: dns.CanonicalName(zone), keys: keys, expires: expires}
+	}
+}
+
+// lookup returns the DNSKEY set of zone that contains the key with keyTag, if it is cached and still valid.
+func (c *KeyCache) lookup(zone string, keyTag uint16, now time.Time) []*dns.DNSKEY {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[cacheKey(zone, keyTag)]
+	if !ok {
+		return nil
+	}
+	if !entry.expires.After(now) {
+		delete(c.entries, cacheKey(zone, keyTag))
+		return nil
+	}
+	return entry.keys
+}
+
+// enclosing returns the deepest zone at or above qname whose cached DNSKEY set contains the key with keyTag,
+// with that set, or "" if there is none.
+func (c *KeyCache) enclosing(qname string, keyTag uint16, now time.Time) (string, []*dns.DNSKEY) {
+	labels := dns.SplitDomainName(qname)
+	for i := range labels {
+		zone := dns.Fqdn(strings.Join(labels[i:], "."))
+		if keys := c.lookup(zone, keyTag, now); keys != nil {
+			return dns.CanonicalName(zone), keys
+		}
+	}
+	if keys := c.lookup(".", keyTag, now); keys != nil {
+		return ".", keys
+	}
+	return "", nil
+}
+
+// TrustPoint returns the deepest zone at or above qname whose keys are cached. The root does not count,
+// a proof from the root is what the resolver sends anyway.
+func (c *KeyCache) TrustPoint(qname string, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	deepest, found := "", false
+	for _, entry := range c.entries {
+		if entry.zone == "." || !entry.expires.After(now) || !dns.IsSubDomain(entry.zone, qname) {
+			continue
+		}
+		if !found || dns.CountLabel(entry.zone) > dns.CountLabel(deepest) {
+			deepest, found = entry.zone, true
+		}
+	}
+	return deepest, found
+}
+
+// SetChainOption asks the resolver for a proof that starts at the deepest cached zone above the question
+// of msg with an RFC 7901 CHAIN option. It returns the zone, or "" if no zone is cached or msg has no OPT record.
+func (c *KeyCache) SetChainOption(msg *dns.Msg, now time.Time) string {
+	opt := msg.IsEdns0()
+	if c == nil || opt == nil || len(msg.Question) == 0 {
+		return ""
+	}
+	zone, ok := c.TrustPoint(msg.Question[0].Name, now)
+	if !ok {
+		return ""
+	}
+	// the closest trust point is sent as an uncompressed domain name in wire format
+	data := make([]byte, 255)
+	off, err := dns.PackDomainName(zone, data, 0, nil, false)
+	if err != nil {
+		return ""
+	}
+	opt.Option = append(opt.Option, &dns.EDNS0_LOCAL{Code: EDNS0ChainCode, Data: data[:off]})
+	return zone
+}
@@ -0,0 +1,267 @@
+package verification
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// cacheKeys returns a KSK and a ZSK of zone with the given TTL
+func cacheKeys(t *testing.T, zone string, ttl uint32) []*dns.DNSKEY {
+	t.Helper()
+	keys := make([]*dns.DNSKEY, 0, 2)
+	for _, flags := range []uint16{dns.ZONE | dns.SEP, dns.ZONE} {
+		key, err := GenerateKey(zone, flags, "ECDSAP256SHA256", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key.DNSKEY.Hdr.Ttl = ttl
+		keys = append(keys, key.DNSKEY)
+	}
+	return keys
+}
+
+func TestKeyCacheExpiry(t *testing.T) {
+	now := time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC)
+	expiring := func(d time.Duration) []dns.RRSIG {
+		return []dns.RRSIG{{Expiration: uint32(now.Add(d).Unix())}}
+	}
+
+	tests := []struct {
+		name    string
+		ttl     uint32
+		sigs    []dns.RRSIG
+		expires time.Duration
+	}{
+		{"TTL before the signature expires", 3600, expiring(24 * time.Hour), time.Hour},
+		{"signature expires before the TTL", 86400, expiring(2 * time.Hour), 2 * time.Hour},
+		{"earliest of several signatures", 86400, append(expiring(24*time.Hour), expiring(3*time.Hour)...), 3 * time.Hour},
+		{"no signatures", 600, nil, 10 * time.Minute},
+		{"expired signature", 3600, expiring(-time.Second), 0},
+		{"zero TTL", 0, expiring(time.Hour), 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keys := cacheKeys(t, "example.com.", test.ttl)
+			tag := keys[0].KeyTag()
+			cache := NewKeyCache()
+			cache.add("example.com.", keys, test.sigs, now)
+			if test.expires == 0 {
+				if len(cache.entries) != 0 {
+					t.Fatalf("a key set that is already expired is cached: %v", cache.entries)
+				}
+				return
+			}
+			if got := cache.lookup("example.com.", tag, now.Add(test.expires-time.Second)); len(got) != 2 {
+				t.Fatalf("the keys are not served a second before they expire: %v", got)
+			}
+			if got := cache.lookup("example.com.", keys[1].KeyTag(), now); len(got) != 2 {
+				t.Fatalf("the keys are not served for the tag of the ZSK: %v", got)
+			}
+			if got := cache.lookup("example.com.", tag, now.Add(test.expires)); got != nil {
+				t.Fatalf("the keys are served once they expired: %v", got)
+			}
+			if _, ok := cache.entries[cacheKey("example.com.", tag)]; ok {
+				t.Fatal("the expired entry is not evicted")
+			}
+		})
+	}
+
+	// the shortest TTL of the set counts
+	keys := cacheKeys(t, "example.com.", 86400)
+	keys[1].Hdr.Ttl = 60
+	cache := NewKeyCache()
+	cache.add("example.com.", keys, expiring(time.Hour), now)
+	if got := cache.lookup("example.com.", keys[0].KeyTag(), now.Add(time.Minute)); got != nil {
+		t.Fatalf("the keys outlive the shortest TTL of the set: %v", got)
+	}
+}
+
+// tamperSignature flips a bit of the signature of sig
+func tamperSignature(sig *dns.RRSIG) {
+	data, _ := base64.StdEncoding.DecodeString(sig.Signature)
+	data[len(data)/2] ^= 1
+	sig.Signature = base64.StdEncoding.EncodeToString(data)
+}
+
+func TestKeyCacheBogusKeys(t *testing.T) {
+	now := time.Now()
+	a, _ := dns.NewRR("www.example.com. 300 IN A 192.0.2.1")
+	other, _, err := SignChain([]dns.RR{a}, "ECDSAP256SHA256", 0, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(zone *dns.Zone)
+		reason Reason
+	}{
+		{"bad signature over the keys", func(zone *dns.Zone) { tamperSignature(&zone.KeySigs[0]) }, ReasonBadSignature},
+		// the keys of the other chain sign themselves, but no DS of com. matches them
+		{"keys without a matching DS", func(zone *dns.Zone) {
+			zone.Keys, zone.KeySigs = other.Zones[2].Keys, other.Zones[2].KeySigs
+		}, ReasonDSMismatch},
+	}
+	for _, test := range tests {
+		chain, anchor, err := SignChain([]dns.RR{a}, "ECDSAP256SHA256", 0, now.Add(-time.Hour), now.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.tamper(&chain.Zones[2])
+		verifiers := []struct {
+			name   string
+			verify func(opts *Options) *Result
+		}{
+			{"chain", func(opts *Options) *Result {
+				return verifyDNSSECProofChain(chain, "www.example.com.", dns.TypeA, anchor, opts)
+			}},
+			{"proof", func(opts *Options) *Result {
+				return verifyDNSSECProof(proofOf(chain), "www.example.com.", dns.TypeA, anchor, opts)
+			}},
+		}
+		for _, verifier := range verifiers {
+			t.Run(test.name+" in a "+verifier.name, func(t *testing.T) {
+				opts := DefaultOptions()
+				opts.KeyCache = NewKeyCache()
+				if result := verifier.verify(opts); result.Status != Bogus || result.Reason != test.reason {
+					t.Fatalf("got %v, want %v (%v)", result, Bogus, test.reason)
+				}
+				// the zones above were validated and are cached, the bogus one is not
+				if keys := opts.KeyCache.lookup("com.", chain.Zones[1].Keys[0].KeyTag(), opts.now()); keys == nil {
+					t.Error("the keys of com. are not cached")
+				}
+				for _, key := range chain.Zones[2].Keys {
+					if keys := opts.KeyCache.lookup("example.com.", key.KeyTag(), opts.now()); keys != nil {
+						t.Fatalf("the bogus keys of example.com. are served from the cache: %v", keys)
+					}
+				}
+				if zone, ok := opts.KeyCache.TrustPoint("www.example.com.", opts.now()); !ok || zone != "com." {
+					t.Fatalf("got the trust point %q, want com.", zone)
+				}
+			})
+		}
+	}
+}
+
+func TestKeyCacheEnclosing(t *testing.T) {
+	now := time.Now()
+	sigs := []dns.RRSIG{{Expiration: uint32(now.Add(time.Hour).Unix())}}
+	cache := NewKeyCache()
+	root, example := cacheKeys(t, ".", 3600), cacheKeys(t, "example.com.", 3600)
+	cache.add(".", root, sigs, now)
+	cache.add("example.com.", example, sigs, now)
+	tags := make(map[uint16]bool)
+	for _, key := range append(root, example...) {
+		tags[key.KeyTag()] = true
+	}
+	unknown := uint16(0)
+	for tags[unknown] {
+		unknown++
+	}
+
+	tests := []struct {
+		name  string
+		qname string
+		tag   uint16
+		zone  string
+	}{
+		{"zone apex", "example.com.", example[0].KeyTag(), "example.com."},
+		{"name in the zone", "www.example.com.", example[0].KeyTag(), "example.com."},
+		{"name deep in the zone", "a.b.c.example.com.", example[1].KeyTag(), "example.com."},
+		{"case of the name", "WWW.Example.COM.", example[0].KeyTag(), "example.com."},
+		// com. is not cached, the walk goes on to the root
+		{"key of the root", "www.example.com.", root[0].KeyTag(), "."},
+		{"root", ".", root[0].KeyTag(), "."},
+		{"name outside the zone", "www.example.org.", example[0].KeyTag(), ""},
+		{"zone above the cached one", "com.", example[0].KeyTag(), ""},
+		{"unknown key tag", "www.example.com.", unknown, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			zone, keys := cache.enclosing(test.qname, test.tag, now)
+			if zone != test.zone {
+				t.Fatalf("got zone %q, want %q", zone, test.zone)
+			}
+			if (keys == nil) != (test.zone == "") {
+				t.Fatalf("got the keys %v for zone %q", keys, zone)
+			}
+		})
+	}
+
+	if zone, keys := cache.enclosing("www.example.com.", example[0].KeyTag(), now.Add(2*time.Hour)); zone != "" || keys != nil {
+		t.Fatalf("got zone %q from expired keys", zone)
+	}
+}
+
+func TestKeyCacheSetChainOption(t *testing.T) {
+	now := time.Now()
+	sigs := []dns.RRSIG{{Expiration: uint32(now.Add(time.Hour).Unix())}}
+	cache := NewKeyCache()
+	cache.add(".", cacheKeys(t, ".", 3600), sigs, now)
+	cache.add("com.", cacheKeys(t, "com.", 3600), sigs, now)
+	cache.add("example.com.", cacheKeys(t, "example.com.", 3600), sigs, now)
+
+	query := func(qname string, edns bool) *dns.Msg {
+		msg := new(dns.Msg)
+		msg.SetQuestion(qname, dns.TypeA)
+		if edns {
+			msg.SetEdns0(4096, true)
+		}
+		return msg
+	}
+	tests := []struct {
+		name  string
+		cache *KeyCache
+		msg   *dns.Msg
+		now   time.Time
+		zone  string
+		wire  []byte
+	}{
+		{"deepest zone", cache, query("www.example.com.", true), now, "example.com.", []byte("\x07example\x03com\x00")},
+		{"zone apex", cache, query("example.com.", true), now, "example.com.", []byte("\x07example\x03com\x00")},
+		{"zone above", cache, query("www.example.org.com.", true), now, "com.", []byte("\x03com\x00")},
+		{"root only", cache, query("www.example.org.", true), now, "", nil},
+		{"no OPT record", cache, query("www.example.com.", false), now, "", nil},
+		{"expired keys", cache, query("www.example.com.", true), now.Add(2 * time.Hour), "", nil},
+		{"no cache", nil, query("www.example.com.", true), now, "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			zone := test.cache.SetChainOption(test.msg, test.now)
+			if zone != test.zone {
+				t.Fatalf("got zone %q, want %q", zone, test.zone)
+			}
+			opt := test.msg.IsEdns0()
+			if opt == nil {
+				return
+			}
+			var chain []*dns.EDNS0_LOCAL
+			for _, option := range opt.Option {
+				if local, ok := option.(*dns.EDNS0_LOCAL); ok && local.Code == EDNS0ChainCode {
+					chain = append(chain, local)
+				}
+			}
+			if test.zone == "" {
+				if len(chain) != 0 {
+					t.Fatalf("a CHAIN option is set without a trust point: %v", chain)
+				}
+				return
+			}
+			if len(chain) != 1 || !bytes.Equal(chain[0].Data, test.wire) {
+				t.Fatalf("got the CHAIN options %v, want one with %q", chain, test.wire)
+			}
+			// the option survives packing, with the name uncompressed although it is also the question's
+			packed, err := test.msg.Pack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Contains(packed, append([]byte{0, EDNS0ChainCode, 0, byte(len(test.wire))}, test.wire...)) {
+				t.Fatalf("the packed query has no CHAIN option with %q", test.wire)
+			}
+		})
+	}
+}
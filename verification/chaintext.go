@@ -0,0 +1,320 @@
+package verification
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// The text form of a proof chain lists the records of each zone in zone file format, under directives for the
+// fields of the Chain and Zone records they belong to. Empty sections are left out:
+//
+//	$CHAIN 1 0                  ; version, initial key tag
+//	$ZONE com. . 1              ; name, previous name, ZSK index
+//	$KEYS
+//	com. 3600 IN DNSKEY 257 3 13 ...
+//	$KEYSIGS
+//	$DS
+//	$DSSIGS
+//	$LEAVES
+//	$LEAVESSIGS
+//	$END
+//
+// The counts of the wire format follow from the records, so records can be added or removed by hand.
+
+// Directives of the text form of a chain
+const (
+	directiveChain      = "$CHAIN"
+	directiveZone       = "$ZONE"
+	directiveKeys       = "$KEYS"
+	directiveKeySigs    = "$KEYSIGS"
+	directiveDS         = "$DS"
+	directiveDSSigs     = "$DSSIGS"
+	directiveLeaves     = "$LEAVES"
+	directiveLeavesSigs = "$LEAVESSIGS"
+	directiveEnd        = "$END"
+)
+
+// base64LineLength is the length of the lines long keys and signatures are split into
+const base64LineLength = 64
+
+// FormatChain writes a chain in its text form.
+func FormatChain(chain *dns.Chain) string {
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "%s %d %d\n", directiveChain, chain.Version, chain.InitialKeyTag)
+	for i := range chain.Zones {
+		zone := &chain.Zones[i]
+		fmt.Fprintf(&b, "%s %s %s %d\n", directiveZone, zone.Name, zone.PreviousName, zone.ZSKIndex)
+		section := func(directive string, rrs []dns.RR) {
+			if len(rrs) == 0 {
+				return
+			}
+			b.WriteString(directive + "\n")
+			for _, rr := range rrs {
+				b.WriteString(formatRecord(rr) + "\n")
+			}
+		}
+		section(directiveKeys, keyRRs(zone.Keys))
+		section(directiveKeySigs, sigRRs(zone.KeySigs))
+		section(directiveDS, dsRRs(zone.DSSet))
+		section(directiveDSSigs, sigRRs(zone.DSSigs))
+		section(directiveLeaves, zone.Leaves)
+		section(directiveLeavesSigs, sigRRs(zone.LeavesSigs))
+	}
+	b.WriteString(directiveEnd + "\n")
+	return b.String()
+}
+
+func keyRRs(keys []dns.DNSKEY) []dns.RR {
+	rrs := make([]dns.RR, 0, len(keys))
+	for i := range keys {
+		rrs = append(rrs, &keys[i])
+	}
+	return rrs
+}
+
+func sigRRs(sigs []dns.RRSIG) []dns.RR {
+	rrs := make([]dns.RR, 0, len(sigs))
+	for i := range sigs {
+		rrs = append(rrs, &sigs[i])
+	}
+	return rrs
+}
+
+func dsRRs(dsSet []dns.DS) []dns.RR {
+	rrs := make([]dns.RR, 0, len(dsSet))
+	for i := range dsSet {
+		rrs = append(rrs, &dsSet[i])
+	}
+	return rrs
+}
+
+// formatRecord writes a record on one line, or, if it has a long key or signature, with that split over several
+// lines. Post-quantum keys and signatures are longer than the zone file parser accepts as a single token.
+func formatRecord(rr dns.RR) string {
+	s := rr.String()
+	field := ""
+	switch r := rr.(type) {
+	case *dns.DNSKEY:
+		field = r.PublicKey
+	case *dns.RRSIG:
+		field = r.Signature
+	}
+	if len(field) <= base64LineLength || !strings.HasSuffix(s, field) {
+		return s
+	}
+	b := strings.Builder{}
+	b.WriteString(strings.TrimSuffix(s, field) + "(")
+	for len(field) > 0 {
+		n := base64LineLength
+		if n > len(field) {
+			n = len(field)
+		}
+		b.WriteString("\n\t\t\t\t" + field[:n])
+		field = field[n:]
+	}
+	b.WriteString(" )")
+	return b.String()
+}
+
+// chainSection collects the records of one section of a zone while a chain is parsed
+type chainSection struct {
+	directive string
+	line      int
+	text      strings.Builder
+}
+
+// ParseChain reads a chain in the text form FormatChain writes.
+func ParseChain(text string) (*dns.Chain, error) {
+	var chain *dns.Chain
+	var zone *dns.Zone
+	var section *chainSection
+	ended := false
+
+	flush := func() error {
+		if section == nil {
+			return nil
+		}
+		defer func() { section = nil }()
+		rrs := make([]dns.RR, 0)
+		parser := dns.NewZoneParser(strings.NewReader(section.text.String()), "", "")
+		for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+			rrs = append(rrs, rr)
+		}
+		if err := parser.Err(); err != nil {
+			return fmt.Errorf("%s of zone %s at line %d: %w", section.directive, zone.Name, section.line, err)
+		}
+		for _, rr := range rrs {
+			if err := addToZone(zone, section.directive, rr); err != nil {
+				return fmt.Errorf("%s of zone %s at line %d: %w", section.directive, zone.Name, section.line, err)
+			}
+		}
+		return nil
+	}
+
+	for i, line := range strings.Split(text, "\n") {
+		lineNumber := i + 1
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "$") {
+			if section != nil {
+				section.text.WriteString(line + "\n")
+			} else if content, _, _ := strings.Cut(line, ";"); strings.TrimSpace(content) != "" {
+				return nil, fmt.Errorf("line %d: records have to follow a section directive", lineNumber)
+			}
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		if comment := strings.Index(line, ";"); comment >= 0 {
+			fields = strings.Fields(line[:comment])
+		}
+		directive := strings.ToUpper(fields[0])
+		if ended {
+			return nil, fmt.Errorf("line %d: %s after the end of the chain", lineNumber, directive)
+		}
+		if chain == nil && directive != directiveChain {
+			return nil, fmt.Errorf("line %d: a chain has to start with %s", lineNumber, directiveChain)
+		}
+
+		switch directive {
+		case directiveChain:
+			if chain != nil {
+				return nil, fmt.Errorf("line %d: a second %s", lineNumber, directiveChain)
+			}
+			numbers, err := parseNumbers(fields[1:], 8, 16)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s takes the version and the initial key tag: %w", lineNumber, directiveChain, err)
+			}
+			chain = &dns.Chain{
+				Hdr:           dns.RR_Header{Name: ".", Rrtype: dns.TypeChain, Class: dns.ClassINET},
+				Version:       uint8(numbers[0]),
+				InitialKeyTag: uint16(numbers[1]),
+			}
+		case directiveZone:
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("line %d: %s takes the name, the previous name and the ZSK index", lineNumber, directiveZone)
+			}
+			zskIndex, err := parseNumbers(fields[3:], 8)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid ZSK index: %w", lineNumber, err)
+			}
+			for _, name := range fields[1:3] {
+				if _, ok := dns.IsDomainName(name); !ok || !dns.IsFqdn(name) {
+					return nil, fmt.Errorf("line %d: %q is not a fully qualified domain name", lineNumber, name)
+				}
+			}
+			chain.Zones = append(chain.Zones, dns.Zone{
+				Hdr:          dns.RR_Header{Name: ".", Rrtype: dns.TypeZone, Class: dns.ClassINET},
+				Name:         dns.Name(fields[1]),
+				PreviousName: dns.Name(fields[2]),
+				ZSKIndex:     uint8(zskIndex[0]),
+			})
+			zone = &chain.Zones[len(chain.Zones)-1]
+		case directiveKeys, directiveKeySigs, directiveDS, directiveDSSigs, directiveLeaves, directiveLeavesSigs:
+			if zone == nil {
+				return nil, fmt.Errorf("line %d: %s outside of a zone", lineNumber, directive)
+			}
+			if len(fields) != 1 {
+				return nil, fmt.Errorf("line %d: %s takes no arguments", lineNumber, directive)
+			}
+			section = &chainSection{directive: directive, line: lineNumber}
+		case directiveEnd:
+			ended = true
+		default:
+			return nil, fmt.Errorf("line %d: unknown directive %s", lineNumber, fields[0])
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if chain == nil {
+		return nil, fmt.Errorf("no %s found", directiveChain)
+	}
+	if err := countChain(chain); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+// parseNumbers reads one unsigned number of the given size in bits from each field.
+func parseNumbers(fields []string, bitSizes ...int) ([]uint64, error) {
+	if len(fields) != len(bitSizes) {
+		return nil, fmt.Errorf("expected %d numbers, got %d", len(bitSizes), len(fields))
+	}
+	numbers := make([]uint64, len(fields))
+	for i, field := range fields {
+		n, err := strconv.ParseUint(field, 10, bitSizes[i])
+		if err != nil {
+			return nil, err
+		}
+		numbers[i] = n
+	}
+	return numbers, nil
+}
+
+// addToZone adds a record to the field of the zone the directive stands for.
+func addToZone(zone *dns.Zone, directive string, rr dns.RR) error {
+	switch directive {
+	case directiveKeys:
+		key, ok := rr.(*dns.DNSKEY)
+		if !ok {
+			return fmt.Errorf("%s is not a DNSKEY", dns.TypeToString[rr.Header().Rrtype])
+		}
+		zone.Keys = append(zone.Keys, *key)
+	case directiveDS:
+		ds, ok := rr.(*dns.DS)
+		if !ok {
+			return fmt.Errorf("%s is not a DS", dns.TypeToString[rr.Header().Rrtype])
+		}
+		zone.DSSet = append(zone.DSSet, *ds)
+	case directiveKeySigs, directiveDSSigs, directiveLeavesSigs:
+		sig, ok := rr.(*dns.RRSIG)
+		if !ok {
+			return fmt.Errorf("%s is not an RRSIG", dns.TypeToString[rr.Header().Rrtype])
+		}
+		switch directive {
+		case directiveKeySigs:
+			zone.KeySigs = append(zone.KeySigs, *sig)
+		case directiveDSSigs:
+			zone.DSSigs = append(zone.DSSigs, *sig)
+		default:
+			zone.LeavesSigs = append(zone.LeavesSigs, *sig)
+		}
+	case directiveLeaves:
+		zone.Leaves = append(zone.Leaves, rr)
+	}
+	return nil
+}
+
+// countChain sets the counts of the wire format from the zones and records of a chain. Every count is a single
+// octet, a chain with more than 255 zones or records of one kind in a zone cannot be encoded.
+func countChain(chain *dns.Chain) error {
+	if len(chain.Zones) > math.MaxUint8 {
+		return fmt.Errorf("the chain has %d zones, at most %d fit", len(chain.Zones), math.MaxUint8)
+	}
+	for i := range chain.Zones {
+		z := &chain.Zones[i]
+		counts := []struct {
+			what string
+			n    int
+		}{
+			{"keys", len(z.Keys)}, {"key signatures", len(z.KeySigs)},
+			{"DS records", len(z.DSSet)}, {"DS signatures", len(z.DSSigs)},
+			{"leaves", len(z.Leaves)}, {"leaf signatures", len(z.LeavesSigs)},
+		}
+		for _, count := range counts {
+			if count.n > math.MaxUint8 {
+				return fmt.Errorf("zone %s has %d %s, at most %d fit in a chain", z.Name, count.n, count.what, math.MaxUint8)
+			}
+		}
+		z.NumKeys, z.NumKeySigs = uint8(len(z.Keys)), uint8(len(z.KeySigs))
+		z.NumDS, z.NumDSSigs = uint8(len(z.DSSet)), uint8(len(z.DSSigs))
+		z.NumLeaves, z.NumLeavesSigs = uint8(len(z.Leaves)), uint8(len(z.LeavesSigs))
+	}
+	chain.NumZones = uint8(len(chain.Zones))
+	return nil
+}
@@ -0,0 +1,29 @@
+package verification
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestCountChainLimits(t *testing.T) {
+	now := time.Now()
+	for _, n := range []int{255, 256} {
+		leaves := make([]dns.RR, 0, n)
+		for i := 0; i < n; i++ {
+			rr, _ := dns.NewRR(fmt.Sprintf("www.example.com. 300 IN TXT \"%d\"", i))
+			leaves = append(leaves, rr)
+		}
+		chain, _, err := SignChain(leaves, "ED25519", 0, now.Add(-time.Hour), now.Add(time.Hour))
+		switch {
+		case n <= 255 && err != nil:
+			t.Fatalf("%d leaves: %v", n, err)
+		case n <= 255 && int(chain.Zones[len(chain.Zones)-1].NumLeaves) != n:
+			t.Fatalf("%d leaves counted as %d", n, chain.Zones[len(chain.Zones)-1].NumLeaves)
+		case n > 255 && err == nil:
+			t.Fatalf("%d leaves fit in a chain", n)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+// Package verification validates the DNSSEC proofs a resolver serves with its responses, from the trust anchor of
+// the root, or of an island of security, down to the answer or to the proof that there is none.
+//
+// Two encodings of a proof are accepted. A proof chain (CHAIN) lists the DNSKEY, DS and leaf RRsets of every zone
+// on the way with their RRSIGs, and RFC 9102 authentication chains are turned into one. A DNSSECProof (type 110) is
+// more compact: every zone is entered with its DNSKEY RRset and left with a single signed RRset, the DS records of
+// the next zone, a CNAME or DNAME, or the answer.
+//
+// That single RRset limits what a DNSSECProof can prove. An NXDOMAIN proof usually needs two NSEC records, one
+// covering the name and one covering the wildcard at its closest encloser, or up to three NSEC3 records, and they
+// have different owners. An answer synthesized from a wildcard needs the NSEC or NSEC3 records showing that there
+// was no closer match next to it. Such proofs are Bogus in a DNSSECProof, with an error wrapping ErrProofFormat,
+// even if the zone is signed correctly. Proof chains do not have this limit.
+package verification
@@ -0,0 +1,167 @@
+package verification
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/cloudflare/circl/sign"
+	"github.com/cloudflare/circl/sign/dilithium"
+	"github.com/cloudflare/circl/sign/eddilithium2"
+	"github.com/cloudflare/circl/sign/eddilithium3"
+	"github.com/miekg/dns"
+)
+
+// Post-quantum signature schemes have no DNSSEC algorithm numbers yet. To measure what they would cost,
+// they are used under the private algorithm number PRIVATEDNS: the public key of a DNSKEY and the signature
+// of an RRSIG start with the wire form of a domain name that identifies the scheme (RFC 4034 appendix A.1.1).
+// The names are under "test.", which RFC 6761 reserves for testing, so they never clash with a real scheme.
+// The schemes are the round 3 submissions of CRYSTALS-Dilithium that circl implements, not ML-DSA as FIPS 204
+// standardized it: keys and signatures of the two are not interchangeable. The default policy forbids PRIVATEDNS,
+// they are only meant for measuring proof sizes on locally signed chains.
+
+// experimentalSuffix is the domain all identifiers of experimental algorithms are under.
+const experimentalSuffix = "pq.test."
+
+// ExperimentalAlgorithm is a signature scheme that is not a standard DNSSEC algorithm.
+type ExperimentalAlgorithm struct {
+	// Name is the name of the scheme, e.g. "Dilithium2".
+	Name string
+	// Submission is the version of the scheme, "round3" for the NIST round 3 submission.
+	Submission string
+	// Identifier is the domain name that keys and signatures of the scheme start with.
+	Identifier string
+	// PublicKeySize and SignatureSize are the sizes of keys and signatures in bytes, without the identifier.
+	PublicKeySize int
+	SignatureSize int
+
+	generate func() ([]byte, crypto.Signer, error)
+	verify   func(publicKey, message, signature []byte) bool
+}
+
+// dilithiumAlgorithm wraps a mode of round 3 CRYSTALS-Dilithium.
+func dilithiumAlgorithm(mode dilithium.Mode) *ExperimentalAlgorithm {
+	return &ExperimentalAlgorithm{
+		Name:          mode.Name(),
+		Submission:    "round3",
+		Identifier:    strings.ToLower(mode.Name()) + "." + experimentalSuffix,
+		PublicKeySize: mode.PublicKeySize(),
+		SignatureSize: mode.SignatureSize(),
+		generate: func() ([]byte, crypto.Signer, error) {
+			publicKey, privateKey, err := mode.GenerateKey(rand.Reader)
+			if err != nil {
+				return nil, nil, err
+			}
+			return publicKey.Bytes(), privateKey, nil
+		},
+		verify: func(publicKey, message, signature []byte) bool {
+			return mode.Verify(mode.PublicKeyFromBytes(publicKey), message, signature)
+		},
+	}
+}
+
+// schemeAlgorithm wraps a scheme with the generic circl interface, e.g. a hybrid of Dilithium and EdDSA.
+func schemeAlgorithm(scheme sign.Scheme) *ExperimentalAlgorithm {
+	return &ExperimentalAlgorithm{
+		Name:          scheme.Name(),
+		Submission:    "round3",
+		Identifier:    strings.ToLower(scheme.Name()) + "." + experimentalSuffix,
+		PublicKeySize: scheme.PublicKeySize(),
+		SignatureSize: scheme.SignatureSize(),
+		generate: func() ([]byte, crypto.Signer, error) {
+			publicKey, privateKey, err := scheme.GenerateKey()
+			if err != nil {
+				return nil, nil, err
+			}
+			packed, err := publicKey.MarshalBinary()
+			if err != nil {
+				return nil, nil, err
+			}
+			return packed, privateKey, nil
+		},
+		verify: func(publicKey, message, signature []byte) bool {
+			key, err := scheme.UnmarshalBinaryPublicKey(publicKey)
+			if err != nil {
+				return false
+			}
+			return scheme.Verify(key, message, signature, nil)
+		},
+	}
+}
+
+var experimentalAlgorithms = []*ExperimentalAlgorithm{
+	dilithiumAlgorithm(dilithium.Mode2),
+	dilithiumAlgorithm(dilithium.Mode3),
+	dilithiumAlgorithm(dilithium.Mode5),
+	schemeAlgorithm(eddilithium2.Scheme()),
+	schemeAlgorithm(eddilithium3.Scheme()),
+}
+
+// ExperimentalAlgorithms lists the schemes that are accepted under the PRIVATEDNS algorithm number.
+func ExperimentalAlgorithms() []*ExperimentalAlgorithm {
+	return append([]*ExperimentalAlgorithm(nil), experimentalAlgorithms...)
+}
+
+// LookupExperimentalAlgorithm finds a scheme by its name or its identifier, ignoring case. It returns nil if there is none.
+func LookupExperimentalAlgorithm(name string) *ExperimentalAlgorithm {
+	for _, alg := range experimentalAlgorithms {
+		if strings.EqualFold(name, alg.Name) || strings.EqualFold(dns.Fqdn(name), alg.Identifier) {
+			return alg
+		}
+	}
+	return nil
+}
+
+// ParseExperimental splits the key or signature field of a PRIVATEDNS record into its scheme and the
+// key or signature itself.
+func ParseExperimental(field []byte) (*ExperimentalAlgorithm, []byte, error) {
+	identifier, off, err := dns.UnpackDomainName(field, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("the field does not start with the name of an algorithm: %w", err)
+	}
+	alg := LookupExperimentalAlgorithm(identifier)
+	if alg == nil || !strings.EqualFold(identifier, alg.Identifier) {
+		return nil, nil, fmt.Errorf("unknown private algorithm %s", identifier)
+	}
+	return alg, field[off:], nil
+}
+
+// prefix prepends the identifier of the scheme to a key or signature.
+func (a *ExperimentalAlgorithm) prefix(field []byte) []byte {
+	identifier := make([]byte, 255)
+	off, _ := dns.PackDomainName(a.Identifier, identifier, 0, nil, false)
+	return append(identifier[:off], field...)
+}
+
+// verifyExperimental checks a PRIVATEDNS signature made with one of the experimental schemes.
+func verifyExperimental(sig *dns.RRSIG, key *dns.DNSKEY, rrs []dns.RR) error {
+	if err := checkSigner(sig, key, rrs); err != nil {
+		return err
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(key.PublicKey)
+	if err != nil {
+		return dns.ErrKey
+	}
+	alg, publicKey, err := ParseExperimental(publicKey)
+	if err != nil || len(publicKey) != alg.PublicKeySize {
+		return dns.ErrKey
+	}
+	signature, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return dns.ErrSig
+	}
+	sigAlg, signature, err := ParseExperimental(signature)
+	if err != nil || sigAlg != alg || len(signature) != alg.SignatureSize {
+		return dns.ErrSig
+	}
+	data, err := signedData(sig, rrs)
+	if err != nil {
+		return err
+	}
+	if !alg.verify(publicKey, data, signature) {
+		return dns.ErrSig
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package verification
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// delegationCandidates returns the names between zone (exclusive) and qname (inclusive)
+// where a zone cut could be, starting with the one closest to zone.
+func delegationCandidates(zone string, qname string) []string {
+	labels := dns.SplitDomainName(qname)
+	zoneLabels := dns.CountLabel(zone)
+	candidates := make([]string, 0, len(labels))
+	for i := len(labels) - zoneLabels - 1; i >= 0; i-- {
+		candidates = append(candidates, dns.Fqdn(strings.Join(labels[i:], ".")))
+	}
+	return candidates
+}
+
+// checkInsecureDelegation checks that the type bitmap of a name shows a delegation without a DS record.
+// ok is false if the name is not a delegation at all.
+func checkInsecureDelegation(bitmap []uint16, name string) (ok bool, err error) {
+	if !typeBitmapHas(bitmap, dns.TypeNS) || typeBitmapHas(bitmap, dns.TypeSOA) {
+		return false, nil
+	}
+	if typeBitmapHas(bitmap, dns.TypeDS) {
+		return false, fmt.Errorf("the delegation to %s has a DS record, it is not insecure", name)
+	}
+	return true, nil
+}
+
+// verifyInsecureDelegation checks that the already authenticated NSEC or NSEC3 records of zone
+// prove that qname is at or below a delegation that has no DS record, so that the answer
+// provably comes from an unsigned zone (RFC 4035 section 5.2 and RFC 5155 section 8.9).
+func verifyInsecureDelegation(zone string, nsecs []*dns.NSEC, nsec3s []*dns.NSEC3, qname string) (*DenialOfExistence, error) {
+	zone = dns.CanonicalName(zone)
+	if !dns.IsSubDomain(zone, qname) || dns.CanonicalName(qname) == zone {
+		return nil, fmt.Errorf("%s is not below zone %s", qname, zone)
+	}
+	candidates := delegationCandidates(zone, qname)
+
+	if len(nsecs) > 0 {
+		for _, candidate := range candidates {
+			for _, nsec := range nsecs {
+				if !dns.IsSubDomain(zone, nsec.Header().Name) || canonicalCompare(nsec.Header().Name, candidate) != 0 {
+					continue
+				}
+				ok, err := checkInsecureDelegation(nsec.TypeBitMap, candidate)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					return &DenialOfExistence{Kind: InsecureDelegation, Zone: zone, Delegation: dns.CanonicalName(candidate)}, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("no NSEC record proves an unsigned delegation above %s", qname)
+	}
+
+	set, err := newNSEC3Set(zone, nsec3s)
+	if err != nil {
+		return nil, err
+	}
+	for _, candidate := range candidates {
+		match := set.match(candidate)
+		if match == nil {
+			continue
+		}
+		ok, err := checkInsecureDelegation(match.TypeBitMap, candidate)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &DenialOfExistence{Kind: InsecureDelegation, Zone: set.zone, Delegation: dns.CanonicalName(candidate)}, nil
+		}
+	}
+
+	// Without a matching NSEC3 the delegation may still be hidden in an opt-out span
+	encloser, _, nextCloserCover, err := set.closestEncloser(qname)
+	if err != nil {
+		return nil, err
+	}
+	if nextCloserCover.Flags&nsec3OptOutFlag == 0 {
+		return nil, fmt.Errorf("no NSEC3 record proves an unsigned delegation above %s", qname)
+	}
+	return &DenialOfExistence{Kind: OptOutInsecureDelegation, Zone: set.zone, ClosestEncloser: encloser}, nil
+}
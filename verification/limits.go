@@ -0,0 +1,98 @@
+package verification
+
+import (
+	"fmt"
+	"time"
+)
+
+// The default budgets leave room for long CNAME chains and key rollovers, while keeping
+// the work a hostile resolver can cause per response small (CVE-2023-50387, "KeyTrap").
+const (
+	DefaultMaxZones                = 32
+	DefaultMaxKeysPerZone          = 16
+	DefaultMaxKeyTagCollisions     = 4
+	DefaultMaxSignatureValidations = 128
+	DefaultMaxValidationTime       = time.Second
+	DefaultMaxRewrites             = 16
+)
+
+// Limits bound the work spent on validating a single proof. A zero value means no limit.
+type Limits struct {
+	// MaxZones is the largest number of zones a proof may have.
+	MaxZones int
+	// MaxKeysPerZone is the largest DNSKEY RRset accepted for a zone.
+	MaxKeysPerZone int
+	// MaxKeyTagCollisions is how many keys with the key tag of a signature are tried against it.
+	MaxKeyTagCollisions int
+	// MaxSignatureValidations is how many signature verifications a proof may cost in total.
+	MaxSignatureValidations int
+	// MaxValidationTime is how long the signature verifications of a proof may take in total.
+	MaxValidationTime time.Duration
+	// MaxRewrites is the longest chain of CNAME and DNAME records followed from the question to the answer.
+	MaxRewrites int
+}
+
+// DefaultLimits returns the limits used when none are given.
+func DefaultLimits() *Limits {
+	return &Limits{
+		MaxZones:                DefaultMaxZones,
+		MaxKeysPerZone:          DefaultMaxKeysPerZone,
+		MaxKeyTagCollisions:     DefaultMaxKeyTagCollisions,
+		MaxSignatureValidations: DefaultMaxSignatureValidations,
+		MaxValidationTime:       DefaultMaxValidationTime,
+		MaxRewrites:             DefaultMaxRewrites,
+	}
+}
+
+// budget tracks the work spent on one proof against the limits.
+type budget struct {
+	limits      *Limits
+	validations int
+	deadline    time.Time
+}
+
+func newBudget(limits *Limits) *budget {
+	b := &budget{limits: limits}
+	if limits.MaxValidationTime > 0 {
+		// the wall clock, not Options.Now, which may be the time a recorded chain was captured
+		b.deadline = time.Now().Add(limits.MaxValidationTime)
+	}
+	return b
+}
+
+func exceeded(format string, a ...interface{}) error {
+	return &reasonError{reason: ReasonResourceLimit, err: fmt.Errorf(format, a...)}
+}
+
+func (b *budget) checkZones(n int) error {
+	if b.limits.MaxZones > 0 && n > b.limits.MaxZones {
+		return exceeded("the proof has %d zones, at most %d are accepted", n, b.limits.MaxZones)
+	}
+	return nil
+}
+
+func (b *budget) checkKeys(zone string, n int) error {
+	if b.limits.MaxKeysPerZone > 0 && n > b.limits.MaxKeysPerZone {
+		return exceeded("zone %s has %d keys, at most %d are accepted", zone, n, b.limits.MaxKeysPerZone)
+	}
+	return nil
+}
+
+func (b *budget) checkCollisions(keyTag uint16, n int) error {
+	if b.limits.MaxKeyTagCollisions > 0 && n > b.limits.MaxKeyTagCollisions {
+		return exceeded("%d keys have the key tag %d, at most %d are tried", n, keyTag, b.limits.MaxKeyTagCollisions)
+	}
+	return nil
+}
+
+// spend accounts for one signature verification, it fails once the budget is used up.
+func (b *budget) spend() error {
+	if b.limits.MaxSignatureValidations > 0 && b.validations >= b.limits.MaxSignatureValidations {
+		return exceeded("the proof needs more than %d signature verifications", b.limits.MaxSignatureValidations)
+	}
+	if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		return exceeded("verifying the proof took longer than %v", b.limits.MaxValidationTime)
+	}
+	b.validations++
+	return nil
+}
@@ -0,0 +1,160 @@
+package verification
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/odoh-client-go/bootstrap"
+	"github.com/miekg/dns"
+)
+
+// collidingKeys returns n ECDSA P-256 ZSKs that nobody holds the private keys of, with the key tag of key. The
+// policy allows them, so a verifier has to try each of them against a signature by key.
+func collidingKeys(key *dns.DNSKEY, n int) []*dns.DNSKEY {
+	keys := make([]*dns.DNSKEY, 0, n)
+	for seed := 0; len(keys) < n; seed++ {
+		keyBytes := make([]byte, 64)
+		keyBytes[0] = byte(seed)
+		forged := &dns.DNSKEY{Hdr: key.Hdr, Flags: dns.ZONE, Protocol: 3, Algorithm: dns.ECDSAP256SHA256}
+		for i := 0; i < 1<<16; i++ {
+			keyBytes[62], keyBytes[63] = byte(i>>8), byte(i)
+			forged.PublicKey = base64.StdEncoding.EncodeToString(keyBytes)
+			if forged.KeyTag() == key.KeyTag() {
+				keys = append(keys, forged)
+				break
+			}
+		}
+	}
+	return keys
+}
+
+// collidingChain returns a chain of the root alone, whose KSK signs the TXT record at its apex and shares its key tag
+// with n other keys of the zone, and the trust anchor for that KSK.
+func collidingChain(t *testing.T, n int) (*dns.Chain, *bootstrap.TrustAnchor) {
+	t.Helper()
+	now := time.Now()
+	inception, expiration := now.Add(-time.Hour), now.Add(time.Hour)
+	ksk, err := GenerateKey(".", dns.ZONE|dns.SEP, "ECDSAP256SHA256", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := append(collidingKeys(ksk.DNSKEY, n), ksk.DNSKEY)
+	keyRRs := make([]dns.RR, 0, len(keys))
+	zone := dns.Zone{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeZone, Class: dns.ClassINET}, Name: ".", PreviousName: "."}
+	for _, key := range keys {
+		keyRRs = append(keyRRs, key)
+		zone.Keys = append(zone.Keys, *key)
+	}
+	keySig, err := ksk.Sign(keyRRs, inception, expiration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txt, _ := dns.NewRR(". 300 IN TXT \"colliding key tags\"")
+	txtSig, err := ksk.Sign([]dns.RR{txt}, inception, expiration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zone.KeySigs = []dns.RRSIG{*keySig}
+	zone.Leaves, zone.LeavesSigs = []dns.RR{txt}, []dns.RRSIG{*txtSig}
+
+	chain := &dns.Chain{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeChain, Class: dns.ClassINET}, Version: 1, Zones: []dns.Zone{zone}}
+	ds := ksk.DNSKEY.ToDS(dns.SHA256)
+	anchor := &bootstrap.TrustAnchor{
+		Zone:    ".",
+		Digests: []bootstrap.KeyDigest{{ValidFrom: &inception, KeyTag: ds.KeyTag, Algorithm: ds.Algorithm, DigestType: ds.DigestType, Digest: ds.Digest}},
+	}
+	return chain, anchor
+}
+
+func TestKeyTagCollisionLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		colliding  int
+		collisions int
+		status     Status
+	}{
+		{"within the limit", DefaultMaxKeyTagCollisions - 1, DefaultMaxKeyTagCollisions, Secure},
+		{"over the limit", DefaultMaxKeyTagCollisions, DefaultMaxKeyTagCollisions, Bogus},
+		{"far over the limit", 3 * DefaultMaxKeyTagCollisions, DefaultMaxKeyTagCollisions, Bogus},
+		{"no limit", 3 * DefaultMaxKeyTagCollisions, 0, Secure},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chain, anchor := collidingChain(t, test.colliding)
+			opts := DefaultOptions()
+			opts.Limits.MaxKeyTagCollisions = test.collisions
+			result := verifyDNSSECProofChain(chain, ".", dns.TypeTXT, anchor, opts)
+			if result.Status != test.status {
+				t.Fatalf("got %v, want %v", result, test.status)
+			}
+			if result.Status == Bogus && result.Reason != ReasonResourceLimit {
+				t.Fatalf("got %v, want %v", result, ReasonResourceLimit)
+			}
+		})
+	}
+}
+
+func TestCheckSigsCollisionsBeforeVerifying(t *testing.T) {
+	chain, _ := collidingChain(t, DefaultMaxKeyTagCollisions)
+	zone := &chain.Zones[0]
+	keys := make([]*dns.DNSKEY, 0, len(zone.Keys))
+	for i := range zone.Keys {
+		keys = append(keys, &zone.Keys[i])
+	}
+	opts := DefaultOptions().forProof()
+	err := checkSigs(zone.LeavesSigs, keys, zone.Leaves, opts)
+	var re *reasonError
+	if !errors.As(err, &re) || re.reason != ReasonResourceLimit {
+		t.Fatalf("got %v, want %v", err, ReasonResourceLimit)
+	}
+	// none of the colliding keys was tried
+	if opts.workBudget().validations != 0 {
+		t.Fatalf("%d signatures were verified before the limit stopped", opts.workBudget().validations)
+	}
+}
+
+func TestSignatureBudgetSharedByProofs(t *testing.T) {
+	now := time.Now()
+	www, _ := dns.NewRR("www.example.com. 300 IN A 192.0.2.1")
+	other, _ := dns.NewRR("www.example.net. 300 IN A 203.0.113.6")
+	chain, anchor, err := SignChain([]dns.RR{www}, "ECDSAP256SHA256", 0, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra, extraAnchor, err := SignChain([]dns.RR{other}, "ECDSAP256SHA256", 0, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	anchor.Digests = append(anchor.Digests, extraAnchor.Digests...)
+
+	validate := func(validations int, proofs ...dns.RR) *Result {
+		msg := new(dns.Msg)
+		msg.SetQuestion("www.example.com.", dns.TypeA)
+		msg.Response = true
+		msg.Answer = []dns.RR{www}
+		msg.Extra = proofs
+		opts := DefaultOptions()
+		opts.Limits.MaxSignatureValidations = validations
+		return ValidateDNSSECSignature(msg, "www.example.com.", dns.TypeA, anchor, opts)
+	}
+	// the fewest signature verifications a single proof needs
+	cost := 1
+	for ; validate(cost, chain).Status != Secure; cost++ {
+		if cost > DefaultMaxSignatureValidations {
+			t.Fatalf("the proof does not validate: %v", validate(DefaultMaxSignatureValidations, chain))
+		}
+	}
+	if result := validate(cost-1, chain); result.Reason != ReasonResourceLimit {
+		t.Fatalf("got %v with one verification less, want %v", result, ReasonResourceLimit)
+	}
+
+	// the extra proof costs as much again, out of the same budget
+	if result := validate(cost, chain, extra); result.Status != Bogus || result.Reason != ReasonResourceLimit {
+		t.Fatalf("got %v for two proofs on the budget of one, want %v (%v)", result, Bogus, ReasonResourceLimit)
+	}
+	if result := validate(2*cost, chain, extra); result.Status != Secure {
+		t.Fatalf("got %v for two proofs on the budget of two, want %v", result, Secure)
+	}
+}
@@ -0,0 +1,204 @@
+package verification
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// NXNAME is the meta type used by compact denial of existence (RFC 9824) to
+// signal that a minimally covering NSEC stands in for an NXDOMAIN.
+const typeNXNAME uint16 = 128
+
+// canonicalLabels returns the lowercased wire format labels of name, from the
+// leftmost to the rightmost label. Escapes in the presentation format are resolved.
+func canonicalLabels(name string) ([][]byte, error) {
+	wire := make([]byte, 255)
+	off, err := dns.PackDomainName(dns.CanonicalName(name), wire, 0, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	wire = wire[:off]
+
+	labels := make([][]byte, 0)
+	for i := 0; i < len(wire) && wire[i] != 0; i += int(wire[i]) + 1 {
+		labels = append(labels, bytes.ToLower(wire[i+1:i+1+int(wire[i])]))
+	}
+	return labels, nil
+}
+
+// canonicalCompare orders two domain names as described in RFC 4034 section 6.1:
+// labels are compared from the rightmost one as lowercased octet strings, and a name
+// that runs out of labels first sorts first. It returns -1, 0 or 1.
+func canonicalCompare(a, b string) int {
+	la, errA := canonicalLabels(a)
+	lb, errB := canonicalLabels(b)
+	if errA != nil || errB != nil {
+		// not valid names, fall back to something deterministic
+		return bytes.Compare([]byte(dns.CanonicalName(a)), []byte(dns.CanonicalName(b)))
+	}
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := bytes.Compare(la[i], lb[j]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(la) < len(lb):
+		return -1
+	case len(la) > len(lb):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// isMinimallyCovering recognizes the "black lies" style NSEC generated on the fly
+// by online signers: the owner is the queried name itself and the next name is its
+// immediate successor "\000.<owner>", so nothing but the owner is described.
+func isMinimallyCovering(nsec *dns.NSEC) bool {
+	owner := dns.CanonicalName(nsec.Header().Name)
+	return canonicalCompare(nsec.NextDomain, "\\000."+owner) == 0
+}
+
+// nsecCovers checks that name falls strictly between the owner and next name of
+// an NSEC record. The last NSEC of a zone points back to the apex, it covers the
+// names of the zone that sort after its owner.
+func nsecCovers(nsec *dns.NSEC, name string) bool {
+	owner, next := nsec.Header().Name, nsec.NextDomain
+	if canonicalCompare(owner, name) >= 0 {
+		return false
+	}
+	if canonicalCompare(next, owner) <= 0 {
+		// end of the chain
+		return dns.IsSubDomain(next, name)
+	}
+	return canonicalCompare(name, next) < 0
+}
+
+// commonAncestor returns the longest name that both a and b are a subdomain of.
+func commonAncestor(a, b string) string {
+	n := dns.CompareDomainName(a, b)
+	labels := dns.SplitDomainName(a)
+	if n == 0 {
+		return "."
+	}
+	return dns.CanonicalName(strings.Join(labels[len(labels)-n:], "."))
+}
+
+// nsecEncloser returns the closest encloser of a name that the NSEC record cover shows not to exist: the longer
+// of the names the name has in common with the owner and with the next name of cover.
+func nsecEncloser(cover *dns.NSEC, name string) string {
+	encloser := commonAncestor(name, cover.Header().Name)
+	if next := commonAncestor(name, cover.NextDomain); dns.CountLabel(next) > dns.CountLabel(encloser) {
+		encloser = next
+	}
+	return encloser
+}
+
+// checkNoDataBitmap checks that the NSEC or NSEC3 type bitmap of name shows neither qtype nor a CNAME,
+// and that the record comes from the correct side of a zone cut.
+func checkNoDataBitmap(bitmap []uint16, name string, qtype uint16) error {
+	if typeBitmapHas(bitmap, qtype) || typeBitmapHas(bitmap, dns.TypeCNAME) {
+		return fmt.Errorf("NSEC for %s shows that type %s exists", name, dns.TypeToString[qtype])
+	}
+	isDelegation := typeBitmapHas(bitmap, dns.TypeNS) && !typeBitmapHas(bitmap, dns.TypeSOA)
+	if qtype == dns.TypeDS && typeBitmapHas(bitmap, dns.TypeSOA) && dns.CanonicalName(name) != "." {
+		return fmt.Errorf("NSEC for %s is from the child side of the zone cut", name)
+	}
+	if qtype != dns.TypeDS && isDelegation {
+		return fmt.Errorf("NSEC for %s is from the parent side of the zone cut", name)
+	}
+	return nil
+}
+
+// verifyNSECDenial checks that the already authenticated NSEC records of zone prove
+// that there is no qname/qtype RRset, following RFC 4035 section 5.4.
+func verifyNSECDenial(zone string, nsecs []*dns.NSEC, qname string, qtype uint16) (*DenialOfExistence, error) {
+	zone = dns.CanonicalName(zone)
+	denial := &DenialOfExistence{Zone: zone}
+	if !dns.IsSubDomain(zone, qname) {
+		return nil, fmt.Errorf("%s is not within NSEC zone %s", qname, zone)
+	}
+
+	inZone := make([]*dns.NSEC, 0, len(nsecs))
+	for _, nsec := range nsecs {
+		if dns.IsSubDomain(zone, nsec.Header().Name) && dns.IsSubDomain(zone, nsec.NextDomain) {
+			inZone = append(inZone, nsec)
+		}
+	}
+	if len(inZone) == 0 {
+		return nil, fmt.Errorf("no NSEC records for zone %s", zone)
+	}
+
+	// NODATA, the name exists but not with this type
+	for _, nsec := range inZone {
+		if canonicalCompare(nsec.Header().Name, qname) != 0 {
+			continue
+		}
+		denial.MinimallyCovering = isMinimallyCovering(nsec)
+		if denial.MinimallyCovering && typeBitmapHas(nsec.TypeBitMap, typeNXNAME) {
+			// compact denial of existence, the name does not exist at all
+			denial.Kind = NXDomain
+			return denial, nil
+		}
+		if err := checkNoDataBitmap(nsec.TypeBitMap, qname, qtype); err != nil {
+			return nil, err
+		}
+		denial.Kind = NoData
+		return denial, nil
+	}
+
+	// NXDOMAIN, some NSEC has to cover the name itself
+	var cover *dns.NSEC
+	for _, nsec := range inZone {
+		if nsecCovers(nsec, qname) {
+			cover = nsec
+			break
+		}
+	}
+	if cover == nil {
+		return nil, fmt.Errorf("no NSEC record matches or covers %s", qname)
+	}
+
+	// An NSEC owned by an ancestor of qname that is a delegation or DNAME only
+	// shows that the name lives below a cut, not that it does not exist (RFC 6840 section 4.1).
+	owner := cover.Header().Name
+	if dns.IsSubDomain(owner, qname) && (typeBitmapHas(cover.TypeBitMap, dns.TypeDNAME) ||
+		(typeBitmapHas(cover.TypeBitMap, dns.TypeNS) && !typeBitmapHas(cover.TypeBitMap, dns.TypeSOA))) {
+		return nil, fmt.Errorf("NSEC covering %s is owned by a delegation or DNAME at %s", qname, owner)
+	}
+
+	// a next name below qname makes it an empty non-terminal, it exists without any records (RFC 4035 section 3.1.3.2)
+	if dns.IsSubDomain(qname, cover.NextDomain) && canonicalCompare(qname, cover.NextDomain) != 0 {
+		denial.Kind = NoData
+		return denial, nil
+	}
+
+	encloser := nsecEncloser(cover, qname)
+	denial.ClosestEncloser = encloser
+
+	// and there must not be a wildcard at the closest encloser that could have answered it
+	wildcard := "*." + encloser
+	if encloser == "." {
+		wildcard = "*."
+	}
+	for _, nsec := range inZone {
+		if canonicalCompare(nsec.Header().Name, wildcard) == 0 {
+			if err := checkNoDataBitmap(nsec.TypeBitMap, wildcard, qtype); err != nil {
+				return nil, err
+			}
+			// wildcard NODATA
+			denial.Kind = NoData
+			return denial, nil
+		}
+	}
+	for _, nsec := range inZone {
+		if nsecCovers(nsec, wildcard) {
+			denial.Kind = NXDomain
+			return denial, nil
+		}
+	}
+	return nil, fmt.Errorf("no NSEC record covers the wildcard %s", wildcard)
+}
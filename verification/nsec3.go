@@ -0,0 +1,274 @@
+package verification
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// RFC 9276 recommends that validators treat NSEC3 records with more iterations
+// than this as insecure. We refuse to do the hashing work at all.
+const maxNSEC3Iterations = 150
+
+// errNSEC3Iterations signals NSEC3 records with more than maxNSEC3Iterations iterations.
+// The zone is then treated as insecure, not bogus (RFC 9276 section 3.2).
+var errNSEC3Iterations = errors.New("too many NSEC3 iterations")
+
+// The NSEC3 opt-out flag, RFC 5155 section 3.1.2.1
+const nsec3OptOutFlag = 0x01
+
+// DenialKind describes what an authenticated denial of existence proves.
+type DenialKind int
+
+const (
+	// NXDomain means the queried name does not exist.
+	NXDomain DenialKind = iota + 1
+	// NoData means the queried name exists, but not with the queried type.
+	NoData
+	// OptOutInsecureDelegation means the queried name may be covered by an
+	// opt-out span, i.e. it may be an unsigned delegation.
+	OptOutInsecureDelegation
+	// InsecureDelegation means the queried name is at or below a delegation
+	// that provably has no DS record, i.e. it is in an unsigned zone.
+	InsecureDelegation
+)
+
+func (k DenialKind) String() string {
+	switch k {
+	case NXDomain:
+		return "NXDOMAIN"
+	case NoData:
+		return "NODATA"
+	case OptOutInsecureDelegation:
+		return "OPT-OUT"
+	case InsecureDelegation:
+		return "INSECURE-DELEGATION"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// DenialOfExistence describes a validated NSEC or NSEC3 proof that the chain
+// ends in instead of the records that were asked for.
+type DenialOfExistence struct {
+	Kind DenialKind
+	// Zone is the zone that signed the denial.
+	Zone string
+	// ClosestEncloser is only set for name error, wildcard and opt-out proofs.
+	ClosestEncloser string
+	// Delegation is the unsigned delegation point for insecure delegation proofs.
+	Delegation string
+	// MinimallyCovering is set when the proof is a single on-the-fly NSEC for
+	// the queried name ("black lies", RFC 4470 and RFC 9824).
+	MinimallyCovering bool
+}
+
+func (d *DenialOfExistence) String() string {
+	if d.MinimallyCovering {
+		return fmt.Sprintf("authenticated denial of existence in zone %s: %v (minimally covering NSEC)", d.Zone, d.Kind)
+	}
+	if d.Delegation != "" {
+		return fmt.Sprintf("authenticated denial of existence in zone %s: %v (no DS for %s)", d.Zone, d.Kind, d.Delegation)
+	}
+	if d.ClosestEncloser != "" {
+		return fmt.Sprintf("authenticated denial of existence in zone %s: %v (closest encloser %s)", d.Zone, d.Kind, d.ClosestEncloser)
+	}
+	return fmt.Sprintf("authenticated denial of existence in zone %s: %v", d.Zone, d.Kind)
+}
+
+func typeBitmapHas(bitmap []uint16, t uint16) bool {
+	for _, b := range bitmap {
+		if b == t {
+			return true
+		}
+	}
+	return false
+}
+
+// nsec3Set holds the NSEC3 records of a single zone that share the same hash
+// parameters, and caches the hashes computed for names while checking a proof.
+type nsec3Set struct {
+	zone       string
+	hash       uint8
+	iterations uint16
+	salt       string
+	records    []*dns.NSEC3
+	hashes     map[string]string
+}
+
+func newNSEC3Set(zone string, nsec3s []*dns.NSEC3) (*nsec3Set, error) {
+	set := &nsec3Set{
+		zone:   dns.CanonicalName(zone),
+		hashes: make(map[string]string),
+	}
+	for _, rr := range nsec3s {
+		// RFC 5155 section 8.1, records with unknown hash algorithms or flags are ignored
+		if rr.Hash != dns.SHA1 || rr.Flags&^nsec3OptOutFlag != 0 {
+			continue
+		}
+		// the owner must be a single hash label directly below the zone
+		labels := dns.SplitDomainName(rr.Header().Name)
+		if len(labels) == 0 || dns.CanonicalName(strings.Join(labels[1:], ".")) != set.zone {
+			continue
+		}
+		if len(set.records) == 0 {
+			set.hash, set.iterations, set.salt = rr.Hash, rr.Iterations, strings.ToUpper(rr.Salt)
+		} else if rr.Hash != set.hash || rr.Iterations != set.iterations || !strings.EqualFold(rr.Salt, set.salt) {
+			// RFC 5155 section 8.2
+			return nil, errors.New("NSEC3 records in the proof use inconsistent hash parameters")
+		}
+		set.records = append(set.records, rr)
+	}
+	if len(set.records) == 0 {
+		return nil, fmt.Errorf("no usable NSEC3 records for zone %s", zone)
+	}
+	if set.iterations > maxNSEC3Iterations {
+		return nil, fmt.Errorf("NSEC3 iteration count %d for zone %s exceeds the limit of %d: %w", set.iterations, zone, maxNSEC3Iterations, errNSEC3Iterations)
+	}
+	return set, nil
+}
+
+func (s *nsec3Set) hashOf(name string) string {
+	name = dns.CanonicalName(name)
+	if h, ok := s.hashes[name]; ok {
+		return h
+	}
+	h := dns.HashName(name, s.hash, s.iterations, s.salt)
+	s.hashes[name] = h
+	return h
+}
+
+func ownerHash(rr *dns.NSEC3) string {
+	return strings.ToUpper(dns.SplitDomainName(rr.Header().Name)[0])
+}
+
+// match returns the NSEC3 record whose owner is the hash of name, if any.
+func (s *nsec3Set) match(name string) *dns.NSEC3 {
+	h := s.hashOf(name)
+	for _, rr := range s.records {
+		if ownerHash(rr) == h {
+			return rr
+		}
+	}
+	return nil
+}
+
+// cover returns the NSEC3 record whose hash interval strictly contains the
+// hash of name, if any. The last record in the zone wraps around to the first.
+func (s *nsec3Set) cover(name string) *dns.NSEC3 {
+	h := s.hashOf(name)
+	for _, rr := range s.records {
+		owner, next := ownerHash(rr), strings.ToUpper(rr.NextDomain)
+		if owner < next {
+			if owner < h && h < next {
+				return rr
+			}
+		} else if h > owner || h < next {
+			// end of the chain, or a zone with a single NSEC3 record
+			if h != owner {
+				return rr
+			}
+		}
+	}
+	return nil
+}
+
+// closestEncloser finds the closest provable encloser of qname as described in
+// RFC 5155 section 8.3. It returns the encloser, the next closer name and the
+// NSEC3 record that covers the next closer name.
+func (s *nsec3Set) closestEncloser(qname string) (string, string, *dns.NSEC3, error) {
+	labels := dns.SplitDomainName(qname)
+	zoneLabels := dns.CountLabel(s.zone)
+	if !dns.IsSubDomain(s.zone, qname) {
+		return "", "", nil, fmt.Errorf("%s is not within NSEC3 zone %s", qname, s.zone)
+	}
+
+	for i := 1; i <= len(labels)-zoneLabels; i++ {
+		candidate := dns.Fqdn(strings.Join(labels[i:], "."))
+		match := s.match(candidate)
+		if match == nil {
+			continue
+		}
+		// An NSEC3 from a delegation point (NS without SOA) or a DNAME belongs
+		// to the parent side of a cut and cannot prove anything below it.
+		if typeBitmapHas(match.TypeBitMap, dns.TypeDNAME) ||
+			(typeBitmapHas(match.TypeBitMap, dns.TypeNS) && !typeBitmapHas(match.TypeBitMap, dns.TypeSOA)) {
+			return "", "", nil, fmt.Errorf("closest encloser %s of %s is a delegation or DNAME", candidate, qname)
+		}
+		nextCloser := dns.Fqdn(strings.Join(labels[i-1:], "."))
+		cover := s.cover(nextCloser)
+		if cover == nil {
+			return "", "", nil, fmt.Errorf("no NSEC3 covers the next closer name %s", nextCloser)
+		}
+		return candidate, nextCloser, cover, nil
+	}
+	if dns.CanonicalName(qname) == s.zone {
+		return "", "", nil, fmt.Errorf("no NSEC3 record matches the zone apex %s", s.zone)
+	}
+	return "", "", nil, fmt.Errorf("no closest encloser for %s could be proven", qname)
+}
+
+// verifyNSEC3Denial checks that the already authenticated NSEC3 records of zone
+// prove that there is no qname/qtype RRset, following RFC 5155 section 8.
+func verifyNSEC3Denial(zone string, nsec3s []*dns.NSEC3, qname string, qtype uint16) (*DenialOfExistence, error) {
+	set, err := newNSEC3Set(zone, nsec3s)
+	if err != nil {
+		return nil, err
+	}
+	if !dns.IsSubDomain(set.zone, qname) {
+		return nil, fmt.Errorf("%s is not within NSEC3 zone %s", qname, set.zone)
+	}
+	denial := &DenialOfExistence{Zone: set.zone}
+
+	// RFC 5155 section 8.5 and 8.6, the name exists but not with this type.
+	if match := set.match(qname); match != nil {
+		if typeBitmapHas(match.TypeBitMap, qtype) || typeBitmapHas(match.TypeBitMap, dns.TypeCNAME) {
+			return nil, fmt.Errorf("NSEC3 for %s shows that type %s exists", qname, dns.TypeToString[qtype])
+		}
+		if qtype == dns.TypeDS && typeBitmapHas(match.TypeBitMap, dns.TypeSOA) && dns.CanonicalName(qname) != "." {
+			// the DS of a zone lives in the parent, the child apex cannot deny it
+			return nil, fmt.Errorf("NSEC3 for %s is from the child side of the zone cut", qname)
+		}
+		if qtype != dns.TypeDS && typeBitmapHas(match.TypeBitMap, dns.TypeNS) && !typeBitmapHas(match.TypeBitMap, dns.TypeSOA) {
+			// the parent side of a zone cut is not authoritative for other types
+			return nil, fmt.Errorf("NSEC3 for %s is from the parent side of the zone cut", qname)
+		}
+		denial.Kind = NoData
+		return denial, nil
+	}
+
+	encloser, _, nextCloserCover, err := set.closestEncloser(qname)
+	if err != nil {
+		return nil, err
+	}
+	denial.ClosestEncloser = encloser
+
+	// An opt-out span may hide an unsigned delegation, RFC 5155 section 8.6 and
+	// section 9.2. Nothing beyond that can be said about the name.
+	if nextCloserCover.Flags&nsec3OptOutFlag != 0 {
+		denial.Kind = OptOutInsecureDelegation
+		return denial, nil
+	}
+	if qtype == dns.TypeDS {
+		return nil, fmt.Errorf("no matching NSEC3 for DS query %s and the covering NSEC3 does not have opt-out set", qname)
+	}
+
+	wildcard := dns.Fqdn("*." + strings.TrimPrefix(encloser, "."))
+	if wildcardMatch := set.match(wildcard); wildcardMatch != nil {
+		// RFC 5155 section 8.7, wildcard NODATA
+		if typeBitmapHas(wildcardMatch.TypeBitMap, qtype) || typeBitmapHas(wildcardMatch.TypeBitMap, dns.TypeCNAME) {
+			return nil, fmt.Errorf("NSEC3 for wildcard %s shows that type %s exists", wildcard, dns.TypeToString[qtype])
+		}
+		denial.Kind = NoData
+		return denial, nil
+	}
+
+	// RFC 5155 section 8.4, the wildcard at the closest encloser must not exist either.
+	if set.cover(wildcard) == nil {
+		return nil, fmt.Errorf("no NSEC3 covers the wildcard %s", wildcard)
+	}
+	denial.Kind = NXDomain
+	return denial, nil
+}
@@ -0,0 +1,49 @@
+package verification
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// nsec3Record returns an NSEC3 record of zone for the hash of name, pointing to the hash of next
+func nsec3Record(zone, name, next string, iterations uint16, types ...uint16) *dns.NSEC3 {
+	owner := dns.HashName(name, dns.SHA1, iterations, "")
+	return &dns.NSEC3{
+		Hdr:        dns.RR_Header{Name: dns.Fqdn(owner + "." + zone), Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 3600},
+		Hash:       dns.SHA1,
+		Iterations: iterations,
+		HashLength: 20,
+		NextDomain: dns.HashName(next, dns.SHA1, iterations, ""),
+		TypeBitMap: types,
+	}
+}
+
+func TestNSEC3DenialAtRoot(t *testing.T) {
+	// the apex and the wildcard *. of the root, the second record wraps around to the first
+	nsec3s := []*dns.NSEC3{
+		nsec3Record(".", ".", "*.", 0, dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG, dns.TypeDNSKEY, dns.TypeNSEC3PARAM),
+		nsec3Record(".", "*.", ".", 0, dns.TypeTXT, dns.TypeRRSIG),
+	}
+	denial, err := verifyNSEC3Denial(".", nsec3s, "nonexistent.", dns.TypeA)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the wildcard exists, but without an A record
+	if denial.Kind != NoData || denial.ClosestEncloser != "." {
+		t.Fatalf("got %v, want NODATA from the wildcard *.", denial)
+	}
+}
+
+func TestNSEC3TooManyIterations(t *testing.T) {
+	apex := nsec3Record("example.", "example.", "example.", maxNSEC3Iterations+1, dns.TypeNS, dns.TypeSOA)
+	_, err := verifyNSEC3Denial("example.", []*dns.NSEC3{apex}, "www.example.", dns.TypeA)
+	if !errors.Is(err, errNSEC3Iterations) {
+		t.Fatalf("got error %v, want %v", err, errNSEC3Iterations)
+	}
+	result := failedDenial("example.", ReasonInvalidDenial, err)
+	if result.Status != Insecure || result.Reason != ReasonNSEC3Iterations {
+		t.Fatalf("got %v, want Insecure (%v)", result, ReasonNSEC3Iterations)
+	}
+}
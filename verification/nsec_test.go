@@ -0,0 +1,96 @@
+package verification
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestNSECCovers(t *testing.T) {
+	tests := []struct {
+		nsec   string
+		name   string
+		covers bool
+	}{
+		{"a.example. NSEC d.example. A", "b.example.", true},
+		{"a.example. NSEC d.example. A", "a.example.", false},
+		{"a.example. NSEC d.example. A", "d.example.", false},
+		{"a.example. NSEC d.example. A", "e.example.", false},
+		// the last NSEC of the zone only covers the rest of the zone
+		{"z.example. NSEC example. A", "zz.example.", true},
+		{"z.example. NSEC example. A", "www.other.", false},
+		{"example. NSEC example. SOA", "www.example.", true},
+		{"example. NSEC example. SOA", "www.other.org.", false},
+	}
+	for _, test := range tests {
+		rr, err := dns.NewRR(test.nsec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := nsecCovers(rr.(*dns.NSEC), test.name); got != test.covers {
+			t.Errorf("nsecCovers(%q, %s) = %v, want %v", test.nsec, test.name, got, test.covers)
+		}
+	}
+}
+
+func TestNSECDenialOutsideZone(t *testing.T) {
+	apex, _ := dns.NewRR("example.com. 3600 IN NSEC example.com. NS SOA RRSIG NSEC DNSKEY")
+	now := time.Now()
+	chain, anchor, err := SignChain([]dns.RR{apex}, "ECDSAP256SHA256", 0, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		qname  string
+		status Status
+	}{
+		{"www.example.com.", Secure},
+		{"www.other.org.", Bogus},
+	}
+	for _, test := range tests {
+		msg := new(dns.Msg)
+		msg.SetQuestion(test.qname, dns.TypeA)
+		msg.Response = true
+		msg.Rcode = dns.RcodeNameError
+		msg.Extra = []dns.RR{chain}
+		result := ValidateDNSSECSignature(msg, test.qname, dns.TypeA, anchor, nil)
+		if result.Status != test.status {
+			t.Errorf("NXDOMAIN for %s: got %v, want %v", test.qname, result, test.status)
+		}
+	}
+}
+
+func TestNSECDenialEmptyNonTerminal(t *testing.T) {
+	tests := []struct {
+		nsecs []string
+		qname string
+		qtype uint16
+		kind  DenialKind
+	}{
+		// b.example. only exists because x.b.example. does
+		{[]string{"a.example. NSEC x.b.example. A"}, "b.example.", dns.TypeA, NoData},
+		{[]string{"a.example. NSEC x.b.example. A"}, "b.example.", dns.TypeDS, NoData},
+		{[]string{"a.example. NSEC x.b.example. A"}, "c.b.example.", dns.TypeA, NXDomain},
+		{[]string{"example. NSEC a.example. NS SOA", "a.example. NSEC c.example. A"}, "b.example.", dns.TypeA, NXDomain},
+	}
+	for _, test := range tests {
+		nsecs := make([]*dns.NSEC, 0, len(test.nsecs))
+		for _, s := range test.nsecs {
+			rr, err := dns.NewRR(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nsecs = append(nsecs, rr.(*dns.NSEC))
+		}
+		denial, err := verifyNSECDenial("example.", nsecs, test.qname, test.qtype)
+		if err != nil {
+			t.Errorf("%s/%s: %v", test.qname, dns.TypeToString[test.qtype], err)
+			continue
+		}
+		if denial.Kind != test.kind {
+			t.Errorf("%s/%s: got %v, want %v", test.qname, dns.TypeToString[test.qtype], denial.Kind, test.kind)
+		}
+	}
+}
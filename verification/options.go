@@ -0,0 +1,141 @@
+package verification
+
+import (
+	"time"
+)
+
+// DefaultClockSkew is how far outside of its validity period an RRSIG is still
+// accepted by default. This matches the minimum skew Unbound allows.
+const DefaultClockSkew = time.Hour
+
+// Options configure how a proof chain is validated. A nil *Options uses the defaults.
+type Options struct {
+	// Now returns the instant at which the signatures in the chain have to be valid.
+	// Set it to verify a recorded chain as of the time it was captured. Defaults to time.Now.
+	Now func() time.Time
+	// ClockSkew is how far before its inception or after its expiration an RRSIG is still accepted.
+	ClockSkew time.Duration
+	// Policy decides which algorithms, digest types and key sizes are accepted. Defaults to DefaultPolicy.
+	Policy *Policy
+	// ProofRequested is set when the query was sent with the DO bit, so the response
+	// should carry a proof chain or a proof that the name is insecure.
+	ProofRequested bool
+	// Strict makes a response without a proof Bogus instead of Indeterminate if one was requested.
+	Strict bool
+	// SignedZones, if set, records the zones that were validated and is used to detect
+	// responses that claim that one of them is unsigned.
+	SignedZones *SignedZones
+	// ManagedKeys, if set, tracks the root KSKs of validated root DNSKEY sets and adds the trusted ones to the
+	// trust anchor (RFC 5011).
+	ManagedKeys *ManagedKeys
+	// KeyCache, if set, stores the keys of validated zones so that a chain with a non-zero
+	// initial key tag can start from one of them.
+	KeyCache *KeyCache
+	// Limits bound the work spent on a single proof. Defaults to DefaultLimits.
+	Limits *Limits
+	// Explain records every step of the validation in Result.Trace.
+	Explain bool
+
+	// work is what the proof being validated has cost so far
+	work *budget
+	// trace records the steps of the proof being validated if Explain is set
+	trace *Trace
+}
+
+// DefaultOptions returns the options used when none are given.
+func DefaultOptions() *Options {
+	return &Options{
+		Now:       time.Now,
+		ClockSkew: DefaultClockSkew,
+		Policy:    DefaultPolicy(),
+		Limits:    DefaultLimits(),
+	}
+}
+
+func (o *Options) now() time.Time {
+	if o == nil || o.Now == nil {
+		return time.Now()
+	}
+	return o.Now()
+}
+
+func (o *Options) clockSkew() time.Duration {
+	if o == nil {
+		return DefaultClockSkew
+	}
+	return o.ClockSkew
+}
+
+func (o *Options) policy() *Policy {
+	if o == nil || o.Policy == nil {
+		return DefaultPolicy()
+	}
+	return o.Policy
+}
+
+func (o *Options) proofRequested() bool {
+	return o != nil && o.ProofRequested
+}
+
+func (o *Options) strict() bool {
+	return o != nil && o.Strict
+}
+
+func (o *Options) signedZones() *SignedZones {
+	if o == nil {
+		return nil
+	}
+	return o.SignedZones
+}
+
+func (o *Options) managedKeys() *ManagedKeys {
+	if o == nil {
+		return nil
+	}
+	return o.ManagedKeys
+}
+
+func (o *Options) keyCache() *KeyCache {
+	if o == nil {
+		return nil
+	}
+	return o.KeyCache
+}
+
+func (o *Options) limits() *Limits {
+	if o == nil || o.Limits == nil {
+		return DefaultLimits()
+	}
+	return o.Limits
+}
+
+// forProof returns a copy of the options that tracks the work spent on, and the trace of, one proof,
+// unless the options already do so for a proof this one is part of.
+func (o *Options) forProof() *Options {
+	if o != nil && o.work != nil {
+		return o
+	}
+	c := DefaultOptions()
+	if o != nil {
+		*c = *o
+	}
+	c.work = newBudget(c.limits())
+	if c.Explain {
+		c.trace = &Trace{Steps: make([]Step, 0)}
+	}
+	return c
+}
+
+func (o *Options) workBudget() *budget {
+	if o == nil || o.work == nil {
+		return newBudget(o.limits())
+	}
+	return o.work
+}
+
+func (o *Options) tracer() *Trace {
+	if o == nil {
+		return nil
+	}
+	return o.trace
+}
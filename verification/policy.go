@@ -0,0 +1,145 @@
+package verification
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultMinRSAKeyBits is the smallest RSA modulus accepted by default.
+const DefaultMinRSAKeyBits = 1024
+
+// errUnsupportedDS signals that none of the DS records (or trust anchor digests) of a zone
+// can be used under the policy, so the zone has to be treated as insecure (RFC 6840 section 5.2).
+var errUnsupportedDS = errors.New("no DS record uses an algorithm and digest type allowed by the policy")
+
+// Policy decides which signing algorithms, DS digest types and key sizes are acceptable.
+type Policy struct {
+	// AllowedAlgorithms, if not empty, lists the only signing algorithms that may be used.
+	AllowedAlgorithms map[uint8]bool
+	// ForbiddenAlgorithms are never used, even if they are allowed.
+	ForbiddenAlgorithms map[uint8]bool
+	// AllowedDigestTypes, if not empty, lists the only DS digest types that may be used.
+	AllowedDigestTypes map[uint8]bool
+	// ForbiddenDigestTypes are never used, even if they are allowed.
+	ForbiddenDigestTypes map[uint8]bool
+	// MinRSAKeyBits is the smallest RSA modulus in bits that is accepted.
+	MinRSAKeyBits int
+}
+
+// DefaultPolicy follows the validation recommendations of RFC 8624 section 3.1 and 3.3:
+// RSAMD5, DSA and DSA-NSEC3-SHA1 must not be used for validation, and neither must the
+// NULL and GOST R 34.11-94 DS digest types. PRIVATEDNS, which carries the experimental
+// algorithms, is forbidden as well.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		AllowedAlgorithms: map[uint8]bool{},
+		ForbiddenAlgorithms: map[uint8]bool{
+			dns.RSAMD5:       true,
+			dns.DSA:          true,
+			dns.DSANSEC3SHA1: true,
+			dns.PRIVATEDNS:   true,
+		},
+		AllowedDigestTypes: map[uint8]bool{},
+		ForbiddenDigestTypes: map[uint8]bool{
+			0:          true,
+			dns.GOST94: true,
+		},
+		MinRSAKeyBits: DefaultMinRSAKeyBits,
+	}
+}
+
+// ParsePolicy builds a policy on top of the defaults from lists of algorithm and
+// digest type names or numbers, e.g. "ECDSAP256SHA256" or "13", and "SHA256" or "2".
+func ParsePolicy(allowedAlgorithms, forbiddenAlgorithms, allowedDigests, forbiddenDigests []string, minRSAKeyBits int) (*Policy, error) {
+	policy := DefaultPolicy()
+	policy.MinRSAKeyBits = minRSAKeyBits
+
+	var err error
+	if policy.AllowedAlgorithms, err = parseCodes(allowedAlgorithms, dns.StringToAlgorithm, policy.AllowedAlgorithms); err != nil {
+		return nil, err
+	}
+	if policy.ForbiddenAlgorithms, err = parseCodes(forbiddenAlgorithms, dns.StringToAlgorithm, policy.ForbiddenAlgorithms); err != nil {
+		return nil, err
+	}
+	if policy.AllowedDigestTypes, err = parseCodes(allowedDigests, dns.StringToHash, policy.AllowedDigestTypes); err != nil {
+		return nil, err
+	}
+	if policy.ForbiddenDigestTypes, err = parseCodes(forbiddenDigests, dns.StringToHash, policy.ForbiddenDigestTypes); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func parseCodes(values []string, names map[string]uint8, codes map[uint8]bool) (map[uint8]bool, error) {
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			v = strings.ToUpper(strings.TrimSpace(v))
+			if v == "" {
+				continue
+			}
+			if code, ok := names[v]; ok {
+				codes[code] = true
+				continue
+			}
+			code, err := strconv.ParseUint(v, 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("unknown algorithm or digest type %q", v)
+			}
+			codes[uint8(code)] = true
+		}
+	}
+	return codes, nil
+}
+
+func (p *Policy) algorithmAllowed(alg uint8) bool {
+	if p.ForbiddenAlgorithms[alg] {
+		return false
+	}
+	return len(p.AllowedAlgorithms) == 0 || p.AllowedAlgorithms[alg]
+}
+
+func (p *Policy) digestAllowed(digestType uint8) bool {
+	if p.ForbiddenDigestTypes[digestType] {
+		return false
+	}
+	return len(p.AllowedDigestTypes) == 0 || p.AllowedDigestTypes[digestType]
+}
+
+// keyAllowed checks the algorithm of the key and, for RSA keys, the size of the modulus
+func (p *Policy) keyAllowed(key *dns.DNSKEY) bool {
+	if !p.algorithmAllowed(key.Algorithm) {
+		return false
+	}
+	switch key.Algorithm {
+	case dns.RSAMD5, dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512:
+		return rsaKeyBits(key) >= p.MinRSAKeyBits
+	}
+	return true
+}
+
+// dsAllowed checks the algorithm and digest type of a DS record
+func (p *Policy) dsAllowed(ds *dns.DS) bool {
+	return p.algorithmAllowed(ds.Algorithm) && p.digestAllowed(ds.DigestType)
+}
+
+// rsaKeyBits returns the size of the modulus of an RSA DNSKEY (RFC 3110 section 2), or 0 if it is malformed.
+func rsaKeyBits(key *dns.DNSKEY) int {
+	keyBytes, err := base64.StdEncoding.DecodeString(key.PublicKey)
+	if err != nil || len(keyBytes) < 3 {
+		return 0
+	}
+	exponentLength, exponentStart := int(keyBytes[0]), 1
+	if exponentLength == 0 {
+		exponentLength, exponentStart = int(keyBytes[1])<<8|int(keyBytes[2]), 3
+	}
+	if exponentStart+exponentLength >= len(keyBytes) {
+		return 0
+	}
+	return new(big.Int).SetBytes(keyBytes[exponentStart+exponentLength:]).BitLen()
+}
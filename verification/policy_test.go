@@ -0,0 +1,92 @@
+package verification
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// forgedKSK returns a 512 bit RSA KSK that nobody holds the private key of, with the key tag and algorithm of key
+func forgedKSK(key *dns.DNSKEY) *dns.DNSKEY {
+	// exponent 65537, then the modulus
+	keyBytes := append([]byte{3, 1, 0, 1, 0xc0}, make([]byte, 63)...)
+	forged := &dns.DNSKEY{Hdr: key.Hdr, Flags: key.Flags, Protocol: 3, Algorithm: key.Algorithm}
+	for i := 0; i < 1<<16; i++ {
+		keyBytes[len(keyBytes)-2], keyBytes[len(keyBytes)-1] = byte(i>>8), byte(i)
+		forged.PublicKey = base64.StdEncoding.EncodeToString(keyBytes)
+		if forged.KeyTag() == key.KeyTag() {
+			return forged
+		}
+	}
+	panic("no key tag collision")
+}
+
+func TestTrustedKSKsPolicy(t *testing.T) {
+	ksk, err := GenerateKey("example.", dns.ZONE|dns.SEP, "RSASHA256", 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := *ksk.DNSKEY.ToDS(dns.SHA256)
+	forged := forgedKSK(ksk.DNSKEY)
+	gost := ds
+	gost.DigestType = dns.GOST94
+
+	tests := []struct {
+		name        string
+		keys        []*dns.DNSKEY
+		dsSet       []dns.DS
+		trusted     bool
+		unsupported bool
+	}{
+		{"matching key", []*dns.DNSKEY{ksk.DNSKEY}, []dns.DS{ds}, true, false},
+		{"forged small key next to the real one", []*dns.DNSKEY{forged, ksk.DNSKEY}, []dns.DS{ds}, true, false},
+		// a key the zone never signed cannot make the zone insecure
+		{"only a forged small key", []*dns.DNSKEY{forged}, []dns.DS{ds}, false, false},
+		{"forbidden digest type", []*dns.DNSKEY{ksk.DNSKEY}, []dns.DS{gost}, false, true},
+		{"no DS records", []*dns.DNSKEY{ksk.DNSKEY}, nil, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if forged.KeyTag() != ksk.DNSKEY.KeyTag() || DefaultPolicy().keyAllowed(forged) {
+				t.Fatal("the forged key should collide with the real one and be too small")
+			}
+			keys, err := trustedKSKs(test.keys, test.dsSet, nil)
+			if test.trusted {
+				if err != nil || len(keys) != 1 || keys[0] != ksk.DNSKEY {
+					t.Fatalf("got %v, %v, want the real key", keys, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("got %v, want an error", keys)
+			}
+			if errors.Is(err, errUnsupportedDS) != test.unsupported {
+				t.Fatalf("got error %v, unsupported should be %v", err, test.unsupported)
+			}
+		})
+	}
+}
+
+func TestExperimentalAlgorithmsForbidden(t *testing.T) {
+	now := time.Now()
+	a, _ := dns.NewRR("www.example.com. 300 IN A 192.0.2.1")
+	chain, anchor, err := SignChain([]dns.RR{a}, "Dilithium2", 0, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a response signed with a research algorithm is treated as unsigned
+	result := verifyDNSSECProofChain(chain, "www.example.com.", dns.TypeA, anchor, DefaultOptions())
+	if result.Status != Insecure || result.Reason != ReasonUnsupportedAlgorithm {
+		t.Fatalf("got %v with the default policy, want %v (%v)", result, Insecure, ReasonUnsupportedAlgorithm)
+	}
+
+	opts := DefaultOptions()
+	delete(opts.Policy.ForbiddenAlgorithms, dns.PRIVATEDNS)
+	if result := verifyDNSSECProofChain(chain, "www.example.com.", dns.TypeA, anchor, opts); result.Status != Secure {
+		t.Fatalf("got %v with PRIVATEDNS allowed, want %v", result, Secure)
+	}
+}
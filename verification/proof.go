@@ -0,0 +1,329 @@
+package verification
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cloudflare/odoh-client-go/bootstrap"
+	"github.com/miekg/dns"
+)
+
+// The DNSSECProof (type 110) encoding describes a proof as a list of zone pairs. Entering a zone
+// carries its DNSKEY RRset and the signature over it, leaving it carries the one signed RRset that
+// leads out of the zone: the DS records of the next zone, a CNAME or DNAME, or the answer itself.
+// Zone and signer names are not on the wire, they follow from the names of the records leaving
+// each zone, starting with the root.
+
+// ErrProofFormat is wrapped by the errors of DNSSECProof proofs that failed for want of records the encoding has no
+// room for. A denial of existence that needs NSEC or NSEC3 records of several owners, e.g. one covering the name
+// and one covering the wildcard at its closest encloser, and the proof that a wildcard was expanded correctly do
+// not fit in the single RRset leaving a zone.
+var ErrProofFormat = errors.New("a DNSSECProof leaves each zone with a single RRset, which cannot carry this proof")
+
+// beyondFormat tells whether a denial of existence that failed in a DNSSECProof would have needed NSEC or NSEC3
+// records of other owners than the ones of rrs: the NSEC covers the target but not the wildcard, or no NSEC3
+// matches the target, so that its closest encloser, next closer name and wildcard are left to other records.
+func beyondFormat(zone string, rrs []dns.RR, target string) bool {
+	nsec3s := make([]*dns.NSEC3, 0)
+	for _, rr := range rrs {
+		switch r := rr.(type) {
+		case *dns.NSEC:
+			if nsecCovers(r, target) {
+				return true
+			}
+		case *dns.NSEC3:
+			nsec3s = append(nsec3s, r)
+		}
+	}
+	if len(nsec3s) == 0 {
+		return false
+	}
+	set, err := newNSEC3Set(zone, nsec3s)
+	return err == nil && set.match(target) == nil
+}
+
+// toRRSIG rebuilds the RRSIG that was serialized as sig, over records of type rrtype owned by owner.
+func toRRSIG(sig *dns.Signature, owner string, rrtype uint16, signer string) dns.RRSIG {
+	return dns.RRSIG{
+		Hdr:         dns.RR_Header{Name: owner, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: sig.Ttl},
+		TypeCovered: rrtype,
+		Algorithm:   sig.Algorithm,
+		Labels:      sig.Labels,
+		OrigTtl:     sig.Ttl,
+		Expiration:  sig.Expires,
+		Inception:   sig.Begins,
+		KeyTag:      sig.Key_tag,
+		SignerName:  signer,
+		Signature:   base64.StdEncoding.EncodeToString(sig.Signature),
+	}
+}
+
+// toDNSKEYs rebuilds the DNSKEY RRset of zone from the serialized keys.
+func toDNSKEYs(keys []dns.Key, zone string, ttl uint32) []*dns.DNSKEY {
+	dnsKeys := make([]*dns.DNSKEY, 0, len(keys))
+	for _, key := range keys {
+		dnsKeys = append(dnsKeys, &dns.DNSKEY{
+			Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: ttl},
+			Flags:     key.Flags,
+			Protocol:  key.Protocol,
+			Algorithm: key.Algorithm,
+			PublicKey: base64.StdEncoding.EncodeToString(key.Public_key),
+		})
+	}
+	return dnsKeys
+}
+
+// toDS rebuilds the DS RRset of zone from the serialized DS records.
+func toDS(dsRecords []dns.SerialDS, zone string, ttl uint32) []dns.DS {
+	dsSet := make([]dns.DS, 0, len(dsRecords))
+	for _, ds := range dsRecords {
+		dsSet = append(dsSet, dns.DS{
+			Hdr:        dns.RR_Header{Name: zone, Rrtype: dns.TypeDS, Class: dns.ClassINET, Ttl: ttl},
+			KeyTag:     ds.Key_tag,
+			Algorithm:  ds.Algorithm,
+			DigestType: ds.Digest_type,
+			Digest:     strings.ToUpper(hex.EncodeToString(ds.Digest)),
+		})
+	}
+	return dsSet
+}
+
+// leavingRecords rebuilds the RRset that leaves a zone, or returns an error if the leaving type is unknown.
+func leavingRecords(exit *dns.Leaving, ttl uint32) ([]dns.RR, error) {
+	owner := dns.Fqdn(exit.Next_name.String())
+	hdr := dns.RR_Header{Name: owner, Rrtype: uint16(exit.Rrtype), Class: dns.ClassINET, Ttl: ttl}
+	switch exit.LeavingType {
+	case dns.LeavingCNAMEType:
+		hdr.Rrtype = dns.TypeCNAME
+		return []dns.RR{&dns.CNAME{Hdr: hdr, Target: dns.Fqdn(exit.Name.String())}}, nil
+	case dns.LeavingDNAMEType:
+		hdr.Rrtype = dns.TypeDNAME
+		return []dns.RR{&dns.DNAME{Hdr: hdr, Target: dns.Fqdn(exit.Name.String())}}, nil
+	case dns.LeavingDSType:
+		rrs := make([]dns.RR, 0, len(exit.Ds_records))
+		for _, ds := range toDS(exit.Ds_records, owner, ttl) {
+			rrs = append(rrs, dns.Copy(&ds))
+		}
+		return rrs, nil
+	case dns.LeavingOtherType:
+		for _, rr := range exit.Rrs {
+			if rr.Header().Rrtype != uint16(exit.Rrtype) || !strings.EqualFold(rr.Header().Name, owner) {
+				return nil, fmt.Errorf("the records leaving the zone at %s are not one RRset of type %s", owner, dns.TypeToString[uint16(exit.Rrtype)])
+			}
+		}
+		return exit.Rrs, nil
+	default:
+		return nil, fmt.Errorf("unknown leaving record type %d", exit.LeavingType)
+	}
+}
+
+// enteredZone is a zone whose DS records are known, so it can be entered again after a CNAME or DNAME.
+// A zone the proof starts from because its keys are in the key cache has these keys instead.
+type enteredZone struct {
+	name       string
+	dsSet      []dns.DS
+	cachedKeys []*dns.DNSKEY
+}
+
+func verifyDNSSECProof(proof *dns.DNSSECProof, target string, qtype uint16, anchor *bootstrap.TrustAnchor, opts *Options) *Result {
+	if len(proof.Zones) == 0 {
+		return bogus("", ReasonMalformedChain, errors.New("no zones included in proof."))
+	}
+	opts = opts.forProof()
+	if err := opts.workBudget().checkZones(len(proof.Zones)); err != nil {
+		return bogus("", ReasonResourceLimit, err)
+	}
+
+	// Initial state. 0 denotes the KSK of the anchor's zone, any other key tag a key of a zone the client
+	// already validated, the proof then starts with the deepest such zone above the target.
+	validated := make([][]dns.RR, 0)
+	visited := []enteredZone{{name: "."}}
+	if proof.Initial_key_tag == 0 {
+		if result := outsideAnchor(anchor, target); result != nil {
+			return result
+		}
+		if anchor.ZoneName() == "." {
+			visited[0].dsSet = opts.managedKeys().anchorDS(anchor, opts.now())
+		}
+	} else {
+		zone, keys := opts.keyCache().enclosing(target, proof.Initial_key_tag, opts.now())
+		if keys == nil {
+			return bogus("", ReasonUnknownTrustPoint, fmt.Errorf("the proof starts from key %d, which is not in the key cache", proof.Initial_key_tag))
+		}
+		opts.tracer().add(StepAnchor, true, "the proof starts from the cached key %d of zone %s", proof.Initial_key_tag, zone)
+		visited[0] = enteredZone{name: zone, cachedKeys: keys}
+	}
+	authenticated := make([][]dns.RR, 0)
+	rewrites := newRewriteChain(target, opts.limits().MaxRewrites)
+
+	for _, pair := range proof.Zones {
+		current := visited[len(visited)-1]
+		zone := dns.Name(current.name)
+		if aboveAnchor(anchor, current.name) {
+			// the zones above the anchor's zone cannot be validated, only their delegations towards it are followed
+			owner := dns.CanonicalName(pair.Exit.Next_name.String())
+			if pair.Exit.LeavingType != dns.LeavingDSType || owner == current.name || !dns.IsSubDomain(current.name, owner) ||
+				!dns.IsSubDomain(owner, anchor.ZoneName()) || !dns.IsSubDomain(owner, target) {
+				return bogus(zone, ReasonMalformedChain, fmt.Errorf("zone %s is not left towards %s, the zone of the trust anchor", current.name, anchor.ZoneName()))
+			}
+			opts.tracer().add(StepAnchor, true, "zone %s is above %s, the zone of the trust anchor, and is skipped", current.name, anchor.ZoneName())
+			entered := enteredZone{name: owner}
+			if owner == anchor.ZoneName() {
+				entered.dsSet = opts.managedKeys().anchorDS(anchor, opts.now())
+			}
+			visited = append(visited, entered)
+			continue
+		}
+		opts.tracer().enterZone(current.name, "zone %s: %d keys, %d DS, leaving with %s", current.name, len(pair.Entry.Keys), len(current.dsSet), dns.TypeToString[uint16(pair.Exit.Rrtype)])
+
+		// Entering the zone, the entry key must match one of the DS records and sign the DNSKEY RRset
+		if err := opts.workBudget().checkKeys(current.name, len(pair.Entry.Keys)); err != nil {
+			return bogus(zone, ReasonResourceLimit, err)
+		}
+		keys := toDNSKEYs(pair.Entry.Keys, current.name, pair.Entry.Key_sig.Ttl)
+		if int(pair.Entry.Entry_key_index) >= len(keys) {
+			return bogus(zone, ReasonMalformedChain, fmt.Errorf("entry key index %d of zone %s is out of range", pair.Entry.Entry_key_index, current.name))
+		}
+		entryKey := keys[pair.Entry.Entry_key_index]
+		trusted := current.cachedKeys
+		if trusted == nil {
+			var err error
+			trusted, err = trustedKSKs([]*dns.DNSKEY{entryKey}, current.dsSet, opts)
+			if errors.Is(err, errUnsupportedDS) {
+				return unsupported(zone, err)
+			}
+			if err != nil {
+				reason := ReasonDSMismatch
+				if current.name == anchor.ZoneName() {
+					reason = ReasonUntrustedAnchor
+				}
+				return bogus(zone, reason, fmt.Errorf("the entry key of zone %s could not be verified against the DS records: %w", current.name, err))
+			}
+		}
+		keyRRs := make([]dns.RR, 0, len(keys))
+		for _, key := range keys {
+			keyRRs = append(keyRRs, key)
+		}
+		keySig := toRRSIG(&pair.Entry.Key_sig, current.name, dns.TypeDNSKEY, current.name)
+		if err := checkSigs([]dns.RRSIG{keySig}, trusted, keyRRs, opts); err != nil {
+			return bogus(zone, ReasonBadSignature, fmt.Errorf("the signature of zone %s's keys could not be verified: %w", current.name, err))
+		}
+		if current.name == "." {
+			opts.managedKeys().observe(keys, []dns.RRSIG{keySig}, trusted, opts)
+		}
+		opts.keyCache().add(current.name, keys, []dns.RRSIG{keySig}, opts.now())
+
+		// Leaving the zone, the record has to be signed by one of its now trusted keys
+		exit := &pair.Exit
+		owner := dns.Fqdn(exit.Next_name.String())
+		if !dns.IsSubDomain(current.name, owner) {
+			return bogus(zone, ReasonMalformedChain, fmt.Errorf("the record leaving zone %s is owned by %s outside of it", current.name, owner))
+		}
+		rrs, err := leavingRecords(exit, exit.Rrsig.Ttl)
+		if err != nil {
+			return bogus(zone, ReasonMalformedChain, err)
+		}
+		if len(rrs) == 0 {
+			return bogus(zone, ReasonMalformedChain, fmt.Errorf("no records leave zone %s", current.name))
+		}
+		rrtype := rrs[0].Header().Rrtype
+		sig := toRRSIG(&exit.Rrsig, owner, rrtype, current.name)
+		if err := checkSigs([]dns.RRSIG{sig}, keys, rrs, opts); err != nil {
+			return bogus(zone, ReasonBadSignature, fmt.Errorf("the signature of %s/%s in zone %s could not be verified: %w", owner, dns.TypeToString[rrtype], current.name, err))
+		}
+		authenticated = append(authenticated, rrs)
+
+		switch exit.LeavingType {
+		case dns.LeavingDSType:
+			if dns.CanonicalName(owner) == dns.CanonicalName(current.name) {
+				return bogus(zone, ReasonMalformedChain, fmt.Errorf("zone %s delegates to itself", current.name))
+			}
+			if !dns.IsSubDomain(owner, target) {
+				return bogus(zone, ReasonMalformedChain, fmt.Errorf("the delegation to %s does not lead to %s", owner, target))
+			}
+			dsSet := make([]dns.DS, 0, len(rrs))
+			for _, rr := range rrs {
+				dsSet = append(dsSet, *rr.(*dns.DS))
+			}
+			visited = append(visited, enteredZone{name: dns.CanonicalName(owner), dsSet: dsSet})
+
+		case dns.LeavingCNAMEType, dns.LeavingDNAMEType:
+			validated = append(validated, rrs)
+			if qtype == rrtype && namesMatch(owner, target) {
+				return &Result{Status: Secure, Reason: ReasonValidated, Zone: current.name, ValidatedRRsets: validated, authenticated: authenticated}
+			}
+			rr, next := redirect(rrs, target)
+			if rr == nil {
+				return bogus(zone, ReasonMalformedChain, fmt.Errorf("the %s at %s does not apply to %s", dns.TypeToString[rrtype], owner, target))
+			}
+			if err := rewrites.follow(rr, next); err != nil {
+				return bogus(zone, ReasonRewriteLoop, err)
+			}
+			opts.tracer().add(StepRewrite, true, "%s %s -> %s: %s -> %s", dns.TypeToString[rrtype], owner, dns.Fqdn(exit.Name.String()), target, next)
+			target = next
+			// continue in the closest zone entered so far that contains the new target
+			for len(visited) > 1 && !dns.IsSubDomain(visited[len(visited)-1].name, target) {
+				visited = visited[:len(visited)-1]
+			}
+
+		case dns.LeavingOtherType:
+			expansions, err := findWildcardExpansions(rrs, []dns.RRSIG{sig})
+			if err != nil {
+				return bogus(zone, ReasonInvalidWildcard, err)
+			}
+			if len(expansions) > 0 {
+				// the format has no room for the NSEC records proving that there was no closer match
+				return bogus(zone, ReasonInvalidWildcard, fmt.Errorf("the proof cannot show that %s was correctly expanded from %s: %w", expansions[0].owner, expansions[0].wildcard, ErrProofFormat))
+			}
+
+			switch rrtype {
+			case dns.TypeNSEC:
+				nsecs := make([]*dns.NSEC, 0, len(rrs))
+				for _, rr := range rrs {
+					nsecs = append(nsecs, rr.(*dns.NSEC))
+				}
+				denial, err := verifyNSECDenial(current.name, nsecs, target, qtype)
+				if err != nil {
+					// the target may instead be in a zone below an unsigned delegation
+					if insecure, insecureErr := verifyInsecureDelegation(current.name, nsecs, nil, target); insecureErr == nil {
+						return denialResult(insecure, validated, authenticated)
+					}
+					if beyondFormat(current.name, rrs, target) {
+						err = fmt.Errorf("%v: %w", err, ErrProofFormat)
+					}
+					return bogus(zone, ReasonInvalidDenial, err)
+				}
+				return denialResult(denial, validated, authenticated)
+			case dns.TypeNSEC3:
+				nsec3s := make([]*dns.NSEC3, 0, len(rrs))
+				for _, rr := range rrs {
+					nsec3s = append(nsec3s, rr.(*dns.NSEC3))
+				}
+				denial, err := verifyNSEC3Denial(current.name, nsec3s, target, qtype)
+				if err != nil {
+					if insecure, insecureErr := verifyInsecureDelegation(current.name, nil, nsec3s, target); insecureErr == nil {
+						return denialResult(insecure, validated, authenticated)
+					}
+					if beyondFormat(current.name, rrs, target) {
+						err = fmt.Errorf("%v: %w", err, ErrProofFormat)
+					}
+					return failedDenial(zone, ReasonInvalidDenial, err)
+				}
+				return denialResult(denial, validated, authenticated)
+			}
+			// a covering NSEC or NSEC3 record is owned by another name, the answer itself has to be for the target
+			if !namesMatch(owner, target) {
+				return bogus(zone, ReasonMalformedChain, fmt.Errorf("the records leaving zone %s are for %s, not for %s", current.name, owner, target))
+			}
+			validated = append(validated, rrs)
+			return &Result{Status: Secure, Reason: ReasonValidated, Zone: current.name, ValidatedRRsets: validated, authenticated: authenticated}
+
+		default:
+			return bogus(zone, ReasonMalformedChain, fmt.Errorf("zone %s is left without a committed record", current.name))
+		}
+	}
+	return incomplete(bogus(dns.Name(visited[len(visited)-1].name), ReasonIncompleteChain, fmt.Errorf("the proof ends before reaching %s", target)), target, rewrites, validated, authenticated)
+}
@@ -0,0 +1,174 @@
+package verification
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func serialSignature(sig *dns.RRSIG) dns.Signature {
+	signature, _ := base64.StdEncoding.DecodeString(sig.Signature)
+	return dns.Signature{
+		Algorithm: sig.Algorithm, Labels: sig.Labels, Ttl: sig.OrigTtl, Expires: sig.Expiration, Begins: sig.Inception,
+		Key_tag: sig.KeyTag, SignerName: sig.SignerName, Signature: signature,
+	}
+}
+
+// proofOf turns a chain made by SignChain into the DNSSECProof encoding of the same proof
+func proofOf(chain *dns.Chain) *dns.DNSSECProof {
+	proof := &dns.DNSSECProof{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeDNSSECProof, Class: dns.ClassINET}}
+	for i := range chain.Zones {
+		zone := &chain.Zones[i]
+		if len(zone.Keys) == 0 {
+			continue
+		}
+		pair := dns.ZonePair{Entry: dns.Entering{Key_sig: serialSignature(&zone.KeySigs[0])}}
+		for _, key := range zone.Keys {
+			publicKey, _ := base64.StdEncoding.DecodeString(key.PublicKey)
+			pair.Entry.Keys = append(pair.Entry.Keys, dns.Key{Flags: key.Flags, Protocol: key.Protocol, Algorithm: key.Algorithm, Public_key: publicKey})
+		}
+		// the zone is left to the next one, or with its own leaves if it is the last
+		leaves := zone
+		if i+1 < len(chain.Zones) {
+			leaves = &chain.Zones[i+1]
+		}
+		if leaves != zone && len(leaves.DSSet) > 0 {
+			pair.Exit = dns.Leaving{Next_name: leaves.Name, Rrtype: dns.RRType(dns.TypeDS), Rrsig: serialSignature(&leaves.DSSigs[0]), LeavingType: dns.LeavingDSType}
+			for _, ds := range leaves.DSSet {
+				digest, _ := hex.DecodeString(ds.Digest)
+				pair.Exit.Ds_records = append(pair.Exit.Ds_records, dns.SerialDS{Key_tag: ds.KeyTag, Algorithm: ds.Algorithm, Digest_type: ds.DigestType, Digest: digest})
+			}
+		} else {
+			h := leaves.Leaves[0].Header()
+			pair.Exit = dns.Leaving{Next_name: dns.Name(h.Name), Rrtype: dns.RRType(h.Rrtype), Rrsig: serialSignature(&leaves.LeavesSigs[0]), LeavingType: dns.LeavingOtherType, Rrs: leaves.Leaves}
+		}
+		proof.Zones = append(proof.Zones, pair)
+	}
+	return proof
+}
+
+func TestDNSSECProofLeavingRecords(t *testing.T) {
+	now := time.Now()
+	nsec, _ := dns.NewRR("example.com. 3600 IN NSEC example.com. NS SOA RRSIG NSEC DNSKEY")
+	a, _ := dns.NewRR("www.example.com. 300 IN A 192.0.2.1")
+
+	tests := []struct {
+		name   string
+		leaf   dns.RR
+		qname  string
+		status Status
+		reason Reason
+	}{
+		{"answer", a, "www.example.com.", Secure, ReasonValidated},
+		{"answer for another name", a, "mail.example.com.", Bogus, ReasonMalformedChain},
+		// the NSEC of the apex covers the name, it is not owned by it
+		{"covering NSEC", nsec, "www.example.com.", Secure, ReasonNXDomain},
+		{"NSEC of the name", nsec, "example.com.", Secure, ReasonNoData},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chain, anchor, err := SignChain([]dns.RR{test.leaf}, "ECDSAP256SHA256", 0, now.Add(-time.Hour), now.Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			qtype := dns.TypeA
+			if test.reason == ReasonNoData {
+				qtype = dns.TypeMX
+			}
+			result := verifyDNSSECProof(proofOf(chain), test.qname, qtype, anchor, nil)
+			if result.Status != test.status || result.Reason != test.reason {
+				t.Fatalf("got %v, want %v (%v)", result, test.status, test.reason)
+			}
+		})
+	}
+}
+
+func TestDNSSECProofFromCachedKey(t *testing.T) {
+	now := time.Now()
+	a, _ := dns.NewRR("www.example.com. 300 IN A 192.0.2.1")
+	chain, anchor, err := SignChain([]dns.RR{a}, "ECDSAP256SHA256", 0, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same proof, but starting from the KSK of example.com.
+	short := proofOf(chain)
+	short.Initial_key_tag = chain.Zones[2].Keys[0].KeyTag()
+	short.Zones = short.Zones[2:]
+
+	opts := DefaultOptions()
+	opts.KeyCache = NewKeyCache()
+	if result := verifyDNSSECProof(short, "www.example.com.", dns.TypeA, anchor, opts); result.Status != Bogus || result.Reason != ReasonUnknownTrustPoint {
+		t.Fatalf("got %v before the keys were cached, want %v (%v)", result, Bogus, ReasonUnknownTrustPoint)
+	}
+	if result := verifyDNSSECProof(proofOf(chain), "www.example.com.", dns.TypeA, anchor, opts); result.Status != Secure {
+		t.Fatalf("got %v for the full proof, want %v", result, Secure)
+	}
+	if result := verifyDNSSECProof(short, "www.example.com.", dns.TypeA, anchor, opts); result.Status != Secure {
+		t.Fatalf("got %v from the cached key, want %v", result, Secure)
+	}
+	// the keys of another chain are not in the cache
+	other, _, err := SignChain([]dns.RR{a}, "ECDSAP256SHA256", 0, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := proofOf(other)
+	forged.Initial_key_tag = short.Initial_key_tag
+	forged.Zones = forged.Zones[2:]
+	if result := verifyDNSSECProof(forged, "www.example.com.", dns.TypeA, anchor, opts); result.Status != Bogus {
+		t.Fatalf("got %v for keys signed by another key, want %v", result, Bogus)
+	}
+}
+
+func TestDNSSECProofFormatLimits(t *testing.T) {
+	now := time.Now()
+	// covers b.example.com., but not the wildcard *.example.com., which sorts before a.example.com.
+	nsec, _ := dns.NewRR("a.example.com. 3600 IN NSEC c.example.com. A RRSIG NSEC")
+	wildcard, _ := dns.NewRR("*.example.com. 300 IN A 192.0.2.1")
+
+	tests := []struct {
+		name   string
+		leaf   dns.RR
+		qname  string
+		expand bool
+		reason Reason
+	}{
+		{"NXDOMAIN proof that needs a second NSEC", nsec, "b.example.com.", false, ReasonInvalidDenial},
+		{"answer expanded from a wildcard", wildcard, "www.example.com.", true, ReasonInvalidWildcard},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chain, anchor, err := SignChain([]dns.RR{test.leaf}, "ECDSAP256SHA256", 0, now.Add(-time.Hour), now.Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.expand {
+				// the RRSIG over the wildcard still verifies for the name it was expanded to
+				leaves := &chain.Zones[len(chain.Zones)-1]
+				leaves.Name = dns.Name(test.qname)
+				leaves.Leaves[0].Header().Name = test.qname
+				leaves.LeavesSigs[0].Hdr.Name = test.qname
+			}
+			result := verifyDNSSECProof(proofOf(chain), test.qname, dns.TypeA, anchor, nil)
+			if result.Status != Bogus || result.Reason != test.reason {
+				t.Fatalf("got %v, want %v (%v)", result, Bogus, test.reason)
+			}
+			if !errors.Is(result.Err, ErrProofFormat) {
+				t.Fatalf("the error %v does not tell that the format cannot carry the proof", result.Err)
+			}
+		})
+	}
+
+	// a proof that is wrong, not too big for the format, is not blamed on it
+	chain, anchor, err := SignChain([]dns.RR{nsec}, "ECDSAP256SHA256", 0, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := verifyDNSSECProof(proofOf(chain), "d.example.com.", dns.TypeA, anchor, nil)
+	if result.Status != Bogus || errors.Is(result.Err, ErrProofFormat) {
+		t.Fatalf("got %v for an NSEC that does not cover the name, want %v without the format limit", result, Bogus)
+	}
+}
@@ -0,0 +1,185 @@
+package verification
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// Status is the security status of a response as defined in RFC 4035 section 4.3.
+type Status int
+
+const (
+	// Indeterminate means there was not enough information to decide whether the response should be secure.
+	Indeterminate Status = iota
+	// Secure means an unbroken chain of signed records leads from the trust anchor to the answer.
+	Secure
+	// Insecure means it was proven that there is no chain of trust to the answer.
+	Insecure
+	// Bogus means there should be a chain of trust, but it could not be validated.
+	Bogus
+)
+
+func (s Status) String() string {
+	switch s {
+	case Secure:
+		return "Secure"
+	case Insecure:
+		return "Insecure"
+	case Bogus:
+		return "Bogus"
+	default:
+		return "Indeterminate"
+	}
+}
+
+// Reason is a machine-readable code for why validation ended in its status.
+type Reason string
+
+const (
+	ReasonValidated          Reason = "validated"
+	ReasonNXDomain           Reason = "nxdomain"
+	ReasonNoData             Reason = "nodata"
+	ReasonOptOut             Reason = "opt-out"
+	ReasonInsecureDelegation Reason = "insecure-delegation"
+	ReasonNoProof            Reason = "no-proof"
+	ReasonMissingProof       Reason = "missing-proof"
+	ReasonDowngrade          Reason = "downgrade"
+	ReasonQuestionMismatch   Reason = "question-mismatch"
+	ReasonAnswerMismatch     Reason = "answer-mismatch"
+	ReasonMalformedChain     Reason = "malformed-chain"
+	ReasonUntrustedAnchor    Reason = "untrusted-anchor"
+	ReasonDSMismatch         Reason = "ds-mismatch"
+	ReasonBadSignature       Reason = "bad-signature"
+	ReasonInvalidDenial      Reason = "invalid-denial"
+	ReasonInvalidWildcard    Reason = "invalid-wildcard"
+	ReasonIncompleteChain    Reason = "incomplete-chain"
+	ReasonExpired            Reason = "signature-expired"
+	ReasonNotYetValid        Reason = "signature-not-yet-valid"
+	// ReasonUnsupportedAlgorithm means the zone is only signed with algorithms or digest types the policy does not allow
+	ReasonUnsupportedAlgorithm Reason = "unsupported-algorithm"
+	// ReasonUnknownTrustPoint means the chain starts from a key that is not in the key cache
+	ReasonUnknownTrustPoint Reason = "unknown-trust-point"
+	// ReasonResourceLimit means validating the proof would take more work than the limits allow
+	ReasonResourceLimit Reason = "resource-limit"
+	// ReasonRewriteLoop means the CNAME and DNAME records of the answer lead back to a name already seen
+	ReasonRewriteLoop Reason = "rewrite-loop"
+	// ReasonConflictingProofs means the proofs of a response contradict each other
+	ReasonConflictingProofs Reason = "conflicting-proofs"
+	// ReasonNSEC3Iterations means the zone uses NSEC3 records with more iterations than are hashed (RFC 9276)
+	ReasonNSEC3Iterations Reason = "nsec3-iterations"
+	// ReasonNoTrustAnchor means the name is outside of the zone of the trust anchor (RFC 4033 section 5)
+	ReasonNoTrustAnchor Reason = "no-trust-anchor"
+	// ReasonRcodeMismatch means the RCODE of the response contradicts the proof, e.g. NOERROR with a proof that
+	// the name does not exist
+	ReasonRcodeMismatch Reason = "rcode-mismatch"
+)
+
+// Result is the outcome of validating the DNSSEC proof of a response.
+type Result struct {
+	Status Status
+	Reason Reason
+	// Zone is the zone where validation stopped, either because it succeeded or because it failed there.
+	Zone string
+	// ValidatedRRsets are the answer RRsets whose signatures were validated, in chain order.
+	ValidatedRRsets [][]dns.RR
+	// Denial is set when the proof is an authenticated denial of existence.
+	Denial *DenialOfExistence
+	// Unauthenticated are the records of the authority and additional sections that are not covered by the proof.
+	Unauthenticated []dns.RR
+	// Err describes what went wrong for Bogus and Indeterminate results.
+	Err error
+	// Trace lists the steps of the validation when Options.Explain is set.
+	Trace *Trace
+	// Proofs are the results of the individual proofs when the response carries more than one.
+	Proofs []*Result
+
+	// authenticated holds every RRset validated by the proof, to compare the message against
+	authenticated [][]dns.RR
+	// next is the name a proof that ended after a CNAME or DNAME redirected to, another proof may continue there
+	next string
+}
+
+func (r *Result) String() string {
+	s := fmt.Sprintf("%v (%v)", r.Status, r.Reason)
+	if r.Zone != "" {
+		s += fmt.Sprintf(" at zone %s", r.Zone)
+	}
+	if r.Denial != nil {
+		s += ": " + r.Denial.String()
+	}
+	if r.Err != nil {
+		s += ": " + r.Err.Error()
+	}
+	if len(r.Unauthenticated) > 0 {
+		s += fmt.Sprintf(" (%d unauthenticated records)", len(r.Unauthenticated))
+	}
+	if len(r.Proofs) > 1 {
+		s += fmt.Sprintf(" (%d proofs)", len(r.Proofs))
+	}
+	return s
+}
+
+func bogus(zone dns.Name, reason Reason, err error) *Result {
+	var re *reasonError
+	if errors.As(err, &re) {
+		reason = re.reason
+	}
+	return &Result{Status: Bogus, Reason: reason, Zone: zone.String(), Err: err}
+}
+
+// incomplete keeps what a proof that ended after a CNAME or DNAME has validated, so that
+// another proof in the response can continue from the name it was redirected to.
+func incomplete(result *Result, target string, rewrites *rewriteChain, validated [][]dns.RR, authenticated [][]dns.RR) *Result {
+	if rewrites.rewritten() {
+		result.next = target
+		result.ValidatedRRsets = validated
+		result.authenticated = authenticated
+	}
+	return result
+}
+
+// unsupported is the result for a zone that can only be validated with algorithms the policy
+// does not allow. Such a zone is treated as if it was unsigned (RFC 6840 section 5.2).
+func unsupported(zone dns.Name, err error) *Result {
+	return &Result{Status: Insecure, Reason: ReasonUnsupportedAlgorithm, Zone: zone.String(), Err: err}
+}
+
+// failedDenial is the result for a denial of existence that could not be verified. NSEC3 records with
+// too many iterations make the zone insecure instead of bogus (RFC 9276 section 3.2).
+func failedDenial(zone dns.Name, reason Reason, err error) *Result {
+	if errors.Is(err, errNSEC3Iterations) {
+		return &Result{Status: Insecure, Reason: ReasonNSEC3Iterations, Zone: zone.String(), Err: err}
+	}
+	return bogus(zone, reason, err)
+}
+
+// reasonError is returned by checks that know more precisely than their caller why they failed.
+type reasonError struct {
+	reason Reason
+	err    error
+}
+
+func (e *reasonError) Error() string { return e.err.Error() }
+
+func (e *reasonError) Unwrap() error { return e.err }
+
+// denialResult turns a validated denial of existence into a result. An unsigned delegation
+// is insecure, and so is an opt-out span because it proves that the name may be one.
+func denialResult(denial *DenialOfExistence, validated [][]dns.RR, authenticated [][]dns.RR) *Result {
+	result := &Result{Zone: denial.Zone, Denial: denial, ValidatedRRsets: validated, Status: Secure, authenticated: authenticated}
+	switch denial.Kind {
+	case NXDomain:
+		result.Reason = ReasonNXDomain
+	case NoData:
+		result.Reason = ReasonNoData
+	case InsecureDelegation:
+		result.Status = Insecure
+		result.Reason = ReasonInsecureDelegation
+	default:
+		result.Status = Insecure
+		result.Reason = ReasonOptOut
+	}
+	return result
+}
@@ -0,0 +1,343 @@
+package verification
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/odoh-client-go/bootstrap"
+	"github.com/miekg/dns"
+)
+
+// Root KSKs are tracked as managed keys (RFC 5011), so that the client follows a root KSK roll without a new anchor file.
+// A KSK that appears in a validated root DNSKEY set is trusted once it has been seen for the add hold-down time,
+// and a KSK that revokes itself is never trusted again.
+
+// DefaultAddHoldDown is how long a new root KSK has to be seen before it is trusted (RFC 5011 section 2.4.1).
+const DefaultAddHoldDown = 30 * 24 * time.Hour
+
+// DefaultRemoveHoldDown is how long a revoked root KSK is remembered (RFC 5011 section 2.4.2).
+const DefaultRemoveHoldDown = 30 * 24 * time.Hour
+
+// KeyState is the state of a managed key (RFC 5011 section 4).
+type KeyState string
+
+const (
+	// KeyAddPending is a new key waiting for the add hold-down time to pass.
+	KeyAddPending KeyState = "AddPend"
+	// KeyValid is a trusted key.
+	KeyValid KeyState = "Valid"
+	// KeyMissing is a trusted key that is no longer in the root DNSKEY set. It stays trusted.
+	KeyMissing KeyState = "Missing"
+	// KeyRevoked is a key that was seen with the REVOKE bit, signing the root DNSKEY set.
+	KeyRevoked KeyState = "Revoked"
+)
+
+// ManagedKey is a root KSK and what the client has seen of it. The key is stored without the REVOKE bit.
+type ManagedKey struct {
+	Flags     uint16   `json:"flags"`
+	Algorithm uint8    `json:"algorithm"`
+	PublicKey string   `json:"publicKey"`
+	State     KeyState `json:"state"`
+	// Changed is when the key entered its state, the start of the add hold-down for pending keys
+	// and of the remove hold-down for revoked ones.
+	Changed  time.Time `json:"changed"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+func (k *ManagedKey) dnskey() *dns.DNSKEY {
+	return &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: ".", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET},
+		Flags:     k.Flags,
+		Protocol:  3,
+		Algorithm: k.Algorithm,
+		PublicKey: k.PublicKey,
+	}
+}
+
+// KeyTag is the key tag of the key without the REVOKE bit, the one its DS records and RRSIGs use while it is valid.
+func (k *ManagedKey) KeyTag() uint16 {
+	return k.dnskey().KeyTag()
+}
+
+// trusted says whether the key is a trust anchor
+func (k *ManagedKey) trusted() bool {
+	return k.State == KeyValid || k.State == KeyMissing
+}
+
+// matches says whether the DS record or anchor digest is one of the key
+func (k *ManagedKey) matches(keyTag uint16, algorithm uint8, digestType uint8, digest string) bool {
+	if k.KeyTag() != keyTag || k.Algorithm != algorithm {
+		return false
+	}
+	ds := k.dnskey().ToDS(digestType)
+	return ds != nil && strings.EqualFold(ds.Digest, digest)
+}
+
+// ManagedKeys keeps the state of the root KSKs in a state file. It is safe for concurrent use.
+type ManagedKeys struct {
+	// AddHoldDown is how long a new key has to be seen before it is trusted.
+	AddHoldDown time.Duration
+	// RemoveHoldDown is how long a revoked key is remembered.
+	RemoveHoldDown time.Duration
+
+	path string
+	mu   sync.Mutex
+	keys []*ManagedKey
+}
+
+// LoadManagedKeys reads the managed keys stored in the state file at path. A missing file is not an error,
+// the keys of the anchor file are then taken over the first time the root DNSKEY set is validated.
+func LoadManagedKeys(path string) (*ManagedKeys, error) {
+	m := &ManagedKeys{AddHoldDown: DefaultAddHoldDown, RemoveHoldDown: DefaultRemoveHoldDown, path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &m.keys); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Save writes the managed keys back to the state file.
+func (m *ManagedKeys) Save() error {
+	m.mu.Lock()
+	data, err := json.MarshalIndent(m.keys, "", "  ")
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeState(m.path, data)
+}
+
+// Keys returns a copy of the managed keys, ordered by key tag.
+func (m *ManagedKeys) Keys() []ManagedKey {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]ManagedKey, 0, len(m.keys))
+	for _, k := range m.keys {
+		keys = append(keys, *k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].KeyTag() < keys[j].KeyTag() })
+	return keys
+}
+
+// find returns the managed key with the same algorithm and public key as key, whatever its REVOKE bit.
+func (m *ManagedKeys) find(key *dns.DNSKEY) *ManagedKey {
+	for _, k := range m.keys {
+		if k.Algorithm == key.Algorithm && k.PublicKey == key.PublicKey {
+			return k
+		}
+	}
+	return nil
+}
+
+// anchorDS returns the DS records the DNSKEY set of the anchor's zone is validated against: the digests of the anchor
+// that are valid at now and do not belong to a revoked key, and the trusted managed keys. The managed keys are the
+// root's, they are left out for an anchor of another zone.
+func (m *ManagedKeys) anchorDS(anchor *bootstrap.TrustAnchor, now time.Time) []dns.DS {
+	dsSet := anchor.ToDSAt(now)
+	if m == nil || anchor.ZoneName() != "." {
+		return dsSet
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]dns.DS, 0, len(dsSet)+len(m.keys))
+	for _, ds := range dsSet {
+		revoked := false
+		for _, k := range m.keys {
+			if k.State == KeyRevoked && k.matches(ds.KeyTag, ds.Algorithm, ds.DigestType, ds.Digest) {
+				revoked = true
+			}
+		}
+		if !revoked {
+			res = append(res, ds)
+		}
+	}
+	for _, k := range m.keys {
+		if !k.trusted() {
+			continue
+		}
+		if ds := k.dnskey().ToDS(dns.SHA256); ds != nil {
+			ds.Hdr = dns.RR_Header{Name: ".", Class: dns.ClassINET}
+			res = append(res, *ds)
+		}
+	}
+	return res
+}
+
+// observe updates the managed keys from a root DNSKEY set that was validated against them, with its RRSIGs.
+// Revoked keys only count if they signed the set themselves (RFC 5011 section 2.1).
+func (m *ManagedKeys) observe(keys []*dns.DNSKEY, sigs []dns.RRSIG, trusted []*dns.DNSKEY, opts *Options) {
+	if m == nil || len(keys) == 0 {
+		return
+	}
+	// The timers run on the wall clock. A set verified as of another time, e.g. a captured response checked with
+	// verify --at, only counts if it is also signed now.
+	now := time.Now().UTC()
+	trace := opts.tracer()
+	if !signedAt(sigs, trusted, now, opts.clockSkew()) {
+		trace.add(StepAnchor, true, "the root DNSKEY set is not signed at %s, the managed keys are left as they are", now.Format(time.RFC3339))
+		return
+	}
+	rrs := make([]dns.RR, 0, len(keys))
+	for _, key := range keys {
+		rrs = append(rrs, key)
+	}
+	holdDown := m.AddHoldDown
+	if ttl := time.Duration(keys[0].Hdr.Ttl) * time.Second; ttl > holdDown {
+		holdDown = ttl
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen := make(map[*ManagedKey]bool)
+	for _, key := range keys {
+		if !isKSK(key) {
+			continue
+		}
+		k := m.find(key)
+		if key.Flags&dns.REVOKE != 0 {
+			if !selfSigned(key, sigs, rrs, now, opts.clockSkew()) {
+				trace.add(StepAnchor, false, "root KSK %d has the REVOKE bit but did not sign the DNSKEY set", key.KeyTag())
+				continue
+			}
+			if k == nil {
+				k = &ManagedKey{Flags: key.Flags &^ dns.REVOKE, Algorithm: key.Algorithm, PublicKey: key.PublicKey}
+				m.keys = append(m.keys, k)
+			}
+			if k.State != KeyRevoked {
+				k.State, k.Changed = KeyRevoked, now
+				trace.add(StepAnchor, true, "root KSK %d is revoked and no longer trusted", k.KeyTag())
+			}
+			k.LastSeen = now
+			continue
+		}
+
+		if k == nil {
+			k = &ManagedKey{Flags: key.Flags, Algorithm: key.Algorithm, PublicKey: key.PublicKey, State: KeyAddPending, Changed: now}
+			if containsKey(trusted, key) {
+				// a key the set was validated with is already a trust anchor
+				k.State = KeyValid
+				trace.add(StepAnchor, true, "root KSK %d of the trust anchor is now managed", key.KeyTag())
+			} else {
+				trace.add(StepAnchor, true, "new root KSK %d, trusted from %s on if it stays", key.KeyTag(), now.Add(holdDown).Format(time.RFC3339))
+			}
+			m.keys = append(m.keys, k)
+		}
+		switch k.State {
+		case KeyAddPending:
+			if !now.Before(k.Changed.Add(holdDown)) {
+				k.State, k.Changed = KeyValid, now
+				trace.add(StepAnchor, true, "root KSK %d passed the add hold-down and is trusted", key.KeyTag())
+			}
+		case KeyMissing:
+			k.State, k.Changed = KeyValid, now
+			trace.add(StepAnchor, true, "root KSK %d is back in the root DNSKEY set", key.KeyTag())
+		}
+		k.LastSeen = now
+		seen[k] = true
+	}
+
+	kept := m.keys[:0]
+	for _, k := range m.keys {
+		switch {
+		case k.State == KeyAddPending && !seen[k]:
+			// a pending key that disappears starts over (RFC 5011 section 4, AddPend -> Start)
+			trace.add(StepAnchor, true, "pending root KSK %d left the root DNSKEY set before it was trusted", k.KeyTag())
+			continue
+		case k.State == KeyValid && !seen[k]:
+			k.State, k.Changed = KeyMissing, now
+			trace.add(StepAnchor, true, "root KSK %d is missing from the root DNSKEY set", k.KeyTag())
+		case k.State == KeyRevoked && !now.Before(k.Changed.Add(m.RemoveHoldDown)):
+			continue
+		}
+		kept = append(kept, k)
+	}
+	m.keys = kept
+}
+
+// signedAt checks that one of sigs by a trusted key is within its validity period at now
+func signedAt(sigs []dns.RRSIG, trusted []*dns.DNSKEY, now time.Time, skew time.Duration) bool {
+	for i := range sigs {
+		for _, key := range trusted {
+			if sigs[i].KeyTag == key.KeyTag() && sigs[i].Algorithm == key.Algorithm && checkValidityPeriod(&sigs[i], now, skew) == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selfSigned checks that key signed the DNSKEY set rrs with one of sigs that is valid at now
+func selfSigned(key *dns.DNSKEY, sigs []dns.RRSIG, rrs []dns.RR, now time.Time, skew time.Duration) bool {
+	for i := range sigs {
+		sig := &sigs[i]
+		if sig.KeyTag != key.KeyTag() || sig.Algorithm != key.Algorithm {
+			continue
+		}
+		if checkValidityPeriod(sig, now, skew) != nil {
+			continue
+		}
+		if verifySignature(sig, key, rrs) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Drift describes where the anchor and the managed keys disagree: keys of the root DNSKEY set the anchor does not
+// have, and digests of the anchor for keys that left the root DNSKEY set or were revoked.
+func (m *ManagedKeys) Drift(anchor *bootstrap.TrustAnchor, now time.Time) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.keys) == 0 || anchor.ZoneName() != "." {
+		return nil
+	}
+	warnings := make([]string, 0)
+	digests := anchor.ToDSAt(now)
+	inAnchor := func(k *ManagedKey) bool {
+		for _, ds := range digests {
+			if k.matches(ds.KeyTag, ds.Algorithm, ds.DigestType, ds.Digest) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, k := range m.keys {
+		switch {
+		case k.State == KeyAddPending:
+			warnings = append(warnings, fmt.Sprintf("root KSK %d is new in the root DNSKEY set, it is trusted from %s on",
+				k.KeyTag(), k.Changed.Add(m.AddHoldDown).Format(time.RFC3339)))
+		case k.State == KeyValid && !inAnchor(k):
+			warnings = append(warnings, fmt.Sprintf("root KSK %d is trusted, but not in the anchor file", k.KeyTag()))
+		case k.State == KeyMissing && inAnchor(k):
+			warnings = append(warnings, fmt.Sprintf("root KSK %d of the anchor file is missing from the root DNSKEY set since %s",
+				k.KeyTag(), k.Changed.Format(time.RFC3339)))
+		case k.State == KeyRevoked && inAnchor(k):
+			warnings = append(warnings, fmt.Sprintf("root KSK %d of the anchor file is revoked", k.KeyTag()))
+		}
+	}
+	for _, ds := range digests {
+		known := false
+		for _, k := range m.keys {
+			if k.matches(ds.KeyTag, ds.Algorithm, ds.DigestType, ds.Digest) {
+				known = true
+			}
+		}
+		if !known {
+			warnings = append(warnings, fmt.Sprintf("root KSK %d of the anchor file has not been seen in the root DNSKEY set", ds.KeyTag))
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
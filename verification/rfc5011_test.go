@@ -0,0 +1,48 @@
+package verification
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestManagedKeysWallClock(t *testing.T) {
+	a, _ := dns.NewRR("www.example.com. 300 IN A 192.0.2.1")
+	now := time.Now()
+	inception := time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		at       *time.Time
+		managed  int
+	}{
+		// a captured response verified as of the time it was signed must not move the timers
+		{"captured", inception, inception.Add(2 * time.Hour), &inception, 0},
+		{"current", now.Add(-time.Hour), now.Add(time.Hour), nil, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chain, anchor, err := SignChain([]dns.RR{a}, "ECDSAP256SHA256", 0, test.from, test.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := DefaultOptions()
+			if test.at != nil {
+				at := test.at.Add(time.Hour)
+				opts.Now = func() time.Time { return at }
+			}
+			if opts.ManagedKeys, err = LoadManagedKeys(filepath.Join(t.TempDir(), "managed-keys.json")); err != nil {
+				t.Fatal(err)
+			}
+			if result := verifyDNSSECProofChain(chain, "www.example.com.", dns.TypeA, anchor, opts); result.Status != Secure {
+				t.Fatalf("got %v, want %v", result, Secure)
+			}
+			if keys := opts.ManagedKeys.Keys(); len(keys) != test.managed {
+				t.Fatalf("got %d managed keys, want %d", len(keys), test.managed)
+			}
+		})
+	}
+}
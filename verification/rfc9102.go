@@ -0,0 +1,263 @@
+package verification
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudflare/odoh-client-go/bootstrap"
+	"github.com/miekg/dns"
+)
+
+// RFC 9102 carries a DNSSEC authentication chain in a TLS extension as a two octet lifetime followed by
+// a length prefixed sequence of uncompressed resource records: every RRset needed to validate the answer,
+// together with its RRSIGs, from the answer up to the root DNSKEY RRset. No other structure is on the wire.
+
+// AuthenticationChain is the content of the RFC 9102 dnssec_chain TLS extension.
+type AuthenticationChain struct {
+	// ExtSupportLifetime is the number of hours the server commits to keep sending the extension.
+	ExtSupportLifetime uint16
+	RRs                []dns.RR
+}
+
+// Pack serializes the chain as it is carried in the TLS extension.
+func (a *AuthenticationChain) Pack() ([]byte, error) {
+	size := 0
+	for _, rr := range a.RRs {
+		size += dns.Len(rr)
+	}
+	buf := make([]byte, 4+size)
+	binary.BigEndian.PutUint16(buf, a.ExtSupportLifetime)
+
+	off := 4
+	for _, rr := range a.RRs {
+		var err error
+		// RFC 9102 section 3.1, name compression must not be used
+		if off, err = dns.PackRR(rr, buf, off, nil, false); err != nil {
+			return nil, err
+		}
+	}
+	if off-4 > 0xFFFF {
+		return nil, fmt.Errorf("the authentication chain is %d bytes long, at most %d fit in the extension", off-4, 0xFFFF)
+	}
+	binary.BigEndian.PutUint16(buf[2:], uint16(off-4))
+	return buf[:off], nil
+}
+
+// UnpackAuthenticationChain parses the content of an RFC 9102 dnssec_chain TLS extension.
+func UnpackAuthenticationChain(data []byte) (*AuthenticationChain, error) {
+	if len(data) < 4 {
+		return nil, errors.New("the authentication chain is truncated")
+	}
+	a := &AuthenticationChain{ExtSupportLifetime: binary.BigEndian.Uint16(data)}
+	length := int(binary.BigEndian.Uint16(data[2:]))
+	if len(data) != 4+length {
+		return nil, fmt.Errorf("the authentication chain should be %d bytes long, but is %d", length, len(data)-4)
+	}
+	for off := 4; off < len(data); {
+		rr, next, err := dns.UnpackRR(data, off)
+		if err != nil {
+			return nil, err
+		}
+		if rr == nil || next <= off {
+			return nil, fmt.Errorf("malformed record at offset %d of the authentication chain", off)
+		}
+		a.RRs = append(a.RRs, rr)
+		off = next
+	}
+	return a, nil
+}
+
+// ChainToRFC9102 lists the records of a serialized proof chain in the order of RFC 9102: the leaves first, so that
+// CNAME and DNAME records come before the answer they lead to, then for each zone up to the root its DNSKEY RRset and
+// DS RRset. Every RRset is followed by the RRSIGs over it.
+func ChainToRFC9102(chain *dns.Chain) []dns.RR {
+	rrs := make([]dns.RR, 0)
+	for i := range chain.Zones {
+		zone := &chain.Zones[i]
+		for _, rrset := range groupRRsets(zone.Leaves) {
+			rrs = append(rrs, rrset...)
+			h := rrset[0].Header()
+			for j := range zone.LeavesSigs {
+				sig := &zone.LeavesSigs[j]
+				if sig.TypeCovered == h.Rrtype && (sig.Hdr.Name == "" || strings.EqualFold(sig.Hdr.Name, h.Name)) {
+					rrs = append(rrs, dns.Copy(sig))
+				}
+			}
+		}
+	}
+	for i := len(chain.Zones) - 1; i >= 0; i-- {
+		zone := &chain.Zones[i]
+		for j := range zone.Keys {
+			rrs = append(rrs, dns.Copy(&zone.Keys[j]))
+		}
+		for j := range zone.KeySigs {
+			rrs = append(rrs, dns.Copy(&zone.KeySigs[j]))
+		}
+		for j := range zone.DSSet {
+			rrs = append(rrs, dns.Copy(&zone.DSSet[j]))
+		}
+		for j := range zone.DSSigs {
+			rrs = append(rrs, dns.Copy(&zone.DSSigs[j]))
+		}
+	}
+	return rrs
+}
+
+// ChainFromRFC9102 rebuilds a serialized proof chain from the records of an RFC 9102 authentication chain.
+// Every zone with a DNSKEY RRset becomes a zone of the chain. Answer RRsets that are not owned by the apex of
+// their signing zone get a zone of their own, signed by that parent zone. The zones are ordered from the top
+// zone down to the first answer RRset. When a CNAME or DNAME leads into another part of the tree, the chain
+// goes on from the closest zone it already has down to the RRsets there, in the order they come in rrs.
+func ChainFromRFC9102(rrs []dns.RR) (*dns.Chain, error) {
+	zones := make(map[string]*dns.Zone)
+	// the zones in the order their first record comes in rrs
+	order := make([]string, 0)
+	zone := func(name string) *dns.Zone {
+		name = dns.CanonicalName(name)
+		z, ok := zones[name]
+		if !ok {
+			z = &dns.Zone{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeZone, Class: dns.ClassINET}, Name: dns.Name(name), PreviousName: "."}
+			zones[name] = z
+			order = append(order, name)
+		}
+		return z
+	}
+
+	// the signer of each RRset, so the records can be assigned to the zone they belong to
+	sigs := make([]*dns.RRSIG, 0)
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			sigs = append(sigs, sig)
+		}
+	}
+	signer := func(rr dns.RR) string {
+		h := rr.Header()
+		for _, sig := range sigs {
+			if sig.TypeCovered == h.Rrtype && strings.EqualFold(sig.Hdr.Name, h.Name) {
+				return dns.CanonicalName(sig.SignerName)
+			}
+		}
+		return ""
+	}
+
+	for _, rr := range rrs {
+		h := rr.Header()
+		switch r := rr.(type) {
+		case *dns.DNSKEY:
+			z := zone(h.Name)
+			z.Keys = append(z.Keys, *r)
+		case *dns.DS:
+			z := zone(h.Name)
+			z.DSSet = append(z.DSSet, *r)
+		case *dns.RRSIG:
+			switch r.TypeCovered {
+			case dns.TypeDNSKEY:
+				z := zone(h.Name)
+				z.KeySigs = append(z.KeySigs, *r)
+			case dns.TypeDS:
+				z := zone(h.Name)
+				z.DSSigs = append(z.DSSigs, *r)
+			default:
+				z := zone(leafZone(h.Name, r.SignerName, r.TypeCovered))
+				z.LeavesSigs = append(z.LeavesSigs, *r)
+			}
+		default:
+			s := signer(rr)
+			if s == "" {
+				return nil, fmt.Errorf("the RRset %s/%s is not signed", h.Name, dns.TypeToString[h.Rrtype])
+			}
+			z := zone(leafZone(h.Name, s, h.Rrtype))
+			z.Leaves = append(z.Leaves, rr)
+		}
+	}
+
+	// the top zone, all the others have to be below it
+	top := ""
+	for _, name := range order {
+		if top == "" || dns.CountLabel(name) < dns.CountLabel(top) {
+			top = name
+		}
+	}
+	for _, name := range order {
+		if !dns.IsSubDomain(top, name) {
+			return nil, fmt.Errorf("zone %s is not below zone %s, the authentication chain has to lead from one zone to all of its answers", name, top)
+		}
+	}
+
+	// each path from the top zone to a zone without zones below it, in the order of the zones at their ends
+	chain := &dns.Chain{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeChain, Class: dns.ClassINET}, Version: 1}
+	added := make(map[string]bool)
+	for _, end := range order {
+		isEnd := true
+		for name := range zones {
+			if name != end && dns.IsSubDomain(end, name) {
+				isEnd = false
+				break
+			}
+		}
+		if !isEnd {
+			continue
+		}
+		path := make([]string, 0)
+		for name := range zones {
+			if dns.IsSubDomain(name, end) {
+				path = append(path, name)
+			}
+		}
+		sort.Slice(path, func(i, j int) bool { return dns.CountLabel(path[i]) < dns.CountLabel(path[j]) })
+		for i, name := range path {
+			if added[name] {
+				continue
+			}
+			z := zones[name]
+			if i > 0 {
+				z.PreviousName = dns.Name(path[i-1])
+			}
+			for j := range z.Keys {
+				if !isKSK(&z.Keys[j]) && isZSK(&z.Keys[j]) {
+					z.ZSKIndex = uint8(j)
+					break
+				}
+			}
+			chain.Zones = append(chain.Zones, *z)
+			added[name] = true
+		}
+	}
+	if err := countChain(chain); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+// leafZone decides which zone of the chain an RRset signed by signer belongs to. Denial of existence
+// records stay with their zone, other RRsets get the zone entry named after their owner.
+func leafZone(owner string, signer string, rrtype uint16) string {
+	if rrtype == dns.TypeNSEC || rrtype == dns.TypeNSEC3 {
+		return signer
+	}
+	return owner
+}
+
+// VerifyRFC9102 validates an RFC 9102 authentication chain for the question qname/qtype, for example a
+// chain stapled by a TLS server for its TLSA records. opts may be nil to use the defaults.
+func VerifyRFC9102(data []byte, qname string, qtype uint16, anchor *bootstrap.TrustAnchor, opts *Options) *Result {
+	opts = opts.forProof()
+	authChain, err := UnpackAuthenticationChain(data)
+	if err != nil {
+		return explain(bogus("", ReasonMalformedChain, err), opts)
+	}
+	chain, err := ChainFromRFC9102(authChain.RRs)
+	if err != nil {
+		return explain(bogus("", ReasonMalformedChain, err), opts)
+	}
+	result := verifyDNSSECProofChain(chain, qname, qtype, anchor, opts)
+	if result.Status == Secure && result.Denial == nil {
+		if err := answersQuestion(result.ValidatedRRsets, qname, qtype, opts.limits().MaxRewrites); err != nil {
+			result = bogus(dns.Name(result.Zone), ReasonAnswerMismatch, err)
+		}
+	}
+	return explain(result, opts)
+}
@@ -0,0 +1,175 @@
+package verification
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestAuthenticationChainPackUnpack(t *testing.T) {
+	now := time.Now()
+	tlsa, _ := dns.NewRR("_443._tcp.www.example.com. 300 IN TLSA 3 1 1 0c72ac70b745ac19998811b131d662c9ac69dbdbe7cb23e5b514b56664c5d3d6")
+	chain, _, err := SignChain([]dns.RR{tlsa}, "ECDSAP256SHA256", 0, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authChain := &AuthenticationChain{ExtSupportLifetime: 24, RRs: ChainToRFC9102(chain)}
+	data, err := authChain.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the records follow each other uncompressed
+	uncompressed := make([]byte, 0, len(data))
+	for _, rr := range authChain.RRs {
+		buf := make([]byte, dns.Len(rr))
+		off, err := dns.PackRR(rr, buf, 0, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uncompressed = append(uncompressed, buf[:off]...)
+	}
+	if !bytes.Equal(data[4:], uncompressed) || int(data[2])<<8|int(data[3]) != len(uncompressed) {
+		t.Fatal("the authentication chain is not the length prefixed sequence of its uncompressed records")
+	}
+
+	unpacked, err := UnpackAuthenticationChain(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unpacked.ExtSupportLifetime != 24 || len(unpacked.RRs) != len(authChain.RRs) {
+		t.Fatalf("got lifetime %d and %d records, want 24 and %d", unpacked.ExtSupportLifetime, len(unpacked.RRs), len(authChain.RRs))
+	}
+	for i, rr := range unpacked.RRs {
+		if rr.String() != authChain.RRs[i].String() {
+			t.Fatalf("record %d is %v instead of %v", i, rr, authChain.RRs[i])
+		}
+	}
+
+	malformed := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated header", data[:3]},
+		{"truncated records", data[:len(data)-1]},
+		{"trailing data", append(append([]byte{}, data...), 0)},
+		{"partial record", append([]byte{0, 24, 0, 3}, data[4:7]...)},
+	}
+	for _, test := range malformed {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := UnpackAuthenticationChain(test.data); err == nil {
+				t.Fatal("a malformed authentication chain was unpacked")
+			}
+		})
+	}
+}
+
+func TestRFC9102RoundTrip(t *testing.T) {
+	rr := func(s string) dns.RR {
+		r, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	tests := []struct {
+		name   string
+		leaves []dns.RR
+		// reorder changes the records of the authentication chain before they are packed
+		reorder func(rrs []dns.RR) []dns.RR
+		status  Status
+		reason  Reason
+	}{
+		{
+			name:   "answer",
+			leaves: []dns.RR{rr("www.example.com. 300 IN A 192.0.2.1")},
+			status: Secure,
+		},
+		{
+			name:   "CNAME in the zone",
+			leaves: []dns.RR{rr("www.example.com. 300 IN CNAME web.example.com."), rr("web.example.com. 300 IN A 192.0.2.1")},
+			status: Secure,
+		},
+		{
+			name:   "CNAME into another tree",
+			leaves: []dns.RR{rr("www.example.com. 300 IN CNAME www.example.net."), rr("www.example.net. 300 IN A 192.0.2.1")},
+			status: Secure,
+		},
+		{
+			name: "CNAMEs through three trees",
+			leaves: []dns.RR{
+				rr("www.example.com. 300 IN CNAME www.example.net."),
+				rr("www.example.net. 300 IN CNAME cdn.example.org."),
+				rr("cdn.example.org. 300 IN A 192.0.2.1"),
+			},
+			status: Secure,
+		},
+		{
+			name:   "CNAME without its target",
+			leaves: []dns.RR{rr("www.example.com. 300 IN CNAME www.example.net.")},
+			status: Bogus,
+			reason: ReasonIncompleteChain,
+		},
+		{
+			name:   "answer of another name",
+			leaves: []dns.RR{rr("www.example.com. 300 IN CNAME www.example.net."), rr("web.example.net. 300 IN A 192.0.2.1")},
+			status: Bogus,
+		},
+		{
+			// RFC 9102 section 3.1, the aliases come before the answer they lead to
+			name:   "answer before its CNAME",
+			leaves: []dns.RR{rr("www.example.com. 300 IN CNAME www.example.net."), rr("www.example.net. 300 IN A 192.0.2.1")},
+			reorder: func(rrs []dns.RR) []dns.RR {
+				return append([]dns.RR{rrs[2], rrs[3], rrs[0], rrs[1]}, rrs[4:]...)
+			},
+			status: Bogus,
+			reason: ReasonMalformedChain,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now := time.Now()
+			chain, anchor, err := SignChain(test.leaves, "ECDSAP256SHA256", 0, now.Add(-time.Hour), now.Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rrs := ChainToRFC9102(chain)
+			if test.reorder != nil {
+				rrs = test.reorder(rrs)
+			} else {
+				// the records of the authentication chain give back the chain they were taken from
+				rebuilt, err := ChainFromRFC9102(rrs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, want := FormatChain(rebuilt), FormatChain(chain); got != want {
+					t.Fatalf("the rebuilt chain is\n%s\ninstead of\n%s", got, want)
+				}
+			}
+			data, err := (&AuthenticationChain{ExtSupportLifetime: 24, RRs: rrs}).Pack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := VerifyRFC9102(data, "www.example.com.", dns.TypeA, anchor, nil)
+			if result.Status != test.status || test.reason != "" && result.Reason != test.reason {
+				t.Fatalf("got %v, want %v (%v)", result, test.status, test.reason)
+			}
+		})
+	}
+}
+
+func TestChainFromRFC9102SeveralTops(t *testing.T) {
+	rrs := make([]dns.RR, 0, 2)
+	for _, zone := range []string{"example.com.", "example.net."} {
+		key, err := GenerateKey(zone, dns.ZONE|dns.SEP, "ECDSAP256SHA256", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rrs = append(rrs, key.DNSKEY)
+	}
+	if chain, err := ChainFromRFC9102(rrs); err == nil {
+		t.Fatalf("got a chain from two unrelated zones:\n%s", FormatChain(chain))
+	}
+}
@@ -0,0 +1,245 @@
+package verification
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/circl/sign/ed448"
+	"github.com/cloudflare/odoh-client-go/bootstrap"
+	"github.com/miekg/dns"
+)
+
+// Keys and chains are signed locally to measure algorithms that no resolver serves, like the experimental
+// ones, next to the standard algorithms on the same names.
+
+// DefaultRSAKeyBits is the size of the RSA keys GenerateKey makes if none is given.
+const DefaultRSAKeyBits = 2048
+
+// signingTTL is the TTL of the records of locally signed zones.
+const signingTTL = 3600
+
+// SigningKey is a DNSKEY together with its private key.
+type SigningKey struct {
+	DNSKEY *dns.DNSKEY
+
+	signer crypto.Signer
+	// experimental is the scheme of a PRIVATEDNS key
+	experimental *ExperimentalAlgorithm
+}
+
+// parseAlgorithm resolves the name or number of a DNSSEC algorithm.
+func parseAlgorithm(algorithm string) (uint8, error) {
+	if code, ok := dns.StringToAlgorithm[strings.ToUpper(algorithm)]; ok {
+		return code, nil
+	}
+	code, err := strconv.ParseUint(algorithm, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("unknown algorithm %q", algorithm)
+	}
+	return uint8(code), nil
+}
+
+// GenerateKey creates a key for zone with the given flags, 257 for a KSK and 256 for a ZSK. The algorithm is the name
+// or number of a DNSSEC algorithm, or the name of an experimental one. bits is the size of RSA keys, 0 for the default.
+func GenerateKey(zone string, flags uint16, algorithm string, bits int) (*SigningKey, error) {
+	key := &dns.DNSKEY{
+		Hdr:      dns.RR_Header{Name: dns.Fqdn(zone), Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: signingTTL},
+		Flags:    flags,
+		Protocol: 3,
+	}
+
+	if alg := LookupExperimentalAlgorithm(algorithm); alg != nil {
+		publicKey, signer, err := alg.generate()
+		if err != nil {
+			return nil, err
+		}
+		key.Algorithm = dns.PRIVATEDNS
+		key.PublicKey = base64.StdEncoding.EncodeToString(alg.prefix(publicKey))
+		return &SigningKey{DNSKEY: key, signer: signer, experimental: alg}, nil
+	}
+
+	code, err := parseAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	key.Algorithm = code
+	switch code {
+	case dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512:
+		if bits == 0 {
+			bits = DefaultRSAKeyBits
+		}
+	case dns.ECDSAP256SHA256, dns.ED25519:
+		bits = 256
+	case dns.ECDSAP384SHA384:
+		bits = 384
+	case dns.ED448:
+		publicKey, privateKey, err := ed448.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		key.PublicKey = base64.StdEncoding.EncodeToString(publicKey)
+		return &SigningKey{DNSKEY: key, signer: privateKey}, nil
+	default:
+		return nil, fmt.Errorf("keys of algorithm %s cannot be generated", dns.AlgorithmToString[code])
+	}
+	privateKey, err := key.Generate(bits)
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKey{DNSKEY: key, signer: privateKey.(crypto.Signer)}, nil
+}
+
+// Sign signs the RRset rrs with the key, valid from inception to expiration.
+func (k *SigningKey) Sign(rrs []dns.RR, inception, expiration time.Time) (*dns.RRSIG, error) {
+	if len(rrs) == 0 {
+		return nil, dns.ErrRRset
+	}
+	h := rrs[0].Header()
+	sig := &dns.RRSIG{
+		Hdr:         dns.RR_Header{Name: h.Name, Rrtype: dns.TypeRRSIG, Class: h.Class, Ttl: h.Ttl},
+		TypeCovered: h.Rrtype,
+		Algorithm:   k.DNSKEY.Algorithm,
+		Labels:      uint8(signedLabelCount(h.Name)),
+		OrigTtl:     h.Ttl,
+		Expiration:  uint32(expiration.Unix()),
+		Inception:   uint32(inception.Unix()),
+		KeyTag:      k.DNSKEY.KeyTag(),
+		SignerName:  k.DNSKEY.Hdr.Name,
+	}
+	switch k.DNSKEY.Algorithm {
+	case dns.ED448, dns.PRIVATEDNS:
+		// miekg/dns cannot sign these, they sign the data as verifySignature rebuilds it
+		if !dns.IsRRset(rrs) {
+			return nil, dns.ErrRRset
+		}
+		data, err := signedData(sig, rrs)
+		if err != nil {
+			return nil, err
+		}
+		signature, err := k.signer.Sign(rand.Reader, data, crypto.Hash(0))
+		if err != nil {
+			return nil, err
+		}
+		if k.experimental != nil {
+			signature = k.experimental.prefix(signature)
+		}
+		sig.Signature = base64.StdEncoding.EncodeToString(signature)
+	default:
+		if err := sig.Sign(k.signer, rrs); err != nil {
+			return nil, err
+		}
+	}
+	return sig, nil
+}
+
+// chainZones are the zones a locally signed chain for owner has: the root and the names with one or two labels above it.
+func chainZones(owner string) []string {
+	labels := dns.SplitDomainName(owner)
+	zones := []string{"."}
+	for i := 1; i <= 2 && i <= len(labels); i++ {
+		zones = append(zones, dns.Fqdn(strings.Join(labels[len(labels)-i:], ".")))
+	}
+	return zones
+}
+
+// SignChain builds a proof chain for leaves the way a resolver would serve it. The records either all have the same
+// owner, or they are an answer behind CNAME or DNAME records, with the owners in the order the aliases are followed.
+// Every zone from the root down to an owner's registered domain gets a new KSK and ZSK of the algorithm and signs the
+// DS records of the next one. Zones the path of an earlier owner already has are not repeated, the chain goes back up
+// to the closest of them. It returns the chain and the trust anchor for its root KSK.
+func SignChain(leaves []dns.RR, algorithm string, bits int, inception, expiration time.Time) (*dns.Chain, *bootstrap.TrustAnchor, error) {
+	if len(leaves) == 0 {
+		return nil, nil, fmt.Errorf("a chain needs records to prove")
+	}
+	owners := make([]string, 0, 1)
+	byOwner := make(map[string][]dns.RR)
+	for _, leaf := range leaves {
+		owner := dns.CanonicalName(leaf.Header().Name)
+		if _, ok := byOwner[owner]; !ok {
+			owners = append(owners, owner)
+		}
+		byOwner[owner] = append(byOwner[owner], leaf)
+	}
+
+	chain := &dns.Chain{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeChain, Class: dns.ClassINET}, Version: 1}
+	var anchor *bootstrap.TrustAnchor
+	// the ZSK of every zone signed so far, it signs the DS records of its children and the leaves in it
+	zsks := make(map[string]*SigningKey)
+	for _, owner := range owners {
+		var parent *SigningKey
+		for _, name := range chainZones(owner) {
+			if zsk, ok := zsks[name]; ok {
+				parent = zsk
+				continue
+			}
+			ksk, err := GenerateKey(name, dns.ZONE|dns.SEP, algorithm, bits)
+			if err != nil {
+				return nil, nil, err
+			}
+			zsk, err := GenerateKey(name, dns.ZONE, algorithm, bits)
+			if err != nil {
+				return nil, nil, err
+			}
+			zone := dns.Zone{
+				Hdr:          dns.RR_Header{Name: ".", Rrtype: dns.TypeZone, Class: dns.ClassINET},
+				Name:         dns.Name(name),
+				PreviousName: ".",
+				ZSKIndex:     1,
+				Keys:         []dns.DNSKEY{*ksk.DNSKEY, *zsk.DNSKEY},
+			}
+			keySig, err := ksk.Sign([]dns.RR{ksk.DNSKEY, zsk.DNSKEY}, inception, expiration)
+			if err != nil {
+				return nil, nil, err
+			}
+			zone.KeySigs = []dns.RRSIG{*keySig}
+
+			ds := ksk.DNSKEY.ToDS(dns.SHA256)
+			if parent == nil {
+				anchor = &bootstrap.TrustAnchor{
+					Zone:    ".",
+					Digests: []bootstrap.KeyDigest{{ValidFrom: &inception, KeyTag: ds.KeyTag, Algorithm: ds.Algorithm, DigestType: ds.DigestType, Digest: ds.Digest}},
+				}
+			} else {
+				ds.Hdr.Ttl = signingTTL
+				dsSig, err := parent.Sign([]dns.RR{ds}, inception, expiration)
+				if err != nil {
+					return nil, nil, err
+				}
+				zone.PreviousName = dns.Name(parent.DNSKEY.Hdr.Name)
+				zone.DSSet, zone.DSSigs = []dns.DS{*ds}, []dns.RRSIG{*dsSig}
+			}
+			chain.Zones = append(chain.Zones, zone)
+			zsks[name] = zsk
+			parent = zsk
+		}
+
+		// the leaves go to the last zone if they are at its apex and it has none yet, or else to an entry of their own
+		last := &chain.Zones[len(chain.Zones)-1]
+		if !strings.EqualFold(last.Name.String(), owner) || len(last.Leaves) > 0 {
+			chain.Zones = append(chain.Zones, dns.Zone{
+				Hdr:          dns.RR_Header{Name: ".", Rrtype: dns.TypeZone, Class: dns.ClassINET},
+				Name:         dns.Name(owner),
+				PreviousName: dns.Name(parent.DNSKEY.Hdr.Name),
+			})
+			last = &chain.Zones[len(chain.Zones)-1]
+		}
+		for _, rrset := range groupRRsets(byOwner[owner]) {
+			sig, err := parent.Sign(rrset, inception, expiration)
+			if err != nil {
+				return nil, nil, err
+			}
+			last.Leaves = append(last.Leaves, rrset...)
+			last.LeavesSigs = append(last.LeavesSigs, *sig)
+		}
+	}
+
+	if err := countChain(chain); err != nil {
+		return nil, nil, err
+	}
+	return chain, anchor, nil
+}
@@ -0,0 +1,129 @@
+package verification
+
+import (
+	"github.com/miekg/dns"
+)
+
+// Sizes are in bytes on the wire. Inside a message the fork packs chains without name compression, so the savings
+// are what compressing the names of a chain would save, with pointers only into the chain itself.
+
+// RecordsSize is the number and size of the records of one section of a zone
+type RecordsSize struct {
+	Count int `json:"count"`
+	Bytes int `json:"bytes"`
+}
+
+// ZoneSize is where the bytes of one zone of a proof chain go
+type ZoneSize struct {
+	Name string `json:"name"`
+	// Overhead is the record header, the names, the ZSK index and the counts of the zone
+	Overhead   int         `json:"overhead"`
+	Keys       RecordsSize `json:"keys"`
+	KeySigs    RecordsSize `json:"keySigs"`
+	DS         RecordsSize `json:"ds"`
+	DSSigs     RecordsSize `json:"dsSigs"`
+	Leaves     RecordsSize `json:"leaves"`
+	LeavesSigs RecordsSize `json:"leavesSigs"`
+	Total      int         `json:"total"`
+	// CompressionSavings is how much smaller the zone would be with its names compressed
+	CompressionSavings int `json:"compressionSavings"`
+}
+
+// ChainSize is where the bytes of a proof chain go
+type ChainSize struct {
+	// Overhead is the record header, the version, the initial key tag and the number of zones
+	Overhead           int        `json:"overhead"`
+	Zones              []ZoneSize `json:"zones"`
+	Total              int        `json:"total"`
+	CompressionSavings int        `json:"compressionSavings"`
+}
+
+// Sum adds up the sections of all zones of the chain, with the overhead of the zones in Overhead and Name left empty.
+func (s *ChainSize) Sum() ZoneSize {
+	sum := ZoneSize{Overhead: s.Overhead}
+	add := func(to *RecordsSize, from RecordsSize) {
+		to.Count += from.Count
+		to.Bytes += from.Bytes
+	}
+	for _, zone := range s.Zones {
+		sum.Overhead += zone.Overhead
+		add(&sum.Keys, zone.Keys)
+		add(&sum.KeySigs, zone.KeySigs)
+		add(&sum.DS, zone.DS)
+		add(&sum.DSSigs, zone.DSSigs)
+		add(&sum.Leaves, zone.Leaves)
+		add(&sum.LeavesSigs, zone.LeavesSigs)
+	}
+	sum.Total = s.Total
+	sum.CompressionSavings = s.CompressionSavings
+	return sum
+}
+
+// MeasureChain breaks the size of a chain down by zone and section.
+func MeasureChain(chain *dns.Chain) (*ChainSize, error) {
+	buf := make([]byte, dns.MaxMsgSize)
+	scratch := make([]byte, dns.MaxMsgSize)
+	size := &ChainSize{}
+
+	// the chain without its zones, packed once uncompressed and once at the start of the compressed chain
+	header := &dns.Chain{Hdr: chain.Hdr, Version: chain.Version, InitialKeyTag: chain.InitialKeyTag, NumZones: chain.NumZones}
+	var err error
+	if size.Overhead, err = packedLen(header, scratch); err != nil {
+		return nil, err
+	}
+	compression := make(map[string]int)
+	compressedOff, err := dns.PackRR(header, buf, 0, compression, true)
+	if err != nil {
+		return nil, err
+	}
+	size.Total = size.Overhead
+
+	for i := range chain.Zones {
+		zone := &chain.Zones[i]
+		zoneSize := ZoneSize{Name: zone.Name.String()}
+		sections := []struct {
+			size *RecordsSize
+			rrs  []dns.RR
+		}{
+			{&zoneSize.Keys, keyRRs(zone.Keys)},
+			{&zoneSize.KeySigs, sigRRs(zone.KeySigs)},
+			{&zoneSize.DS, dsRRs(zone.DSSet)},
+			{&zoneSize.DSSigs, sigRRs(zone.DSSigs)},
+			{&zoneSize.Leaves, zone.Leaves},
+			{&zoneSize.LeavesSigs, sigRRs(zone.LeavesSigs)},
+		}
+		records := 0
+		for _, section := range sections {
+			for _, rr := range section.rrs {
+				n, err := packedLen(rr, scratch)
+				if err != nil {
+					return nil, err
+				}
+				section.size.Count++
+				section.size.Bytes += n
+				records += n
+			}
+		}
+		if zoneSize.Total, err = packedLen(zone, scratch); err != nil {
+			return nil, err
+		}
+		zoneSize.Overhead = zoneSize.Total - records
+
+		end, err := dns.PackRR(zone, buf, compressedOff, compression, true)
+		if err != nil {
+			return nil, err
+		}
+		zoneSize.CompressionSavings = zoneSize.Total - (end - compressedOff)
+		compressedOff = end
+
+		size.Zones = append(size.Zones, zoneSize)
+		size.Total += zoneSize.Total
+		size.CompressionSavings += zoneSize.CompressionSavings
+	}
+	return size, nil
+}
+
+// packedLen is the size of a record packed without name compression
+func packedLen(rr dns.RR, buf []byte) (int, error) {
+	return dns.PackRR(rr, buf, 0, nil, false)
+}
@@ -0,0 +1,87 @@
+package verification
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// SignedZones remembers the zones that were seen with a validated DNSSEC proof, so that a
+// later response claiming that they are unsigned can be recognized as a downgrade.
+// It is safe for concurrent use.
+type SignedZones struct {
+	path  string
+	mu    sync.Mutex
+	zones map[string]time.Time
+}
+
+// LoadSignedZones reads the zones stored in the state file at path. A missing file is
+// not an error, it just means that no zone has been seen signed yet.
+func LoadSignedZones(path string) (*SignedZones, error) {
+	s := &SignedZones{path: path, zones: make(map[string]time.Time)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.zones); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save writes the zones back to the state file.
+func (s *SignedZones) Save() error {
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s.zones, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeState(s.path, data)
+}
+
+// writeState replaces a state file with data.
+func writeState(path string, data []byte) error {
+	// write to a temporary file first so an interrupted write does not lose the state
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Record remembers that zone was seen signed at the given time.
+func (s *SignedZones) Record(zone string, seen time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.zones[dns.CanonicalName(zone)] = seen.UTC()
+}
+
+// Between returns a zone that was seen signed, that is at or below ancestor and at or above name.
+func (s *SignedZones) Between(ancestor string, name string) (string, time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for zone, seen := range s.zones {
+		if dns.IsSubDomain(ancestor, zone) && dns.IsSubDomain(zone, name) {
+			return zone, seen, true
+		}
+	}
+	return "", time.Time{}, false
+}
@@ -0,0 +1,81 @@
+package verification
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// StepKind says what a step of a trace did.
+type StepKind string
+
+const (
+	StepProof     StepKind = "proof"
+	StepZone      StepKind = "zone"
+	StepDS        StepKind = "ds"
+	StepSignature StepKind = "signature"
+	StepRewrite   StepKind = "rewrite"
+	StepDenial    StepKind = "denial"
+	StepAnchor    StepKind = "anchor"
+	StepResult    StepKind = "result"
+)
+
+// Step is one thing the verifier checked or decided.
+type Step struct {
+	Kind StepKind `json:"kind"`
+	// Zone is the zone the step happened in.
+	Zone string `json:"zone,omitempty"`
+	// OK is false for checks that failed. A failed check does not fail the proof if another one succeeds.
+	OK      bool   `json:"ok"`
+	Message string `json:"message"`
+}
+
+// Trace records the steps of validating a proof, to find out where and why a chain fails.
+// A nil *Trace records nothing.
+type Trace struct {
+	Steps []Step `json:"steps"`
+
+	zone string
+}
+
+func (t *Trace) enterZone(zone string, format string, a ...interface{}) {
+	if t == nil {
+		return
+	}
+	t.zone = zone
+	t.Steps = append(t.Steps, Step{Kind: StepZone, Zone: zone, OK: true, Message: fmt.Sprintf(format, a...)})
+}
+
+func (t *Trace) add(kind StepKind, ok bool, format string, a ...interface{}) {
+	if t == nil {
+		return
+	}
+	t.Steps = append(t.Steps, Step{Kind: kind, Zone: t.zone, OK: ok, Message: fmt.Sprintf(format, a...)})
+}
+
+// String renders the trace as text, the steps of each zone indented below it.
+func (t *Trace) String() string {
+	if t == nil {
+		return ""
+	}
+	b := strings.Builder{}
+	for _, step := range t.Steps {
+		switch step.Kind {
+		case StepProof, StepZone, StepResult:
+			b.WriteString(step.Message)
+		default:
+			mark := "ok"
+			if !step.OK {
+				mark = "FAILED"
+			}
+			fmt.Fprintf(&b, "  [%s] %s: %s", mark, step.Kind, step.Message)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// JSON renders the trace for tools.
+func (t *Trace) JSON() ([]byte, error) {
+	return json.MarshalIndent(t, "", "  ")
+}
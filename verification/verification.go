@@ -5,10 +5,18 @@ import (
 	"fmt"
 	"github.com/cloudflare/odoh-client-go/bootstrap"
 	"strings"
+	"time"
 
 	"github.com/miekg/dns"
 )
 
+// serialTime interprets the 32-bit RRSIG inception or expiration t with RFC 1982 serial number arithmetic:
+// it is the Unix time closest to now, at most 2^31 seconds (about 68 years) away, whose low 32 bits are t.
+func serialTime(t uint32, now time.Time) int64 {
+	utc := now.Unix()
+	return utc + int64(int32(t-uint32(utc)))
+}
+
 type zoneStack []dns.Zone
 
 func (s zoneStack) isEmpty() bool {
@@ -53,41 +61,88 @@ func isRoot(zone *dns.Zone) bool {
 	return zone.Name == "."
 }
 
-// Assumes the key argument is supposed to be the root key. If it is not the root key, it will
-// fail the same way as if the root key was incorrect.
-func areRootKeysTrusted(dnsKeys []*dns.DNSKEY, anchor *bootstrap.TrustAnchor) (bool, error) {
-	// If this is the root, also verify the DS information of the keys from the DNSKEYs through Root Anchors
-	return areKSKsTrusted(dnsKeys, anchor.ToDS())
+// Assumes the key argument is supposed to be the key of the anchor's zone. If it is not, it will
+// fail the same way as if the key was incorrect.
+func trustedAnchorKeys(dnsKeys []*dns.DNSKEY, anchor *bootstrap.TrustAnchor, opts *Options) ([]*dns.DNSKEY, error) {
+	keys, err := trustedKSKs(dnsKeys, opts.managedKeys().anchorDS(anchor, opts.now()), opts)
+	if err != nil && !errors.Is(err, errUnsupportedDS) {
+		return nil, fmt.Errorf("the keys of %s do not match the trust anchor", anchor.ZoneName())
+	}
+	return keys, err
 }
 
-func areKSKsTrusted(dnsKeys []*dns.DNSKEY, dsSet []dns.DS) (bool, error) {
-	calculatedDSRecords := make([]dns.DS, 0, len(dnsKeys))
-	for _, key := range dnsKeys {
-		if !isKSK(key) {
-			continue
-		}
-		ds := key.ToDS(key.Protocol)
-		if ds != nil {
-			calculatedDSRecords = append(calculatedDSRecords, *ds)
-		}
+// outsideAnchor checks that target is in the zone of the anchor, the island of security a proof can start from.
+// Other names are indeterminate rather than bogus (RFC 4035 section 4.3).
+func outsideAnchor(anchor *bootstrap.TrustAnchor, target string) *Result {
+	if dns.IsSubDomain(anchor.ZoneName(), target) {
+		return nil
+	}
+	return &Result{Status: Indeterminate, Reason: ReasonNoTrustAnchor, Err: fmt.Errorf("%s is outside of %s, the zone of the trust anchor", target, anchor.ZoneName())}
+}
+
+// aboveAnchor tells the zones of a chain from the root that are above the zone of the anchor, which cannot be
+// validated and are skipped
+func aboveAnchor(anchor *bootstrap.TrustAnchor, zone string) bool {
+	return dns.IsSubDomain(zone, anchor.ZoneName()) && !strings.EqualFold(dns.Fqdn(zone), anchor.ZoneName())
+}
+
+// Find the KSKs that are referenced by one of the DS records. Whether the zone is insecure because of the
+// policy is decided by the signed DS records alone: if none of them has an allowed algorithm and digest type the
+// zone is insecure (RFC 8624 section 3). Keys are not signed yet, one that the policy does not allow is skipped,
+// and if no allowed key matches an allowed DS record the zone is bogus.
+func trustedKSKs(dnsKeys []*dns.DNSKEY, dsSet []dns.DS, opts *Options) ([]*dns.DNSKEY, error) {
+	policy := opts.policy()
+	trace := opts.tracer()
+	if len(dsSet) == 0 {
+		return nil, errors.New("there are no DS records to match the KSKs against")
 	}
-	if len(calculatedDSRecords) == len(dsSet) {
-		res := make(map[string]bool)
-		mismatch := false
-		for _, ds := range dsSet {
-			res[strings.ToLower(ds.Digest)] = true
+	trusted := make([]*dns.DNSKEY, 0, len(dnsKeys))
+	supported := false
+	for i := range dsSet {
+		ds := &dsSet[i]
+		if !policy.dsAllowed(ds) {
+			trace.add(StepDS, false, "DS %d/%s/%s is not allowed by the policy", ds.KeyTag, dns.AlgorithmToString[ds.Algorithm], dns.HashToString[ds.DigestType])
+			continue
 		}
-		for _, resolverReturnedDS := range calculatedDSRecords {
-			if _, ok := res[strings.ToLower(resolverReturnedDS.Digest)]; !ok {
-				mismatch = true
+		supported = true
+		matched := false
+		for _, key := range dnsKeys {
+			if !isKSK(key) || key.KeyTag() != ds.KeyTag || key.Algorithm != ds.Algorithm {
+				continue
+			}
+			if !policy.keyAllowed(key) {
+				trace.add(StepDS, false, "KSK %d/%s is not allowed by the policy and is skipped", ds.KeyTag, dns.AlgorithmToString[key.Algorithm])
+				continue
+			}
+			calculated := key.ToDS(ds.DigestType)
+			if calculated != nil && strings.EqualFold(calculated.Digest, ds.Digest) {
+				matched = true
+				trace.add(StepDS, true, "DS %d/%s/%s matches the %s digest of KSK %d", ds.KeyTag, dns.AlgorithmToString[ds.Algorithm], dns.HashToString[ds.DigestType], dns.HashToString[ds.DigestType], key.KeyTag())
+				if !containsKey(trusted, key) {
+					trusted = append(trusted, key)
+				}
 			}
 		}
-		if mismatch {
-			fmt.Printf("Expected root values do not match root anchors.\n")
-			return false, errors.New("expected root values do not match root anchors\n")
+		if !matched {
+			trace.add(StepDS, false, "DS %d/%s/%s matches no KSK", ds.KeyTag, dns.AlgorithmToString[ds.Algorithm], dns.HashToString[ds.DigestType])
 		}
 	}
-	return true, nil
+	if !supported {
+		return nil, errUnsupportedDS
+	}
+	if len(trusted) == 0 {
+		return nil, errors.New("none of the KSKs matches a DS record")
+	}
+	return trusted, nil
+}
+
+func containsKey(keys []*dns.DNSKEY, key *dns.DNSKEY) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
 }
 
 func isZSK(key *dns.DNSKEY) bool {
@@ -118,97 +173,219 @@ func separateKeyTypes(keys []*dns.DNSKEY) (ksks []*dns.DNSKEY, zsks []*dns.DNSKE
 	return ksks, zsks
 }
 
-// Check that for each signature on the RR set, it is verified by at least one key
-func checkSigs(sigs []dns.RRSIG, keys []*dns.DNSKEY, rrs []dns.RR) bool {
+// Check the validity period of a signature using RFC 1982 serial number arithmetic, allowing for clock skew
+func checkValidityPeriod(sig *dns.RRSIG, now time.Time, skew time.Duration) error {
+	utc := now.Unix()
+	inception := serialTime(sig.Inception, now)
+	expiration := serialTime(sig.Expiration, now)
+	if utc < inception-int64(skew.Seconds()) {
+		return &reasonError{ReasonNotYetValid, fmt.Errorf("RRSIG by key %d of %s is not valid before %s", sig.KeyTag, sig.SignerName, time.Unix(inception, 0).UTC())}
+	}
+	if utc > expiration+int64(skew.Seconds()) {
+		return &reasonError{ReasonExpired, fmt.Errorf("RRSIG by key %d of %s expired at %s", sig.KeyTag, sig.SignerName, time.Unix(expiration, 0).UTC())}
+	}
+	return nil
+}
+
+// Check that at least one of the signatures on the RR set is currently valid and verified by one of the keys.
+// Signatures by keys we do not know, e.g. a deprecated older key, are ignored as long as another one verifies.
+func checkSigs(sigs []dns.RRSIG, keys []*dns.DNSKEY, rrs []dns.RR, opts *Options) error {
+	if len(rrs) == 0 {
+		return nil
+	}
+	if len(sigs) == 0 {
+		return errors.New("the RRset is not signed")
+	}
+
+	now := opts.now()
+	policy := opts.policy()
+	work := opts.workBudget()
+	trace := opts.tracer()
+	h := rrs[0].Header()
+	err := fmt.Errorf("none of the %d signatures was made by a trusted key", len(sigs))
 	for _, sig := range sigs {
-		sigVerified := false
-		var keyFound bool
+		if !policy.algorithmAllowed(sig.Algorithm) {
+			trace.add(StepSignature, false, "RRSIG %s/%s by key %d uses %s, which the policy does not allow", h.Name, dns.TypeToString[h.Rrtype], sig.KeyTag, dns.AlgorithmToString[sig.Algorithm])
+			continue
+		}
+		candidates := make([]*dns.DNSKEY, 0, 1)
 		for _, key := range keys {
-			keyFound = false
-			if key.KeyTag() == sig.KeyTag {
-				keyFound = true
-				err := sig.Verify(key, rrs)
-				if err == nil {
-					sigVerified = true
-					break
-				}
+			if key.KeyTag() == sig.KeyTag && policy.keyAllowed(key) {
+				candidates = append(candidates, key)
 			}
 		}
-		if !sigVerified {
-			if !keyFound {
-				// could be deprecated older key, no security concern with the signature here as long as one passes.
-				return true
+		if limitErr := work.checkCollisions(sig.KeyTag, len(candidates)); limitErr != nil {
+			return limitErr
+		}
+		if len(candidates) == 0 {
+			trace.add(StepSignature, false, "RRSIG %s/%s by key %d of %s: no trusted key has this tag", h.Name, dns.TypeToString[h.Rrtype], sig.KeyTag, sig.SignerName)
+		}
+		for _, key := range candidates {
+			if periodErr := checkValidityPeriod(&sig, now, opts.clockSkew()); periodErr != nil {
+				trace.add(StepSignature, false, "RRSIG %s/%s: %v", h.Name, dns.TypeToString[h.Rrtype], periodErr)
+				err = periodErr
+				break
+			}
+			if limitErr := work.spend(); limitErr != nil {
+				return limitErr
+			}
+			if verifyErr := verifySignature(&sig, key, rrs); verifyErr != nil {
+				trace.add(StepSignature, false, "RRSIG %s/%s by key %d of %s: %v", h.Name, dns.TypeToString[h.Rrtype], sig.KeyTag, sig.SignerName, verifyErr)
+				err = verifyErr
+				continue
 			}
-			// this means none of the keys could verify this signature
-			return false
+			trace.add(StepSignature, true, "RRSIG %s/%s verified by key %d (%s) of %s", h.Name, dns.TypeToString[h.Rrtype], sig.KeyTag, dns.AlgorithmToString[key.Algorithm], sig.SignerName)
+			return nil
+		}
+	}
+	return err
+}
+
+// Split a list of records into RRsets, keeping the order in which each RRset was first seen
+func groupRRsets(rrs []dns.RR) [][]dns.RR {
+	index := make(map[string]int)
+	rrsets := make([][]dns.RR, 0)
+	for _, rr := range rrs {
+		h := rr.Header()
+		key := fmt.Sprintf("%s/%d/%d", dns.CanonicalName(h.Name), h.Rrtype, h.Class)
+		i, ok := index[key]
+		if !ok {
+			i = len(rrsets)
+			index[key] = i
+			rrsets = append(rrsets, make([]dns.RR, 0, 1))
+		}
+		rrsets[i] = append(rrsets[i], rr)
+	}
+	return rrsets
+}
+
+// Check records that may span several RRsets, e.g. the NSEC3 records of a denial of existence.
+// Every RRset must be covered by at least one signature that verifies.
+func checkRRsetSigs(sigs []dns.RRSIG, keys []*dns.DNSKEY, rrs []dns.RR, opts *Options) error {
+	for _, rrset := range groupRRsets(rrs) {
+		h := rrset[0].Header()
+		covering := make([]dns.RRSIG, 0, 1)
+		for _, sig := range sigs {
+			if sig.TypeCovered != h.Rrtype {
+				continue
+			}
+			if sig.Hdr.Name != "" && !strings.EqualFold(sig.Hdr.Name, h.Name) {
+				continue
+			}
+			covering = append(covering, sig)
+		}
+		if err := checkSigs(covering, keys, rrset, opts); err != nil {
+			return fmt.Errorf("%s/%s: %w", h.Name, dns.TypeToString[h.Rrtype], err)
 		}
 	}
+	return nil
+}
 
-	return true
+// Find the zone that signed the records of the given type, falling back to the zone the records were found in
+func signerOf(sigs []dns.RRSIG, rrtype uint16, fallback dns.Name) string {
+	for _, sig := range sigs {
+		if sig.TypeCovered == rrtype {
+			return sig.SignerName
+		}
+	}
+	return fallback.String()
 }
 
-func verifyDNSSECProofChain(chain *dns.Chain, target string, anchor *bootstrap.TrustAnchor) (bool, error) {
+func verifyDNSSECProofChain(chain *dns.Chain, target string, qtype uint16, anchor *bootstrap.TrustAnchor, opts *Options) *Result {
 	trustedKeys := make(map[dns.Name][]*dns.DNSKEY)
 	visited := zoneStack{}
-	// Initial state
-	if chain.InitialKeyTag != 0 {
-		// For v1. Use 0 for denoting Root KSK
-		return false, errors.New(fmt.Sprintf("failed due to invalid initial_key_tag state."))
+	validated := make([][]dns.RR, 0)
+	// every leaf RRset whose signatures were validated, including the NSEC and NSEC3 records
+	authenticated := make([][]dns.RR, 0)
+	if len(chain.Zones) == 0 {
+		return bogus("", ReasonMalformedChain, errors.New(fmt.Sprintf("no zones included in proof chain.")))
+	}
+	opts = opts.forProof()
+	if err := opts.workBudget().checkZones(len(chain.Zones)); err != nil {
+		return bogus("", ReasonResourceLimit, err)
 	}
 
-	if len(chain.Zones) == 0 {
-		return false, errors.New(fmt.Sprintf("no zones included in proof chain."))
+	// Initial state. 0 denotes the KSK of the anchor's zone, the root unless it is an island of security, any other
+	// key tag a key of a zone the client already validated. The chain then starts with that zone itself, or with a
+	// child of it.
+	startZone := dns.Name(anchor.ZoneName())
+	if chain.InitialKeyTag == 0 {
+		if result := outsideAnchor(anchor, target); result != nil {
+			return result
+		}
+	} else {
+		first := &chain.Zones[0]
+		if keys := opts.keyCache().lookup(first.Name.String(), chain.InitialKeyTag, opts.now()); keys != nil {
+			startZone = first.Name
+			trustedKeys[startZone] = keys
+		} else if keys := opts.keyCache().lookup(first.PreviousName.String(), chain.InitialKeyTag, opts.now()); keys != nil {
+			trustedKeys[first.PreviousName] = keys
+			visited = visited.push(dns.Zone{Name: first.PreviousName})
+		} else {
+			return bogus(first.Name, ReasonUnknownTrustPoint, fmt.Errorf("the chain starts from key %d, which is not in the key cache", chain.InitialKeyTag))
+		}
 	}
 
+	rewrites := newRewriteChain(target, opts.limits().MaxRewrites)
+	lastZone := dns.Name("")
 	for _, currentZone := range chain.Zones {
-		if visited.isEmpty() && !isRoot(&currentZone) {
-			return false, errors.New(fmt.Sprintf("the first zone is not the root but it should be"))
+		lastZone = currentZone.Name
+		if len(trustedKeys) == 0 && aboveAnchor(anchor, currentZone.Name.String()) {
+			opts.tracer().add(StepAnchor, true, "zone %s is above %s, the zone of the trust anchor, and is skipped", currentZone.Name, startZone)
+			continue
+		}
+		isStart := strings.EqualFold(currentZone.Name.String(), startZone.String()) && visited.isEmpty()
+		if visited.isEmpty() && !isStart {
+			return bogus(currentZone.Name, ReasonMalformedChain, errors.New(fmt.Sprintf("the first zone is not %s but it should be", startZone)))
 		}
 
-		// Check that current_zone.prev_name == visited.peek().name, or matches according to wildcard rules.
-		// TODO need to check that the strings match according to the wildcard rules
-		if !isRoot(&currentZone) && currentZone.PreviousName != visited.peek().Name {
-			return false, errors.New(fmt.Sprintf("proof is incorrect, zones missing or are in the wrong order"))
+		// Check that current_zone.prev_name == visited.peek().name. Zone names themselves are never
+		// wildcards, wildcard expanded leaves are recognized by the labels of their RRSIGs below.
+		if !isStart && !strings.EqualFold(string(currentZone.PreviousName), string(visited.peek().Name)) {
+			return bogus(currentZone.Name, ReasonMalformedChain, errors.New(fmt.Sprintf("proof is incorrect, zones missing or are in the wrong order")))
 		}
 
+		opts.tracer().enterZone(currentZone.Name.String(), "zone %s: %d keys, %d DS, %d leaves", currentZone.Name, len(currentZone.Keys), len(currentZone.DSSet), len(currentZone.Leaves))
+		if err := opts.workBudget().checkKeys(currentZone.Name.String(), len(currentZone.Keys)); err != nil {
+			return bogus(currentZone.Name, ReasonResourceLimit, err)
+		}
 		keyRRs := make([]*dns.DNSKEY, 0, len(currentZone.Keys))
 		for _, key := range currentZone.Keys {
 			keyRRs = append(keyRRs, dns.Copy(&key).(*dns.DNSKEY))
 		}
 		ksks, zsks := separateKeyTypes(keyRRs)
 
-		// check that the root keys are trusted
-		if isRoot(&currentZone) {
-			areTrusted, err := areRootKeysTrusted(ksks, anchor)
-			if err != nil {
-				return false, err
+		if isStart && chain.InitialKeyTag == 0 {
+			// check that the keys of the anchor's zone are trusted
+			trusted, err := trustedAnchorKeys(ksks, anchor, opts)
+			if errors.Is(err, errUnsupportedDS) {
+				return unsupported(currentZone.Name, err)
 			}
-			if areTrusted {
-				trustedKeys[currentZone.Name] = ksks
+			if err != nil {
+				return bogus(currentZone.Name, ReasonUntrustedAnchor, err)
 			}
-		}
-
-		_, parentZSKs := separateKeyTypes(trustedKeys[currentZone.PreviousName])
-
-		// This block is for handling the case where a child zone is signed by its parent's key.
-		// We know that a zone did not use its own keys if it has no DS records.
-		if !isRoot(&currentZone) && len(currentZone.DSSet) == 0 {
+			trustedKeys[currentZone.Name] = trusted
+		} else if isStart {
+			// the keys of the zone the chain starts from come from the key cache
+		} else if len(currentZone.DSSet) == 0 {
+			// This block is for handling the case where a child zone is signed by its parent's key.
+			// We know that a zone did not use its own keys if it has no DS records.
 			// If the current_zone has no delegations and is not the root, but has a
 			// non-empty set of KSKs, fail.
 			if len(ksks) != 0 {
-				return false, errors.New(fmt.Sprintf("If there are keys, there should be delegations."))
+				return bogus(currentZone.Name, ReasonMalformedChain, errors.New(fmt.Sprintf("If there are keys, there should be delegations.")))
 			}
 
 			// If the current zone does not have any keys or DSes then it must have leaves and leaf signatures.
 			if len(currentZone.Leaves) == 0 || len(currentZone.LeavesSigs) == 0 {
-				return false, errors.New(fmt.Sprintf("If there are no keys and no delegations, there should be leaves and leaves signatures."))
+				return bogus(currentZone.Name, ReasonMalformedChain, errors.New(fmt.Sprintf("If there are no keys and no delegations, there should be leaves and leaves signatures.")))
 			}
 
 			for _, leafSig := range currentZone.LeavesSigs {
 				// If the current zone does not have its own keys, we must have seen
 				// the keys when we traversed SignerName already.
 				if _, ok := trustedKeys[dns.Name(leafSig.SignerName)]; !ok {
-					return false, errors.New(fmt.Sprintf("If there are no keys and no delegations, we should have seen the SignerName's (%s) key already.", leafSig.SignerName))
+					return bogus(currentZone.Name, ReasonMalformedChain, errors.New(fmt.Sprintf("If there are no keys and no delegations, we should have seen the SignerName's (%s) key already.", leafSig.SignerName)))
 				}
 			}
 
@@ -221,27 +398,23 @@ func verifyDNSSECProofChain(chain *dns.Chain, target string, anchor *bootstrap.T
 				dsRRs = append(dsRRs, dns.Copy(&ds))
 			}
 
-			// Check that DSSig signatures verify
-			sigVerified := checkSigs(currentZone.DSSigs, parentZSKs, dsRRs)
-
-			// one of the parents' ZSKs should have been used to sign the current zone's DS
-			if !sigVerified {
-				return false, errors.New(fmt.Sprintf("the RRSIG DS for %s could not be verified", currentZone.Name))
+			// Check that DSSig signatures verify, one of the parent's keys should have been used to sign the current zone's DS
+			if err := checkSigs(currentZone.DSSigs, trustedKeys[currentZone.PreviousName], dsRRs, opts); err != nil {
+				return bogus(currentZone.Name, ReasonBadSignature, fmt.Errorf("the RRSIG DS for %s could not be verified: %w", currentZone.Name, err))
 			}
 
 			// check if the KSKs are trusted (against the DSes)
-			trusted, err := areKSKsTrusted(ksks, currentZone.DSSet)
-			if err != nil {
-				return false, err
+			trusted, err := trustedKSKs(ksks, currentZone.DSSet, opts)
+			if errors.Is(err, errUnsupportedDS) {
+				return unsupported(currentZone.Name, err)
 			}
-
-			if !trusted {
-				return false, errors.New(fmt.Sprintf("the KSKs of the zone %s could not be verified against the DS records", currentZone.Name))
+			if err != nil {
+				return bogus(currentZone.Name, ReasonDSMismatch, fmt.Errorf("the KSKs of the zone %s could not be verified against the DS records: %w", currentZone.Name, err))
 			}
 
 			// add trusted KSKs to trust store for current zone---there should be no other
 			// trusted keys for the current zone at this point
-			trustedKeys[currentZone.Name] = ksks
+			trustedKeys[currentZone.Name] = trusted
 		}
 
 		// convert slice of pointers to slice of structs
@@ -251,44 +424,47 @@ func verifyDNSSECProofChain(chain *dns.Chain, target string, anchor *bootstrap.T
 		}
 
 		// check current zone's key signatures against the already trusted keys
-		// for this zone. There must be exactly one key that verifies each signature
-		sigVerified := checkSigs(currentZone.KeySigs, trustedKeys[currentZone.Name], currentZoneKeys)
-		if !sigVerified {
-			return false, errors.New(fmt.Sprintf("the signature of zone %s's keys could not be verified", currentZone.Name))
+		// for this zone. At least one of the signatures has to be verified by one of these keys
+		if err := checkSigs(currentZone.KeySigs, trustedKeys[currentZone.Name], currentZoneKeys, opts); err != nil {
+			return bogus(currentZone.Name, ReasonBadSignature, fmt.Errorf("the signature of zone %s's keys could not be verified: %w", currentZone.Name, err))
 		} else {
+			if isRoot(&currentZone) {
+				opts.managedKeys().observe(keyRRs, currentZone.KeySigs, trustedKeys[currentZone.Name], opts)
+			}
 			// add the ZSKs of the current zone to the trust store, the KSKs are already in there
 			for _, zsk := range zsks {
 				trustedKeys[currentZone.Name] = append(trustedKeys[currentZone.Name], zsk)
 			}
+			if len(currentZone.Keys) > 0 {
+				keys := make([]*dns.DNSKEY, 0, len(currentZone.Keys))
+				for i := range currentZone.Keys {
+					keys = append(keys, &currentZone.Keys[i])
+				}
+				opts.keyCache().add(currentZone.Name.String(), keys, currentZone.KeySigs, opts.now())
+			}
 		}
 
 		nsecFound := false
+		nsecs := make([]*dns.NSEC, 0)
+		nsec3s := make([]*dns.NSEC3, 0)
 		if len(currentZone.Leaves) > 0 {
 			leaves := currentZone.Leaves
 			for _, leaf := range leaves {
-				if leaf.Header().Rrtype == dns.TypeNSEC || leaf.Header().Rrtype == dns.TypeNSEC3 {
-					if leaf.Header().Rrtype == dns.TypeNSEC {
-						nsecData := leaf.(*dns.NSEC)
-						currentDomain := leaf.Header().Name
-						nextDomain := nsecData.NextDomain
-						isCurrAfterNext := strings.Compare(nextDomain, currentDomain)
-						if isCurrAfterNext > 0 {
-							// Black lies: https://blog.cloudflare.com/black-lies
-							return false, errors.New("DNSSEC NSEC is incorrect.")
-						}
-					}
-					if leaf.Header().Rrtype == dns.TypeNSEC3 {
-						_ = leaf.(*dns.NSEC3)
-						// TODO: Fall through for now. This needs NSEC3PARAM validation and comparing hashes.
-					}
+				switch l := leaf.(type) {
+				case *dns.NSEC:
+					nsecs = append(nsecs, l)
+					nsecFound = true
+				case *dns.NSEC3:
+					nsec3s = append(nsec3s, l)
 					nsecFound = true
 				}
 			}
 		}
 
-		if !nsecFound {
-			if len(currentZone.Keys) == 0 || !isZSK(&currentZone.Keys[currentZone.ZSKIndex]) {
-				return false, errors.New(fmt.Sprintf("ZSK index of zone %s does not point to a ZSK", currentZone.Name))
+		// A zone signed by its parent's keys has no keys of its own to point to
+		if !nsecFound && len(currentZone.Keys) > 0 {
+			if int(currentZone.ZSKIndex) >= len(currentZone.Keys) || !isZSK(&currentZone.Keys[currentZone.ZSKIndex]) {
+				return bogus(currentZone.Name, ReasonMalformedChain, errors.New(fmt.Sprintf("ZSK index of zone %s does not point to a ZSK", currentZone.Name)))
 			}
 		}
 
@@ -298,70 +474,195 @@ func verifyDNSSECProofChain(chain *dns.Chain, target string, anchor *bootstrap.T
 			for _, leaf := range currentZone.Leaves {
 				currentZoneLeaves = append(currentZoneLeaves, leaf)
 			}
-			sigVerified := checkSigs(currentZone.LeavesSigs, trustedKeys[currentZone.Name], currentZoneLeaves)
-			if !sigVerified {
-				return false, errors.New(fmt.Sprintf("the signature of zone %s's leaves could not be verified", currentZone.Name))
+			currentZoneLeaves, synthesized := splitSynthesized(currentZoneLeaves, currentZone.LeavesSigs)
+			if err := checkRRsetSigs(currentZone.LeavesSigs, trustedKeys[currentZone.Name], currentZoneLeaves, opts); err != nil {
+				return bogus(currentZone.Name, ReasonBadSignature, fmt.Errorf("the signature of zone %s's leaves could not be verified: %w", currentZone.Name, err))
+			}
+			if err := checkSynthesized(synthesized, currentZoneLeaves); err != nil {
+				return bogus(currentZone.Name, ReasonBadSignature, err)
+			}
+			for _, rrset := range groupRRsets(currentZoneLeaves) {
+				authenticated = append(authenticated, rrset)
+				if t := rrset[0].Header().Rrtype; t != dns.TypeNSEC && t != dns.TypeNSEC3 {
+					validated = append(validated, rrset)
+				}
 			}
 
-			hasCNAME := false
-			for _, leaf := range currentZone.Leaves {
-				switch l := leaf.(type) {
-				case *dns.CNAME:
-					hasCNAME = true
-					if currentZone.Name.String() == target {
-						target = l.Target
-						for {
-							if dns.IsSubDomain(visited.peek().Name.String(), target) {
-								break
-							}
-							visited.pop()
-						}
-					} else {
-						return false, errors.New(fmt.Sprintf("a non-leaf zone %s contains a CNAME", currentZone.Name))
+			// An answer synthesized from a wildcard has to come with a proof that there was no closer match.
+			// In that case the NSEC and NSEC3 leaves are part of the answer, not a denial of existence.
+			expansions, err := findWildcardExpansions(currentZoneLeaves, currentZone.LeavesSigs)
+			if err != nil {
+				return bogus(currentZone.Name, ReasonInvalidWildcard, err)
+			}
+			for _, expansion := range expansions {
+				if err := verifyWildcardProof(expansion, nsecs, nsec3s); err != nil {
+					return failedDenial(currentZone.Name, ReasonInvalidWildcard, err)
+				}
+			}
+
+			if len(expansions) == 0 && len(nsecs) > 0 {
+				// The NSEC records are authenticated, now check what they actually prove
+				zone := signerOf(currentZone.LeavesSigs, dns.TypeNSEC, currentZone.Name)
+				denial, err := verifyNSECDenial(zone, nsecs, target, qtype)
+				traceDenial(opts.tracer(), denial, err)
+				if err != nil {
+					// the target may instead be in a zone below an unsigned delegation
+					if insecure, insecureErr := verifyInsecureDelegation(zone, nsecs, nil, target); insecureErr == nil {
+						traceDenial(opts.tracer(), insecure, nil)
+						return denialResult(insecure, validated, authenticated)
 					}
-					visited = visited.push(currentZone)
-					break
-				case *dns.DNAME:
-					// replace the portion of target matching current_zone.name with dname.target
-					labelsInCommon := dns.CompareDomainName(currentZone.Name.String(), target)
-					s := dns.SplitDomainName(target)
-					oldSuffix := s[len(s)-labelsInCommon:]
-					target = strings.Replace(target, dns.Fqdn(strings.Join(oldSuffix, ".")), l.Target, 1)
-
-					// pop zones off of visited until the new target is within the topmost zone.
-					for {
-						if dns.IsSubDomain(visited.peek().Name.String(), target) {
-							break
-						}
-						visited.pop()
+					return bogus(currentZone.Name, ReasonInvalidDenial, err)
+				}
+				return denialResult(denial, validated, authenticated)
+			}
+
+			if len(expansions) == 0 && len(nsec3s) > 0 {
+				// The NSEC3 records are authenticated, now check what they actually prove
+				zone := signerOf(currentZone.LeavesSigs, dns.TypeNSEC3, currentZone.Name)
+				denial, err := verifyNSEC3Denial(zone, nsec3s, target, qtype)
+				traceDenial(opts.tracer(), denial, err)
+				if err != nil {
+					// the target may instead be in a zone below an unsigned delegation
+					if insecure, insecureErr := verifyInsecureDelegation(zone, nil, nsec3s, target); insecureErr == nil {
+						traceDenial(opts.tracer(), insecure, nil)
+						return denialResult(insecure, validated, authenticated)
 					}
-				case *dns.NSEC:
-					return true, errors.New(fmt.Sprintf("found an NSEC"))
-				case *dns.NSEC3:
-					return true, errors.New(fmt.Sprintf("found an NSEC3"))
+					return failedDenial(currentZone.Name, ReasonInvalidDenial, err)
+				}
+				return denialResult(denial, validated, authenticated)
+			}
+
+			// A CNAME or DNAME redirects the target, unless it is itself the answer. The chain then
+			// continues in the closest zone visited so far that contains the new target.
+			rr, next := redirect(currentZoneLeaves, target)
+			if rr != nil && !(rr.Header().Rrtype == qtype && namesMatch(rr.Header().Name, target)) {
+				if err := rewrites.follow(rr, next); err != nil {
+					return bogus(currentZone.Name, ReasonRewriteLoop, err)
 				}
+				opts.tracer().add(StepRewrite, true, "%s %s -> %s", dns.TypeToString[rr.Header().Rrtype], target, next)
+				target = next
+				for !visited.isEmpty() && !dns.IsSubDomain(visited.peek().Name.String(), target) {
+					visited, _ = visited.pop()
+				}
+				if visited.isEmpty() {
+					return bogus(currentZone.Name, ReasonMalformedChain, fmt.Errorf("%s is outside of the zone the chain starts from", target))
+				}
+				continue
 			}
 
-			if !hasCNAME && currentZone.Name.String() == target {
-				return true, nil
+			if namesMatch(currentZone.Name.String(), target) {
+				return &Result{Status: Secure, Reason: ReasonValidated, Zone: currentZone.Name.String(), ValidatedRRsets: validated, authenticated: authenticated}
 			}
 		} else {
 			visited = visited.push(currentZone)
 		}
 	}
-	return false, nil
+	return incomplete(bogus(lastZone, ReasonIncompleteChain, errors.New(fmt.Sprintf("the proof chain ends before reaching %s", target))), target, rewrites, validated, authenticated)
+}
+
+// ValidateDNSSECSignature validates the serialized DNSSEC proofs carried in the answer and additional sections
+// of msg for the question query/qtype, starting from the root trust anchor. The proofs have to be for that question,
+// and every RRset in the answer section has to be authenticated by them. opts may be nil to use the defaults.
+func ValidateDNSSECSignature(msg *dns.Msg, query string, qtype uint16, anchor *bootstrap.TrustAnchor, opts *Options) *Result {
+	opts = opts.forProof()
+	var result *Result
+	// glue records and other additional data are not proofs and are left for checkSections
+	if proofs := proofRecords(msg); len(proofs) == 0 {
+		result = &Result{Status: Indeterminate, Reason: ReasonNoProof, Err: errors.New("the response does not carry a DNSSEC proof")}
+	} else if err := checkQuestion(msg, query, qtype); err != nil {
+		result = bogus("", ReasonQuestionMismatch, err)
+	} else {
+		result = bindToMessage(verifyProofs(proofs, query, qtype, anchor, opts), msg, query, qtype, opts.limits().MaxRewrites)
+	}
+	return explain(checkDowngrade(result, query, opts), opts)
+}
+
+// explain attaches the trace of the validation to its result.
+func explain(result *Result, opts *Options) *Result {
+	trace := opts.tracer()
+	if trace == nil {
+		return result
+	}
+	trace.zone = ""
+	trace.add(StepResult, result.Status == Secure || result.Status == Insecure, "%v", result)
+	result.Trace = trace
+	return result
+}
+
+func traceDenial(trace *Trace, denial *DenialOfExistence, err error) {
+	if err != nil {
+		trace.add(StepDenial, false, "%v", err)
+		return
+	}
+	trace.add(StepDenial, true, "%v", denial)
+}
+
+// bindToMessage checks that a secure result actually answers the question, that the RCODE agrees with it,
+// and that the records in the message are the ones that were validated.
+func bindToMessage(result *Result, msg *dns.Msg, query string, qtype uint16, maxRewrites int) *Result {
+	if result.Status != Secure {
+		return result
+	}
+	if result.Denial == nil {
+		if err := answersQuestion(result.ValidatedRRsets, query, qtype, maxRewrites); err != nil {
+			return bogus(dns.Name(result.Zone), ReasonAnswerMismatch, err)
+		}
+	} else if err := deniesQuestion(result.ValidatedRRsets, result.Denial, query, maxRewrites); err != nil {
+		return bogus(dns.Name(result.Zone), ReasonAnswerMismatch, err)
+	}
+	if err := checkRcode(msg, result.Denial); err != nil {
+		return bogus(dns.Name(result.Zone), ReasonRcodeMismatch, err)
+	}
+	unauthenticated, err := checkSections(msg, result.authenticated)
+	if err != nil {
+		return bogus(dns.Name(result.Zone), ReasonAnswerMismatch, err)
+	}
+	result.Unauthenticated = unauthenticated
+	return result
 }
 
-func ValidateDNSSECSignature(msg *dns.Msg, query string, anchor *bootstrap.TrustAnchor) (bool, error) {
-	if len(msg.Extra) > 0 {
-		for _, proof := range msg.Extra {
-			r, ok := proof.(*dns.Chain)
-			if ok {
-				// Obtained a DNSSEC Serialized Proof for verification
-				return verifyDNSSECProofChain(r, query, anchor)
+// checkDowngrade compares a result with what is known about the zones of the query. A response without a
+// proof, or one proving that a zone that was seen signed is now unsigned, is treated as an attack.
+func checkDowngrade(result *Result, query string, opts *Options) *Result {
+	signedZones := opts.signedZones()
+	switch result.Status {
+	case Secure:
+		if signedZones != nil && result.Zone != "" {
+			signedZones.Record(result.Zone, opts.now())
+		}
+	case Insecure:
+		if signedZones == nil {
+			break
+		}
+		// everything at or below this name was proven to be unsigned
+		unsigned := result.Zone
+		if result.Denial != nil && result.Denial.Delegation != "" {
+			unsigned = result.Denial.Delegation
+		} else if result.Denial != nil && result.Denial.ClosestEncloser != "" {
+			// an opt-out span only covers the names below the closest encloser
+			labels := dns.SplitDomainName(query)
+			if n := dns.CountLabel(result.Denial.ClosestEncloser) + 1; n <= len(labels) {
+				unsigned = dns.Fqdn(strings.Join(labels[len(labels)-n:], "."))
 			}
-			// Fall through for glue records which have Additional Data but aren't DNSSEC proofs
+		}
+		if zone, seen, ok := signedZones.Between(unsigned, query); ok {
+			return &Result{Status: Bogus, Reason: ReasonDowngrade, Zone: zone, Denial: result.Denial,
+				Err: fmt.Errorf("the response claims that %s is unsigned, but zone %s was seen signed at %s", query, zone, seen.Format(time.RFC3339))}
+		}
+	case Indeterminate:
+		// without a trust anchor for the name there is nothing it could have been downgraded from
+		if !opts.proofRequested() || result.Reason == ReasonNoTrustAnchor {
+			break
+		}
+		if signedZones != nil {
+			if zone, seen, ok := signedZones.Between(".", query); ok {
+				return &Result{Status: Bogus, Reason: ReasonDowngrade, Zone: zone,
+					Err: fmt.Errorf("the proof for %s is missing, but zone %s was seen signed at %s", query, zone, seen.Format(time.RFC3339))}
+			}
+		}
+		if opts.strict() {
+			return &Result{Status: Bogus, Reason: ReasonMissingProof, Err: fmt.Errorf("the DO bit was set, but the response for %s has no proof chain or proof of insecurity", query)}
 		}
 	}
-	return false, nil
+	return result
 }
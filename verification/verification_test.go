@@ -0,0 +1,91 @@
+package verification
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestCheckValidityPeriod(t *testing.T) {
+	inception := time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC)
+	expiration := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+	sig := &dns.RRSIG{KeyTag: 12345, SignerName: "example.", Inception: uint32(inception.Unix()), Expiration: uint32(expiration.Unix())}
+	// a signature made shortly before the 32-bit timestamps wrap around in 2106, and valid after
+	wrap := time.Unix(1<<32, 0)
+	wrapSig := &dns.RRSIG{KeyTag: 12345, SignerName: "example.", Inception: uint32(wrap.Add(-time.Hour).Unix()), Expiration: uint32(wrap.Add(time.Hour).Unix())}
+
+	tests := []struct {
+		name   string
+		sig    *dns.RRSIG
+		now    time.Time
+		skew   time.Duration
+		reason Reason
+	}{
+		{"inside", sig, inception.Add(time.Hour), time.Hour, ""},
+		{"at inception", sig, inception, 0, ""},
+		{"at expiration", sig, expiration, 0, ""},
+		{"before inception", sig, inception.Add(-time.Second), 0, ReasonNotYetValid},
+		{"after expiration", sig, expiration.Add(time.Second), 0, ReasonExpired},
+		{"before inception within the skew", sig, inception.Add(-30 * time.Minute), time.Hour, ""},
+		{"at the skew before inception", sig, inception.Add(-time.Hour), time.Hour, ""},
+		{"beyond the skew before inception", sig, inception.Add(-time.Hour - time.Second), time.Hour, ReasonNotYetValid},
+		{"after expiration within the skew", sig, expiration.Add(30 * time.Minute), time.Hour, ""},
+		{"at the skew after expiration", sig, expiration.Add(time.Hour), time.Hour, ""},
+		{"beyond the skew after expiration", sig, expiration.Add(time.Hour + time.Second), time.Hour, ReasonExpired},
+		{"long expired", sig, expiration.AddDate(30, 0, 0), time.Hour, ReasonExpired},
+		{"before the wraparound", wrapSig, wrap.Add(-30 * time.Minute), 0, ""},
+		{"after the wraparound", wrapSig, wrap.Add(30 * time.Minute), 0, ""},
+		{"expired after the wraparound", wrapSig, wrap.Add(2 * time.Hour), 0, ReasonExpired},
+		{"not yet valid before the wraparound", wrapSig, wrap.Add(-2 * time.Hour), 0, ReasonNotYetValid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkValidityPeriod(test.sig, test.now, test.skew)
+			if test.reason == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var re *reasonError
+			if !errors.As(err, &re) || re.reason != test.reason {
+				t.Fatalf("got error %v, want %v", err, test.reason)
+			}
+		})
+	}
+}
+
+func TestOptionsNow(t *testing.T) {
+	inception := time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC)
+	expiration := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+	a, _ := dns.NewRR("www.example.com. 300 IN A 192.0.2.1")
+	chain, anchor, err := SignChain([]dns.RR{a}, "ECDSAP256SHA256", 0, inception, expiration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := new(dns.Msg)
+	msg.SetQuestion("www.example.com.", dns.TypeA)
+	msg.Response = true
+	msg.Answer = []dns.RR{a}
+	msg.Extra = []dns.RR{chain}
+
+	tests := []struct {
+		now    time.Time
+		status Status
+		reason Reason
+	}{
+		{time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC), Secure, ReasonValidated},
+		{time.Date(2024, 5, 1, 15, 0, 0, 0, time.UTC), Bogus, ReasonExpired},
+	}
+	for _, test := range tests {
+		opts := DefaultOptions()
+		now := test.now
+		opts.Now = func() time.Time { return now }
+		result := ValidateDNSSECSignature(msg, "www.example.com.", dns.TypeA, anchor, opts)
+		if result.Status != test.status || result.Reason != test.reason {
+			t.Errorf("at %s: got %v, want %v (%v)", test.now, result, test.status, test.reason)
+		}
+	}
+}
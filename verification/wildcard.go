@@ -0,0 +1,129 @@
+package verification
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// wildcardExpansion describes an answer RRset that was synthesized from a wildcard.
+type wildcardExpansion struct {
+	// zone is the zone that signed the synthesized RRset
+	zone string
+	// owner is the name the answer was given for
+	owner string
+	// wildcard is the owner name that was actually signed, "*.<closest encloser>"
+	wildcard string
+	// closestEncloser is the parent of the wildcard
+	closestEncloser string
+	// nextCloser is the closest encloser plus one more label of owner
+	nextCloser string
+}
+
+// signedLabelCount returns the number of labels of an owner name as it is counted
+// in the Labels field of an RRSIG, which leaves out the root and a leading wildcard
+// label (RFC 4034 section 3.1.3).
+func signedLabelCount(owner string) int {
+	labels := dns.SplitDomainName(owner)
+	if len(labels) > 0 && labels[0] == "*" {
+		return len(labels) - 1
+	}
+	return len(labels)
+}
+
+// isWildcard checks if a name is a wildcard owner name, i.e. starts with a "*" label
+func isWildcard(name string) bool {
+	return strings.HasPrefix(name, "*.") || name == "*"
+}
+
+// namesMatch compares a name from the proof with the name we are looking for.
+// A wildcard name in the proof matches every name strictly below its parent.
+func namesMatch(name string, target string) bool {
+	if strings.EqualFold(dns.Fqdn(name), dns.Fqdn(target)) {
+		return true
+	}
+	if !isWildcard(name) {
+		return false
+	}
+	parent := dns.Fqdn(strings.TrimPrefix(name, "*."))
+	return dns.IsSubDomain(parent, target) && !strings.EqualFold(parent, dns.Fqdn(target))
+}
+
+// findWildcardExpansions uses the Labels field of the RRSIGs over each RRset to
+// detect answers that were synthesized from a wildcard (RFC 4035 section 5.3.2)
+// and reconstructs the wildcard owner name that was signed.
+func findWildcardExpansions(rrs []dns.RR, sigs []dns.RRSIG) ([]wildcardExpansion, error) {
+	expansions := make([]wildcardExpansion, 0)
+	for _, rrset := range groupRRsets(rrs) {
+		h := rrset[0].Header()
+		if h.Rrtype == dns.TypeNSEC || h.Rrtype == dns.TypeNSEC3 {
+			// denial records are never synthesized
+			continue
+		}
+		ownerLabels := signedLabelCount(h.Name)
+		for _, sig := range sigs {
+			if sig.TypeCovered != h.Rrtype || (sig.Hdr.Name != "" && !strings.EqualFold(sig.Hdr.Name, h.Name)) {
+				continue
+			}
+			if int(sig.Labels) > ownerLabels {
+				return nil, fmt.Errorf("the RRSIG over %s/%s claims more labels (%d) than the owner has", h.Name, dns.TypeToString[h.Rrtype], sig.Labels)
+			}
+			if int(sig.Labels) == ownerLabels {
+				continue
+			}
+
+			labels := dns.SplitDomainName(h.Name)
+			encloser := dns.Fqdn(strings.Join(labels[len(labels)-int(sig.Labels):], "."))
+			if sig.Labels == 0 {
+				encloser = "."
+			}
+			wildcard := "*." + encloser
+			if encloser == "." {
+				wildcard = "*."
+			}
+			expansions = append(expansions, wildcardExpansion{
+				zone:            sig.SignerName,
+				owner:           h.Name,
+				wildcard:        wildcard,
+				closestEncloser: encloser,
+				nextCloser:      dns.Fqdn(strings.Join(labels[len(labels)-int(sig.Labels)-1:], ".")),
+			})
+			break
+		}
+	}
+	return expansions, nil
+}
+
+// verifyWildcardProof checks that the authenticated NSEC or NSEC3 records that came
+// with a wildcard expanded answer prove that no closer match for the owner exists.
+func verifyWildcardProof(expansion wildcardExpansion, nsecs []*dns.NSEC, nsec3s []*dns.NSEC3) error {
+	if !dns.IsSubDomain(expansion.zone, expansion.closestEncloser) {
+		return fmt.Errorf("wildcard %s is outside of its signing zone %s", expansion.wildcard, expansion.zone)
+	}
+
+	// RFC 4035 section 5.3.4, an NSEC has to show that the owner itself does not exist, and that the closest name
+	// that does is the parent of the wildcard. Otherwise a closer name exists that the wildcard does not apply to.
+	for _, nsec := range nsecs {
+		if !dns.IsSubDomain(expansion.zone, nsec.Header().Name) || !nsecCovers(nsec, expansion.owner) {
+			continue
+		}
+		if encloser := nsecEncloser(nsec, expansion.owner); canonicalCompare(encloser, expansion.closestEncloser) != 0 {
+			return fmt.Errorf("the NSEC covering %s shows that %s exists, %s does not apply to it", expansion.owner, encloser, expansion.wildcard)
+		}
+		return nil
+	}
+
+	// RFC 5155 section 8.8, an NSEC3 has to cover the next closer name
+	if len(nsec3s) > 0 {
+		set, err := newNSEC3Set(expansion.zone, nsec3s)
+		if err != nil {
+			return err
+		}
+		if set.cover(expansion.nextCloser) != nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no NSEC or NSEC3 record proves that %s was correctly expanded from %s", expansion.owner, expansion.wildcard)
+}
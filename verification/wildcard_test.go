@@ -0,0 +1,44 @@
+package verification
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestWildcardProofClosestEncloser(t *testing.T) {
+	tests := []struct {
+		name       string
+		owner      string
+		nextCloser string
+		nsec       string
+		valid      bool
+	}{
+		{"expanded below the encloser", "x.example.", "x.example.", "a.example. 3600 IN NSEC z.example. A RRSIG NSEC", true},
+		// b.example. exists, so *.example. does not apply to a.b.example.
+		{"replayed below an existing name", "a.b.example.", "b.example.", "b.example. 3600 IN NSEC c.example. A RRSIG NSEC", false},
+		{"replayed next to an existing descendant", "a.b.example.", "b.example.", "a.example. 3600 IN NSEC z.b.example. A RRSIG NSEC", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr, err := dns.NewRR(test.nsec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expansion := wildcardExpansion{
+				zone:            "example.",
+				owner:           test.owner,
+				wildcard:        "*.example.",
+				closestEncloser: "example.",
+				nextCloser:      test.nextCloser,
+			}
+			err = verifyWildcardProof(expansion, []*dns.NSEC{rr.(*dns.NSEC)}, nil)
+			if test.valid && err != nil {
+				t.Fatalf("got %v, want a valid proof", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("the wildcard proof is accepted")
+			}
+		})
+	}
+}